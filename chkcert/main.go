@@ -40,7 +40,7 @@ var (
 )
 
 func main() {
-	dnsType := flag.String("dns", "alidns", "can be alidns, cloudflare")
+	dnsFlags := dns.AddFlags(flag.CommandLine, "alidns")
 	flag.Usage = func() {
 		fmt.Println("Usage of chkcert [OPTIONS] [PATTERNS...]")
 		fmt.Println(`
@@ -55,16 +55,39 @@ OPTIONS:`)
 	}
 	flag.Parse()
 
-	var client dns.DNS
-	if *dnsType == "alidns" {
-		client = dns.Alidns{}
-	} else if *dnsType == "cloudflare" {
-		client = dns.Cloudflare{}
-	} else {
-		log.Fatal("bad dns type")
+	accounts, names, err := dnsFlags.Accounts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var clients []dns.DNS
+	for _, name := range names {
+		client, err := accounts.New(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		clients = append(clients, client)
 	}
 
-	patterns := flag.Args()
+	err = checkHosts(clients, flag.Args(), func(host string) {
+		fmt.Printf("%40s  %s", host, colorize(textChecking, colorCyan))
+		result, color := getExpiry(host)
+		if len(result) < len(textChecking) {
+			result += strings.Repeat(" ", len(textChecking)-len(result))
+		}
+		fmt.Print("\r")
+		fmt.Printf("%40s  %s", host, colorize(result, color))
+		time.Sleep(300 * time.Millisecond)
+		fmt.Print("\n")
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// checkHosts calls check with the names of the A records of the domains of
+// the clients which contain one of the patterns, or all of them if there are
+// no patterns. A domain whose records can't be listed is skipped.
+func checkHosts(clients []dns.DNS, patterns []string, check func(host string)) error {
 	match := func(name string) bool {
 		if len(patterns) == 0 {
 			return true
@@ -77,23 +100,26 @@ OPTIONS:`)
 		return false
 	}
 
-	domains := client.GetListOfDomains()
-	for _, domain := range domains {
-		for _, record := range client.GetRecords(domain) {
-			if !match(record.FullName) || record.Type != "A" {
+	for _, client := range clients {
+		domains, err := client.GetListOfDomains()
+		if err != nil {
+			return err
+		}
+		for _, domain := range domains {
+			records, err := client.GetRecords(domain)
+			if err != nil {
+				log.Println(err)
 				continue
 			}
-			fmt.Printf("%40s  %s", record.FullName, colorize(textChecking, colorCyan))
-			result, color := getExpiry(record.FullName)
-			if len(result) < len(textChecking) {
-				result += strings.Repeat(" ", len(textChecking)-len(result))
+			for _, record := range records {
+				if !match(record.FullName) || record.Type != "A" {
+					continue
+				}
+				check(record.FullName)
 			}
-			fmt.Print("\r")
-			fmt.Printf("%40s  %s", record.FullName, colorize(result, color))
-			time.Sleep(300 * time.Millisecond)
-			fmt.Print("\n")
 		}
 	}
+	return nil
 }
 
 func getExpiry(host string) (string, int) {
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caiguanhao/certutils/dns"
+)
+
+func TestCheckHosts(t *testing.T) {
+	a := dns.NewMemory("example.com", "example.net")
+	b := dns.NewMemory("example.org")
+	for _, r := range []struct {
+		m                   *dns.Memory
+		domain, name, dtype string
+	}{
+		{a, "example.com", "@", "A"},
+		{a, "example.com", "www", "A"},
+		{a, "example.com", "cdn", "CNAME"},
+		{a, "example.com", "_acme-challenge", "TXT"},
+		{a, "example.net", "api", "A"},
+		{b, "example.org", "@", "A"},
+	} {
+		if _, err := r.m.AddNewRecord(r.domain, r.name, r.dtype, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clients := []dns.DNS{a, b}
+	check := func(patterns ...string) ([]string, error) {
+		var hosts []string
+		err := checkHosts(clients, patterns, func(host string) {
+			hosts = append(hosts, host)
+		})
+		return hosts, err
+	}
+
+	hosts, err := check()
+	if want := []string{"example.com", "www.example.com", "api.example.net", "example.org"}; err != nil || !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts are %q (%v), want %q", hosts, err, want)
+	}
+	hosts, err = check("www", ".net")
+	if want := []string{"www.example.com", "api.example.net"}; err != nil || !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts of patterns are %q (%v), want %q", hosts, err, want)
+	}
+
+	// a domain whose records can't be listed is skipped
+	a.FailNext("GetRecords", errors.New("rate limited"))
+	hosts, err = check()
+	if want := []string{"api.example.net", "example.org"}; err != nil || !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts are %q (%v), want %q", hosts, err, want)
+	}
+	// but the domains of all clients must be listed
+	b.FailNext("GetListOfDomains", errors.New("unauthorized"))
+	if hosts, err = check(); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("hosts are %q (%v), want the error of b", hosts, err)
+	}
+	if a.Calls("GetListOfDomains") != 4 || b.Calls("GetListOfDomains") != 4 {
+		t.Errorf("domains are listed %d and %d times", a.Calls("GetListOfDomains"), b.Calls("GetListOfDomains"))
+	}
+}
+
+func TestGetExpiry(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	host := srv.Listener.Addr().String()
+	if result, color := getExpiry(host); !strings.HasPrefix(result, "ok (") || color != colorGreen {
+		t.Errorf("expiry is %q (%d)", result, color)
+	}
+	srv.Close()
+	if result, color := getExpiry(host); color != colorYellow {
+		t.Errorf("expiry of a closed server is %q (%d)", result, color)
+	}
+}
@@ -0,0 +1,207 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// AcmeDNS uses an acme-dns server (github.com/joohoi/acme-dns), which
+	// serves the TXT records of ACME challenges for names which are CNAMEs of
+	// its subdomains. Each subdomain is an account registered on the server,
+	// and has the two latest TXT records that are updated, which can't be
+	// listed or deleted. The zones of AcmeDNS are the domains of the
+	// subdomains, like auth.example.org.
+	AcmeDNS struct {
+		// URL is the URL of the API, like https://auth.example.org
+		URL string
+		// Accounts are the accounts by the domain names they are for, as in
+		// the storage file of lego and cert-manager
+		Accounts map[string]*AcmeDNSAccount
+		// Storage is the JSON file to save Accounts to after Register
+		Storage string
+		Client  *http.Client
+
+		mu sync.Mutex
+	}
+
+	// AcmeDNSAccount is an account of a subdomain of an acme-dns server.
+	AcmeDNSAccount struct {
+		Username   string   `json:"username"`
+		Password   string   `json:"password"`
+		FullDomain string   `json:"fulldomain"`
+		SubDomain  string   `json:"subdomain"`
+		AllowFrom  []string `json:"allowfrom"`
+	}
+)
+
+var _ DNS = (*AcmeDNS)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "acmedns",
+		Options: []Option{
+			{Name: "url", Type: OptionString, Required: true},
+			{Name: "storage", Type: OptionString, Required: true},
+		},
+		New: func(o Options) (DNS, error) {
+			return newAcmeDNS(o.String("url"), o.String("storage"))
+		},
+		FromEnv: func() (DNS, error) {
+			return NewAcmeDNSFromEnv()
+		},
+	})
+}
+
+// NewAcmeDNSFromEnv returns an AcmeDNS configured by the environment
+// variables ACME_DNS_API_BASE and ACME_DNS_STORAGE_PATH, the accounts file,
+// which is created on Register if it doesn't exist.
+func NewAcmeDNSFromEnv() (*AcmeDNS, error) {
+	url, storage := os.Getenv("ACME_DNS_API_BASE"), os.Getenv("ACME_DNS_STORAGE_PATH")
+	if url == "" || storage == "" {
+		return nil, errors.New("acmedns: please set ACME_DNS_API_BASE and ACME_DNS_STORAGE_PATH")
+	}
+	return newAcmeDNS(url, storage)
+}
+
+// newAcmeDNS returns an AcmeDNS with the accounts in the storage file.
+func newAcmeDNS(url, storage string) (*AcmeDNS, error) {
+	a := &AcmeDNS{
+		URL:      url,
+		Storage:  storage,
+		Accounts: map[string]*AcmeDNSAccount{},
+	}
+	content, err := ioutil.ReadFile(a.Storage)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, errors.New("acmedns: " + err.Error())
+	}
+	if err := json.Unmarshal(content, &a.Accounts); err != nil {
+		return nil, errors.New("acmedns: bad " + a.Storage + ": " + err.Error())
+	}
+	return a, nil
+}
+
+// Account returns the account for the domain name, or nil.
+func (a *AcmeDNS) Account(domain string) *AcmeDNSAccount {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Accounts[strings.TrimPrefix(domain, "*.")]
+}
+
+// Register registers a new account for the domain name on the server and
+// saves it to Storage. The name _acme-challenge of the domain must be a
+// CNAME of the FullDomain of the account.
+func (a *AcmeDNS) Register(domain string) (*AcmeDNSAccount, error) {
+	var account AcmeDNSAccount
+	err := doJSON(a.Client, request{
+		method: "POST",
+		url:    strings.TrimSuffix(a.URL, "/") + "/register",
+	}, &account)
+	if err != nil {
+		return nil, errors.New("acmedns: " + err.Error())
+	}
+	if account.FullDomain == "" {
+		return nil, errors.New("acmedns: no subdomain is registered")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.Accounts == nil {
+		a.Accounts = map[string]*AcmeDNSAccount{}
+	}
+	a.Accounts[strings.TrimPrefix(domain, "*.")] = &account
+	if a.Storage != "" {
+		content, err := json.MarshalIndent(a.Accounts, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(a.Storage), 0700); err != nil {
+			return nil, errors.New("acmedns: " + err.Error())
+		}
+		if err := ioutil.WriteFile(a.Storage, append(content, '\n'), 0600); err != nil {
+			return nil, errors.New("acmedns: " + err.Error())
+		}
+	}
+	return &account, nil
+}
+
+// account returns the account of the subdomain name.
+func (a *AcmeDNS) account(fullDomain string) *AcmeDNSAccount {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, account := range a.Accounts {
+		if strings.EqualFold(strings.TrimSuffix(account.FullDomain, "."), fullDomain) {
+			return account
+		}
+	}
+	return nil
+}
+
+// GetListOfDomains returns the domains of the subdomains of the accounts.
+func (a *AcmeDNS) GetListOfDomains() ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	domains := []string{}
+	seen := map[string]bool{}
+	for _, account := range a.Accounts {
+		name := strings.TrimSuffix(account.FullDomain, ".")
+		i := strings.Index(name, ".")
+		if i < 0 || seen[name[i+1:]] {
+			continue
+		}
+		seen[name[i+1:]] = true
+		domains = append(domains, name[i+1:])
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
+
+// GetRecords returns no records, as they can't be listed.
+func (a *AcmeDNS) GetRecords(domain string) ([]Record, error) {
+	return nil, nil
+}
+
+// GetRecordIdsFor returns no IDs, as the records can't be listed. There is
+// no need to clean them, the older records are replaced by updates.
+func (a *AcmeDNS) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	return []string{}, nil
+}
+
+// AddNewRecord updates the TXT record of the subdomain dname.
+func (a *AcmeDNS) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	if dtype != "TXT" {
+		return "", errors.New("acmedns: only TXT records can be added")
+	}
+	fullDomain := dname + "." + domain
+	account := a.account(fullDomain)
+	if account == nil {
+		return "", errors.New("acmedns: no account of " + fullDomain)
+	}
+	err := doJSON(a.Client, request{
+		method: "POST",
+		url:    strings.TrimSuffix(a.URL, "/") + "/update",
+		header: http.Header{
+			"X-Api-User": {account.Username},
+			"X-Api-Key":  {account.Password},
+		},
+		body: map[string]string{"subdomain": account.SubDomain, "txt": dvalue},
+	}, nil)
+	if err != nil {
+		return "", errors.New("acmedns: " + err.Error())
+	}
+	return recordId(dname, dtype, dvalue), nil
+}
+
+// DeleteRecord does nothing, as the records can't be deleted.
+func (a *AcmeDNS) DeleteRecord(domain, id string) error {
+	return nil
+}
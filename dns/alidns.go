@@ -2,22 +2,45 @@ package dns
 
 import (
 	"encoding/json"
-	"log"
-	"os/exec"
+	"errors"
 	"strconv"
 )
 
 type (
-	Alidns struct{}
+	// Alidns uses the aliyun CLI.
+	Alidns struct {
+		// Profile is the profile of the aliyun CLI, its current one if empty
+		Profile string
+	}
 )
 
 var _ DNS = (*Alidns)(nil)
 
-func (_ Alidns) GetListOfDomains() []string {
-	cmd := exec.Command("aliyun", "alidns", "DescribeDomains")
-	out, err := cmd.Output()
+func init() {
+	Register(Provider{
+		Name:    "alidns",
+		Options: []Option{{Name: "profile", Type: OptionString}},
+		New: func(o Options) (DNS, error) {
+			return Alidns{Profile: o.String("profile")}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return Alidns{}, nil
+		},
+	})
+}
+
+// run runs the aliyun CLI with the profile.
+func (a Alidns) run(args ...string) ([]byte, error) {
+	if a.Profile != "" {
+		args = append(args, "--profile", a.Profile)
+	}
+	return run("aliyun", args...)
+}
+
+func (a Alidns) GetListOfDomains() ([]string, error) {
+	out, err := a.run("alidns", "DescribeDomains")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	var result struct {
 		Domains struct {
@@ -28,26 +51,25 @@ func (_ Alidns) GetListOfDomains() []string {
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	domains := []string{}
 	for _, d := range result.Domains.Domain {
 		domains = append(domains, d.DomainName)
 	}
-	return domains
+	return domains, nil
 }
 
-func (a Alidns) GetRecords(domain string) []Record {
+func (a Alidns) GetRecords(domain string) ([]Record, error) {
 	return a.getRecords(domain, 1)
 }
 
-func (a Alidns) getRecords(domain string, page int) (records []Record) {
-	cmd := exec.Command("aliyun", "alidns", "DescribeDomainRecords",
+func (a Alidns) getRecords(domain string, page int) (records []Record, err error) {
+	out, err := a.run("alidns", "DescribeDomainRecords",
 		"--DomainName", domain, "--PageNumber", strconv.Itoa(page))
-	out, err := cmd.Output()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	var result struct {
 		DomainRecords struct {
@@ -64,7 +86,7 @@ func (a Alidns) getRecords(domain string, page int) (records []Record) {
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	for _, d := range result.DomainRecords.Record {
 		fullName := domain
@@ -79,18 +101,24 @@ func (a Alidns) getRecords(domain string, page int) (records []Record) {
 			Content:  d.Value,
 		})
 	}
+	if result.PageSize == 0 {
+		return
+	}
 	totalPages := result.TotalCount/result.PageSize + 1
 	if result.PageNumber < totalPages {
-		records = append(records, a.getRecords(domain, result.PageNumber+1)...)
+		more, err := a.getRecords(domain, result.PageNumber+1)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, more...)
 	}
 	return
 }
 
-func (_ Alidns) GetRecordIdsFor(domain, dname, dtype string) []string {
-	cmd := exec.Command("aliyun", "alidns", "DescribeDomainRecords", "--DomainName", domain)
-	out, err := cmd.Output()
+func (a Alidns) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	out, err := a.run("alidns", "DescribeDomainRecords", "--DomainName", domain)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	var result struct {
 		DomainRecords struct {
@@ -103,7 +131,7 @@ func (_ Alidns) GetRecordIdsFor(domain, dname, dtype string) []string {
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	ids := []string{}
 	for _, d := range result.DomainRecords.Record {
@@ -111,40 +139,39 @@ func (_ Alidns) GetRecordIdsFor(domain, dname, dtype string) []string {
 			ids = append(ids, d.RecordId)
 		}
 	}
-	return ids
+	return ids, nil
 }
 
-func (_ Alidns) AddNewRecord(domain, dname, dtype, dvalue string) string {
-	cmd := exec.Command("aliyun", "alidns", "AddDomainRecord", "--DomainName", domain,
+func (a Alidns) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	out, err := a.run("alidns", "AddDomainRecord", "--DomainName", domain,
 		"--RR", dname, "--Type", dtype, "--Value", dvalue)
-	out, err := cmd.Output()
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	var result struct {
 		RecordId string
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	return result.RecordId
+	return result.RecordId, nil
 }
 
-func (_ Alidns) DeleteRecord(domain, id string) {
-	cmd := exec.Command("aliyun", "alidns", "DeleteDomainRecord", "--RecordId", id)
-	out, err := cmd.Output()
+func (a Alidns) DeleteRecord(domain, id string) error {
+	out, err := a.run("alidns", "DeleteDomainRecord", "--RecordId", id)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	var result struct {
 		RecordId string
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	if result.RecordId != id {
-		log.Fatal(string(out))
+		return errors.New(string(out))
 	}
+	return nil
 }
@@ -0,0 +1,275 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// Baidu uses the DNS API of Baidu AI Cloud, signed with BCE auth v1.
+	Baidu struct {
+		AccessKey string
+		SecretKey string
+		// Endpoint is https://dns.baidubce.com by default
+		Endpoint string
+		TTL      int
+		Client   *http.Client
+	}
+
+	baiduRecord struct {
+		Id    string `json:"id"`
+		Rr    string `json:"rr"`
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+)
+
+// baiduPageSize is the most items of a page the API returns
+const baiduPageSize = "1000"
+
+var _ DNS = (*Baidu)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "baidu",
+		Options: []Option{
+			{Name: "access_key", Type: OptionString, Required: true},
+			{Name: "secret_key", Type: OptionString, Required: true},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &Baidu{
+				AccessKey: o.String("access_key"),
+				SecretKey: o.String("secret_key"),
+				Endpoint:  o.String("endpoint"),
+				TTL:       o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewBaiduFromEnv()
+		},
+	})
+}
+
+// NewBaiduFromEnv returns a Baidu configured by the environment variables
+// BAIDUCLOUD_ACCESS_KEY_ID and BAIDUCLOUD_SECRET_ACCESS_KEY.
+func NewBaiduFromEnv() (*Baidu, error) {
+	b := &Baidu{
+		AccessKey: os.Getenv("BAIDUCLOUD_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("BAIDUCLOUD_SECRET_ACCESS_KEY"),
+	}
+	if b.AccessKey == "" || b.SecretKey == "" {
+		return nil, errors.New("baidu: please set BAIDUCLOUD_ACCESS_KEY_ID and BAIDUCLOUD_SECRET_ACCESS_KEY")
+	}
+	return b, nil
+}
+
+// sign signs a request with BCE auth v1.
+func (b *Baidu) sign(req *http.Request, body []byte) error {
+	return b.signAt(req, body, time.Now())
+}
+
+// signAt signs a request at the time t, with the headers the BCE SDKs sign
+// by default: Host, Content-Length, Content-Type, Content-MD5 and the
+// x-bce-* headers, if there are.
+func (b *Baidu) signAt(req *http.Request, body []byte, t time.Time) error {
+	timestamp := t.UTC().Format("2006-01-02T15:04:05Z")
+	req.Header.Set("X-Bce-Date", timestamp)
+	prefix := "bce-auth-v1/" + b.AccessKey + "/" + timestamp + "/1800"
+	signingKey := hex.EncodeToString(hmacSHA256([]byte(b.SecretKey), prefix))
+
+	var names, headers []string
+	for name := range req.Header {
+		name = strings.ToLower(name)
+		switch {
+		case name == "content-length", name == "content-type", name == "content-md5",
+			strings.HasPrefix(name, "x-bce-"):
+		default:
+			continue
+		}
+		if value := strings.TrimSpace(req.Header.Get(name)); value != "" {
+			names = append(names, name)
+			headers = append(headers, uriEncode(name, true)+":"+uriEncode(value, true))
+		}
+	}
+	names = append(names, "host")
+	headers = append(headers, "host:"+uriEncode(req.URL.Host, true))
+	sort.Strings(names)
+	// the canonical headers are sorted as lines, not by their names
+	sort.Strings(headers)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		strings.Join(headers, "\n"),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256([]byte(signingKey), canonicalRequest))
+	req.Header.Set("Authorization", prefix+"/"+strings.Join(names, ";")+"/"+signature)
+	return nil
+}
+
+func (b *Baidu) do(method, path string, query url.Values, body, result interface{}) error {
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = "https://dns.baidubce.com"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	err := doJSON(b.Client, request{method: method, url: u, body: body, sign: b.sign}, result)
+	if err != nil {
+		return errors.New("baidu: " + err.Error())
+	}
+	return nil
+}
+
+// list gets the pages of a list until it is not truncated, page returns the
+// result to decode the next page into and add adds its items.
+func (b *Baidu) list(path string, query url.Values, page func() interface{}, add func() (string, bool)) error {
+	marker := ""
+	for {
+		q := url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		q.Set("maxKeys", baiduPageSize)
+		if marker != "" {
+			q.Set("marker", marker)
+		}
+		if err := b.do("GET", path, q, nil, page()); err != nil {
+			return err
+		}
+		next, truncated := add()
+		if !truncated || next == "" {
+			return nil
+		}
+		marker = next
+	}
+}
+
+// clientToken returns a token to make a change idempotent.
+func clientToken() string {
+	var token [16]byte
+	rand.Read(token[:])
+	return hex.EncodeToString(token[:])
+}
+
+func (b *Baidu) GetListOfDomains() ([]string, error) {
+	domains := []string{}
+	var result struct {
+		Zones []struct {
+			Name string `json:"name"`
+		} `json:"zones"`
+		IsTruncated bool   `json:"isTruncated"`
+		NextMarker  string `json:"nextMarker"`
+	}
+	err := b.list("/v1/dns/zone", nil, func() interface{} {
+		result.Zones = nil
+		return &result
+	}, func() (string, bool) {
+		for _, z := range result.Zones {
+			domains = append(domains, strings.TrimSuffix(z.Name, "."))
+		}
+		return result.NextMarker, result.IsTruncated
+	})
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// getRecords returns the records of the zone, query filters them.
+func (b *Baidu) getRecords(domain string, query url.Values) ([]baiduRecord, error) {
+	var records []baiduRecord
+	var result struct {
+		Records     []baiduRecord `json:"records"`
+		IsTruncated bool          `json:"isTruncated"`
+		NextMarker  string        `json:"nextMarker"`
+	}
+	err := b.list("/v1/dns/zone/"+url.PathEscape(domain)+"/record", query, func() interface{} {
+		result.Records = nil
+		return &result
+	}, func() (string, bool) {
+		records = append(records, result.Records...)
+		return result.NextMarker, result.IsTruncated
+	})
+	return records, err
+}
+
+func (b *Baidu) GetRecords(domain string) (records []Record, err error) {
+	list, err := b.getRecords(domain, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		fullName := domain
+		if r.Rr != "@" {
+			fullName = r.Rr + "." + fullName
+		}
+		records = append(records, Record{
+			Id:       r.Id,
+			Type:     r.Type,
+			Name:     r.Rr,
+			FullName: fullName,
+			Content:  r.Value,
+		})
+	}
+	return
+}
+
+func (b *Baidu) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	list, err := b.getRecords(domain, url.Values{"rr": {dname}})
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range list {
+		if r.Rr == dname && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+// AddNewRecord adds the record and finds its ID, as the API doesn't return
+// it.
+func (b *Baidu) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	ttl := b.TTL
+	if ttl == 0 {
+		ttl = 300
+	}
+	body := map[string]interface{}{
+		"rr":    dname,
+		"type":  dtype,
+		"value": dvalue,
+		"ttl":   ttl,
+	}
+	path := "/v1/dns/zone/" + url.PathEscape(domain) + "/record"
+	if err := b.do("POST", path, url.Values{"clientToken": {clientToken()}}, body, nil); err != nil {
+		return "", err
+	}
+	list, err := b.getRecords(domain, url.Values{"rr": {dname}})
+	if err != nil {
+		return "", err
+	}
+	for _, r := range list {
+		if r.Rr == dname && r.Type == dtype && r.Value == dvalue {
+			return r.Id, nil
+		}
+	}
+	return "", errors.New("baidu: added record is not found")
+}
+
+func (b *Baidu) DeleteRecord(domain, id string) error {
+	path := "/v1/dns/zone/" + url.PathEscape(domain) + "/record/" + url.PathEscape(id)
+	return b.do("DELETE", path, url.Values{"clientToken": {clientToken()}}, nil, nil)
+}
@@ -0,0 +1,29 @@
+package dns
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestBaiduSign checks the signature of the example in the documentation of
+// BCE auth v1 (generating the authentication string).
+func TestBaiduSign(t *testing.T) {
+	b := &Baidu{AccessKey: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", SecretKey: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+	req, err := http.NewRequest("PUT", "https://bj.bcebos.com/v1/test/myfolder/readme.txt?partNumber=9&uploadId=a44cc9bab11cbd156984767aad637851", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Length", "8")
+	req.Header.Set("Content-MD5", "NFzcPqhviddjRNnSOGo4rw==")
+	req.Header.Set("Content-Type", "text/plain")
+	if err := b.signAt(req, []byte("Example\n"), time.Date(2015, 4, 27, 8, 23, 49, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	want := "bce-auth-v1/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa/2015-04-27T08:23:49Z/1800/" +
+		"content-length;content-md5;content-type;host;x-bce-date/" +
+		"d74a04362e6a848f5b39b15421cb449427f419c95a480fd6b8cf9fc783e2999e"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization is\n%s\nwant\n%s", got, want)
+	}
+}
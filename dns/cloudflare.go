@@ -2,43 +2,57 @@ package dns
 
 import (
 	"encoding/json"
-	"log"
-	"os/exec"
 	"strings"
 )
 
 type (
-	Cloudflare struct{}
+	// Cloudflare uses the cloudflare CLI.
+	Cloudflare struct {
+		// Env are environment variables (KEY=VALUE) of the cloudflare CLI,
+		// like its credentials or HOME with another configuration
+		Env []string
+	}
 )
 
 var _ DNS = (*Cloudflare)(nil)
 
-func (_ Cloudflare) GetListOfDomains() []string {
-	cmd := exec.Command("cloudflare", "--raw", "ls")
-	out, err := cmd.Output()
+func init() {
+	Register(Provider{
+		Name:    "cloudflare",
+		Options: []Option{{Name: "env", Type: OptionList}},
+		New: func(o Options) (DNS, error) {
+			return Cloudflare{Env: o.Strings("env")}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return Cloudflare{}, nil
+		},
+	})
+}
+
+func (c Cloudflare) GetListOfDomains() ([]string, error) {
+	out, err := runEnv(c.Env, "cloudflare", "--raw", "ls")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	var result []struct {
 		Name string `json:"name"`
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	domains := []string{}
 	for _, d := range result {
 		domains = append(domains, d.Name)
 	}
-	return domains
+	return domains, nil
 }
 
-func (_ Cloudflare) GetRecords(domain string) (records []Record) {
-	cmd := exec.Command("cloudflare", "--raw", "records", domain)
-	out, err := cmd.Output()
+func (c Cloudflare) GetRecords(domain string) (records []Record, err error) {
+	out, err := runEnv(c.Env, "cloudflare", "--raw", "records", domain)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	var result []struct {
 		Id      string `json:"id"`
@@ -48,7 +62,7 @@ func (_ Cloudflare) GetRecords(domain string) (records []Record) {
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	for _, d := range result {
 		name := strings.TrimSuffix(strings.TrimSuffix(d.Name, domain), ".")
@@ -66,11 +80,10 @@ func (_ Cloudflare) GetRecords(domain string) (records []Record) {
 	return
 }
 
-func (_ Cloudflare) GetRecordIdsFor(domain, dname, dtype string) []string {
-	cmd := exec.Command("cloudflare", "--raw", "records", domain)
-	out, err := cmd.Output()
+func (c Cloudflare) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	out, err := runEnv(c.Env, "cloudflare", "--raw", "records", domain)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	var result []struct {
 		Id   string `json:"id"`
@@ -79,7 +92,7 @@ func (_ Cloudflare) GetRecordIdsFor(domain, dname, dtype string) []string {
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	ids := []string{}
 	for _, d := range result {
@@ -88,14 +101,13 @@ func (_ Cloudflare) GetRecordIdsFor(domain, dname, dtype string) []string {
 			ids = append(ids, d.Id)
 		}
 	}
-	return ids
+	return ids, nil
 }
 
-func (_ Cloudflare) AddNewRecord(domain, dname, dtype, dvalue string) string {
-	cmd := exec.Command("cloudflare", "--raw", "addrecord", domain, dname, dtype, dvalue)
-	out, err := cmd.Output()
+func (c Cloudflare) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	out, err := runEnv(c.Env, "cloudflare", "--raw", "addrecord", domain, dname, dtype, dvalue)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	var result struct {
 		Result struct {
@@ -104,15 +116,12 @@ func (_ Cloudflare) AddNewRecord(domain, dname, dtype, dvalue string) string {
 	}
 	err = json.Unmarshal(out, &result)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	return result.Result.Id
+	return result.Result.Id, nil
 }
 
-func (_ Cloudflare) DeleteRecord(domain, id string) {
-	cmd := exec.Command("cloudflare", "delrecord", domain, id)
-	_, err := cmd.Output()
-	if err != nil {
-		log.Fatal(err)
-	}
+func (c Cloudflare) DeleteRecord(domain, id string) error {
+	_, err := runEnv(c.Env, "cloudflare", "delrecord", domain, id)
+	return err
 }
@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxCNAMEs is the most CNAME records to follow, to stop at loops.
+const maxCNAMEs = 8
+
+// LookupCNAME follows the CNAME records of name with the recursive resolver
+// server (host or host:port, the first nameserver in /etc/resolv.conf if
+// empty) and returns the name at the end of the chain, without trailing dot.
+// It returns name itself if it has no CNAME record, or doesn't exist.
+func LookupCNAME(name, server string) (string, error) {
+	if server == "" {
+		server = systemNameserver()
+	}
+	// the queries are sent over TCP like the ones of RFC2136
+	r := &RFC2136{Nameserver: server, Timeout: 10 * time.Second}
+	name = strings.TrimSuffix(name, ".")
+	for i := 0; i < maxCNAMEs; i++ {
+		m := &message{
+			flags:    1 << 8, // recursion desired
+			question: []question{{fqdn(name), typeCNAME, classIN}},
+		}
+		target := ""
+		err := r.exchange(m, func(msg []byte, resp *message) (bool, error) {
+			if resp.rcode() != 0 && resp.rcode() != rcodeNXDomain {
+				return false, errors.New("lookup CNAME of " + name + ": " + rcodeError(resp).Error())
+			}
+			for _, rr := range resp.answer {
+				if rr.rtype == typeCNAME && strings.EqualFold(rr.name, fqdn(name)) {
+					target = unpackData(msg, rr)
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if target == "" {
+			return name, nil
+		}
+		name = target
+	}
+	return "", errors.New("lookup CNAME: too many CNAME records at " + name)
+}
+
+// systemNameserver returns the first nameserver in /etc/resolv.conf, or the
+// local one.
+func systemNameserver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return "127.0.0.1"
+}
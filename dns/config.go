@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Flags are the -dns and -dns-config flags of a command, which choose the
+// providers or accounts to use.
+type Flags struct {
+	// Types is -dns, a comma-separated list of providers or accounts
+	Types string
+	// Config is -dns-config, a TOML or YAML file of accounts
+	Config string
+
+	fs *flag.FlagSet
+}
+
+// AddFlags adds -dns, with defaultTypes as its default, and -dns-config to
+// fs.
+func AddFlags(fs *flag.FlagSet, defaultTypes string) *Flags {
+	f := &Flags{fs: fs}
+	fs.StringVar(&f.Types, "dns", defaultTypes, "can be "+strings.Join(Providers(), ", ")+", an account of -dns-config, or a comma-separated list of them, all accounts of -dns-config are used if it is not set")
+	fs.StringVar(&f.Config, "dns-config", "", "TOML or YAML file of named accounts of DNS providers")
+	return f
+}
+
+// Accounts returns the accounts of -dns-config and the names of -dns, which
+// are the names of all the accounts if -dns is not set. It must be called
+// after the flags are parsed.
+func (f *Flags) Accounts() (Accounts, []string, error) {
+	var accounts Accounts
+	types := f.Types
+	if f.Config != "" {
+		var err error
+		if accounts, err = ReadAccounts(f.Config); err != nil {
+			return nil, nil, err
+		}
+		set := false
+		f.fs.Visit(func(fl *flag.Flag) {
+			set = set || fl.Name == "dns"
+		})
+		if !set {
+			types = strings.Join(accounts.Names(), ",")
+		}
+	}
+	var names []string
+	for _, name := range strings.Split(types, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return accounts, names, nil
+}
+
+// ReadAccounts reads the accounts of a TOML or YAML file, which are in its
+// "accounts" table.
+func ReadAccounts(file string) (Accounts, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Accounts Accounts `toml:"accounts" yaml:"accounts"`
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".toml":
+		err = toml.Unmarshal(content, &config)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, &config)
+	default:
+		return nil, errors.New(file + ": DNS config must be a .toml, .yaml or .yml file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(config.Accounts) == 0 {
+		return nil, errors.New(file + ": no accounts")
+	}
+	return config.Accounts, nil
+}
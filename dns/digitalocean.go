@@ -0,0 +1,188 @@
+package dns
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+type (
+	// DigitalOcean uses the API of DigitalOcean Domains.
+	DigitalOcean struct {
+		Token string
+		// Endpoint is https://api.digitalocean.com/v2 by default
+		Endpoint string
+		TTL      int
+		Client   *http.Client
+	}
+
+	digitalOceanRecord struct {
+		Id   int64  `json:"id"`
+		Type string `json:"type"`
+		Name string `json:"name"`
+		Data string `json:"data"`
+	}
+
+	digitalOceanLinks struct {
+		Pages struct {
+			Next string `json:"next"`
+		} `json:"pages"`
+	}
+)
+
+var _ DNS = (*DigitalOcean)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "digitalocean",
+		Options: []Option{
+			{Name: "token", Type: OptionString, Required: true},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &DigitalOcean{
+				Token:    o.String("token"),
+				Endpoint: o.String("endpoint"),
+				TTL:      o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewDigitalOceanFromEnv()
+		},
+	})
+}
+
+// NewDigitalOceanFromEnv returns a DigitalOcean configured by the environment
+// variable DIGITALOCEAN_TOKEN.
+func NewDigitalOceanFromEnv() (*DigitalOcean, error) {
+	d := &DigitalOcean{Token: os.Getenv("DIGITALOCEAN_TOKEN")}
+	if d.Token == "" {
+		return nil, errors.New("digitalocean: please set DIGITALOCEAN_TOKEN")
+	}
+	return d, nil
+}
+
+func (d *DigitalOcean) api() restAPI {
+	endpoint := d.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.digitalocean.com/v2"
+	}
+	return restAPI{
+		name:      "digitalocean",
+		endpoint:  endpoint,
+		header:    http.Header{"Authorization": {"Bearer " + d.Token}},
+		client:    d.Client,
+		pageParam: "page",
+		sizeParam: "per_page",
+		pageSize:  200,
+	}
+}
+
+func (d *DigitalOcean) GetListOfDomains() ([]string, error) {
+	domains := []string{}
+	var result struct {
+		Domains []struct {
+			Name string `json:"name"`
+		} `json:"domains"`
+		Links digitalOceanLinks `json:"links"`
+	}
+	err := d.api().list("/domains", nil, func() interface{} {
+		result.Domains, result.Links = nil, digitalOceanLinks{}
+		return &result
+	}, func(int) bool {
+		for _, domain := range result.Domains {
+			domains = append(domains, domain.Name)
+		}
+		return result.Links.Pages.Next != ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// getRecords returns the records of the domain, query filters them.
+func (d *DigitalOcean) getRecords(domain string, query url.Values) ([]digitalOceanRecord, error) {
+	var records []digitalOceanRecord
+	var result struct {
+		DomainRecords []digitalOceanRecord `json:"domain_records"`
+		Links         digitalOceanLinks    `json:"links"`
+	}
+	path := "/domains/" + url.PathEscape(domain) + "/records"
+	err := d.api().list(path, query, func() interface{} {
+		result.DomainRecords, result.Links = nil, digitalOceanLinks{}
+		return &result
+	}, func(int) bool {
+		records = append(records, result.DomainRecords...)
+		return result.Links.Pages.Next != ""
+	})
+	return records, err
+}
+
+func (d *DigitalOcean) GetRecords(domain string) (records []Record, err error) {
+	list, err := d.getRecords(domain, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		fullName := domain
+		if r.Name != "@" {
+			fullName = r.Name + "." + fullName
+		}
+		records = append(records, Record{
+			Id:       strconv.FormatInt(r.Id, 10),
+			Type:     r.Type,
+			Name:     r.Name,
+			FullName: fullName,
+			Content:  r.Data,
+		})
+	}
+	return
+}
+
+func (d *DigitalOcean) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	name := domain
+	if dname != "@" {
+		name = dname + "." + domain
+	}
+	list, err := d.getRecords(domain, url.Values{"name": {name}, "type": {dtype}})
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range list {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, strconv.FormatInt(r.Id, 10))
+		}
+	}
+	return ids, nil
+}
+
+func (d *DigitalOcean) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	ttl := d.TTL
+	if ttl == 0 {
+		ttl = 60
+	}
+	body := map[string]interface{}{
+		"type": dtype,
+		"name": dname,
+		"data": dvalue,
+		"ttl":  ttl,
+	}
+	var result struct {
+		DomainRecord digitalOceanRecord `json:"domain_record"`
+	}
+	path := "/domains/" + url.PathEscape(domain) + "/records"
+	if err := d.api().do("POST", path, nil, body, &result); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(result.DomainRecord.Id, 10), nil
+}
+
+func (d *DigitalOcean) DeleteRecord(domain, id string) error {
+	path := "/domains/" + url.PathEscape(domain) + "/records/" + url.PathEscape(id)
+	return d.api().do("DELETE", path, nil, nil, nil)
+}
@@ -1,12 +1,21 @@
 package dns
 
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
 type (
 	DNS interface {
-		GetListOfDomains() []string
-		GetRecords(domain string) []Record
-		GetRecordIdsFor(domain, dname, dtype string) []string
-		AddNewRecord(domain, dname, dtype, dvalue string) string
-		DeleteRecord(domain, id string)
+		GetListOfDomains() ([]string, error)
+		GetRecords(domain string) ([]Record, error)
+		GetRecordIdsFor(domain, dname, dtype string) ([]string, error)
+		AddNewRecord(domain, dname, dtype, dvalue string) (string, error)
+		DeleteRecord(domain, id string) error
 	}
 
 	Record struct {
@@ -17,3 +26,85 @@ type (
 		Content  string
 	}
 )
+
+// run runs a command and returns its output, the error contains the command's
+// stderr if it fails.
+func run(name string, args ...string) ([]byte, error) {
+	return runEnv(nil, name, args...)
+}
+
+// runEnv runs a command like run, with the environment variables env (like
+// KEY=VALUE) in addition to ours.
+func runEnv(env []string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(string(out))
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, errors.New(name + " " + args[0] + ": " + msg)
+	}
+	return out, nil
+}
+
+// recordId returns the ID of a record for providers without record IDs, its
+// name, type and quoted content.
+func recordId(name, dtype, content string) string {
+	return name + " " + dtype + " " + strconv.Quote(content)
+}
+
+func parseRecordId(id string) (name, dtype, content string, err error) {
+	parts := strings.SplitN(id, " ", 3)
+	if len(parts) == 3 {
+		content, err = strconv.Unquote(parts[2])
+		if err == nil {
+			return parts[0], parts[1], content, nil
+		}
+	}
+	return "", "", "", errors.New("bad record id " + id)
+}
+
+// unquoteTXT returns the content of a record in the presentation format as
+// it is in the other providers, TXT records without quotes. Content without
+// quotes is returned as it is.
+func unquoteTXT(dtype, content string) string {
+	if dtype != "TXT" || !strings.HasPrefix(strings.TrimSpace(content), `"`) {
+		return content
+	}
+	var s strings.Builder
+	for content = strings.TrimSpace(content); strings.HasPrefix(content, `"`); {
+		end := 1
+		for ; end < len(content) && content[end] != '"'; end++ {
+			if content[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(content) {
+			break
+		}
+		if unquoted, err := strconv.Unquote(content[:end+1]); err == nil {
+			s.WriteString(unquoted)
+		} else {
+			s.WriteString(content[1:end])
+		}
+		content = strings.TrimSpace(content[end+1:])
+	}
+	return s.String()
+}
+
+// quoteTXT returns the content of a record in the presentation format.
+func quoteTXT(dtype, content string) string {
+	if dtype != "TXT" {
+		return content
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(content) + `"`
+}
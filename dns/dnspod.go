@@ -0,0 +1,298 @@
+package dns
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// DNSPod uses the DNSPod API of Tencent Cloud, signed with
+	// TC3-HMAC-SHA256.
+	DNSPod struct {
+		SecretId  string
+		SecretKey string
+		// Endpoint is https://dnspod.tencentcloudapi.com by default
+		Endpoint string
+		TTL      int
+		Client   *http.Client
+	}
+
+	dnspodRecord struct {
+		RecordId uint64
+		Name     string
+		Type     string
+		Value    string
+	}
+)
+
+const (
+	dnspodService = "dnspod"
+	dnspodVersion = "2021-03-23"
+	// dnspodPageSize is the most items of a page the API returns
+	dnspodPageSize = 3000
+)
+
+var _ DNS = (*DNSPod)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "dnspod",
+		Options: []Option{
+			{Name: "secret_id", Type: OptionString, Required: true},
+			{Name: "secret_key", Type: OptionString, Required: true},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &DNSPod{
+				SecretId:  o.String("secret_id"),
+				SecretKey: o.String("secret_key"),
+				Endpoint:  o.String("endpoint"),
+				TTL:       o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewDNSPodFromEnv()
+		},
+	})
+}
+
+// NewDNSPodFromEnv returns a DNSPod configured by the environment variables
+// TENCENTCLOUD_SECRET_ID and TENCENTCLOUD_SECRET_KEY.
+func NewDNSPodFromEnv() (*DNSPod, error) {
+	d := &DNSPod{
+		SecretId:  os.Getenv("TENCENTCLOUD_SECRET_ID"),
+		SecretKey: os.Getenv("TENCENTCLOUD_SECRET_KEY"),
+	}
+	if d.SecretId == "" || d.SecretKey == "" {
+		return nil, errors.New("dnspod: please set TENCENTCLOUD_SECRET_ID and TENCENTCLOUD_SECRET_KEY")
+	}
+	return d, nil
+}
+
+// sign signs a request with TC3-HMAC-SHA256.
+func (d *DNSPod) sign(req *http.Request, body []byte) error {
+	return signTC3(req, body, d.SecretId, d.SecretKey, dnspodService, time.Now())
+}
+
+// signTC3 signs a request to service with TC3-HMAC-SHA256 at t. The content
+// type and the host are signed, with their values in lowercase.
+func signTC3(req *http.Request, body []byte, secretId, secretKey, service string, t time.Time) error {
+	t = t.UTC()
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	date := t.Format("2006-01-02")
+	req.Header.Set("X-TC-Timestamp", timestamp)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		"content-type:" + strings.ToLower(req.Header.Get("Content-Type")) + "\n" +
+			"host:" + strings.ToLower(req.URL.Host) + "\n",
+		"content-type;host",
+		sha256Hex(body),
+	}, "\n")
+	scope := date + "/" + service + "/tc3_request"
+	stringToSign := strings.Join([]string{
+		"TC3-HMAC-SHA256",
+		timestamp,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("TC3"+secretKey), date)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "TC3-HMAC-SHA256 Credential="+secretId+"/"+scope+
+		", SignedHeaders=content-type;host, Signature="+signature)
+	return nil
+}
+
+// call calls an action of the API, result is decoded from the Response of
+// the response.
+func (d *DNSPod) call(action string, params map[string]interface{}, result interface{}) error {
+	endpoint := d.Endpoint
+	if endpoint == "" {
+		endpoint = "https://dnspod.tencentcloudapi.com"
+	}
+	var response struct {
+		Response json.RawMessage
+	}
+	err := doJSON(d.Client, request{
+		method: "POST",
+		url:    endpoint,
+		header: http.Header{
+			"Content-Type": {"application/json; charset=utf-8"},
+			"X-Tc-Action":  {action},
+			"X-Tc-Version": {dnspodVersion},
+		},
+		body: params,
+		sign: d.sign,
+	}, &response)
+	if err != nil {
+		return errors.New("dnspod: " + err.Error())
+	}
+	var e struct {
+		Error *struct {
+			Code    string
+			Message string
+		}
+	}
+	if err := json.Unmarshal(response.Response, &e); err != nil {
+		return errors.New("dnspod: " + action + ": " + err.Error())
+	}
+	if e.Error != nil {
+		return &dnspodError{action, e.Error.Code, e.Error.Message}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Response, result); err != nil {
+		return errors.New("dnspod: " + action + ": " + err.Error())
+	}
+	return nil
+}
+
+// dnspodError is an error of the API.
+type dnspodError struct {
+	Action, Code, Message string
+}
+
+func (e *dnspodError) Error() string {
+	return "dnspod: " + e.Action + ": " + e.Code + ": " + e.Message
+}
+
+func (d *DNSPod) GetListOfDomains() ([]string, error) {
+	domains := []string{}
+	for offset := 0; ; offset = len(domains) {
+		var result struct {
+			DomainCountInfo struct {
+				AllTotal int
+			}
+			DomainList []struct {
+				Name string
+			}
+		}
+		err := d.call("DescribeDomainList", map[string]interface{}{
+			"Offset": offset,
+			"Limit":  dnspodPageSize,
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, domain := range result.DomainList {
+			domains = append(domains, domain.Name)
+		}
+		if len(result.DomainList) == 0 || len(domains) >= result.DomainCountInfo.AllTotal {
+			return domains, nil
+		}
+	}
+}
+
+// getRecords returns the records of the domain, params filters them.
+func (d *DNSPod) getRecords(domain string, params map[string]interface{}) ([]dnspodRecord, error) {
+	var records []dnspodRecord
+	for offset := 0; ; offset = len(records) {
+		var result struct {
+			RecordCountInfo struct {
+				TotalCount int
+			}
+			RecordList []dnspodRecord
+		}
+		p := map[string]interface{}{
+			"Domain": domain,
+			"Offset": offset,
+			"Limit":  dnspodPageSize,
+		}
+		for key, value := range params {
+			p[key] = value
+		}
+		err := d.call("DescribeRecordList", p, &result)
+		var e *dnspodError
+		if errors.As(err, &e) && e.Code == "ResourceNotFound.NoDataOfRecord" {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, result.RecordList...)
+		if len(result.RecordList) == 0 || len(records) >= result.RecordCountInfo.TotalCount {
+			return records, nil
+		}
+	}
+}
+
+func (d *DNSPod) GetRecords(domain string) (records []Record, err error) {
+	list, err := d.getRecords(domain, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		fullName := domain
+		if r.Name != "@" {
+			fullName = r.Name + "." + fullName
+		}
+		records = append(records, Record{
+			Id:       strconv.FormatUint(r.RecordId, 10),
+			Type:     r.Type,
+			Name:     r.Name,
+			FullName: fullName,
+			Content:  r.Value,
+		})
+	}
+	return
+}
+
+func (d *DNSPod) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	list, err := d.getRecords(domain, map[string]interface{}{
+		"Subdomain":  dname,
+		"RecordType": dtype,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range list {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, strconv.FormatUint(r.RecordId, 10))
+		}
+	}
+	return ids, nil
+}
+
+func (d *DNSPod) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	params := map[string]interface{}{
+		"Domain":     domain,
+		"SubDomain":  dname,
+		"RecordType": dtype,
+		"RecordLine": "默认",
+		"Value":      dvalue,
+	}
+	if d.TTL > 0 {
+		params["TTL"] = d.TTL
+	}
+	var result struct {
+		RecordId uint64
+	}
+	if err := d.call("CreateRecord", params, &result); err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(result.RecordId, 10), nil
+}
+
+func (d *DNSPod) DeleteRecord(domain, id string) error {
+	recordId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return errors.New("dnspod: bad record id " + id)
+	}
+	return d.call("DeleteRecord", map[string]interface{}{
+		"Domain":   domain,
+		"RecordId": recordId,
+	}, nil)
+}
@@ -0,0 +1,33 @@
+package dns
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignTC3 checks the signature of the example in the documentation of
+// Tencent Cloud API signature v3, whose keys are masked with asterisks and
+// whose body has the instance name in \u escapes.
+func TestSignTC3(t *testing.T) {
+	body := `{"Limit": 1, "Filters": [{"Values": ["\u672a\u547d\u540d"], "Name": "instance-name"}]}`
+	req, err := http.NewRequest("POST", "https://cvm.tencentcloudapi.com/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	err = signTC3(req, []byte(body), "AKIDz8krbsJ5yKBZQpn74WFkmLPx3*******", "Gu5t9xGARNpq86cd98joQYCN3*******",
+		"cvm", time.Unix(1551113065, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-TC-Timestamp"); got != "1551113065" {
+		t.Errorf("X-TC-Timestamp is %s", got)
+	}
+	want := "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3*******/2019-02-25/cvm/tc3_request, " +
+		"SignedHeaders=content-type;host, Signature=2230eefd229f582d8b1b891af7107b91597240707d778ab3738f756258d7652c"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization is\n%s\nwant\n%s", got, want)
+	}
+}
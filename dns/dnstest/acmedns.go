@@ -0,0 +1,117 @@
+package dnstest
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/caiguanhao/certutils/dns"
+)
+
+// acmeDNS serves the API of acme-dns, whose accounts are subdomains of the
+// first zone with the two latest TXT records updated.
+func (s *Server) acmeDNS(w http.ResponseWriter, r *http.Request) {
+	type object = map[string]interface{}
+	if _, ok := route(r, "POST", "/register"); ok {
+		account := acmeAccount{
+			password:  randomString(20, hex.EncodeToString),
+			subdomain: randomString(16, hex.EncodeToString),
+		}
+		username := randomString(16, hex.EncodeToString)
+		if s.accounts == nil {
+			s.accounts = map[string]acmeAccount{}
+		}
+		s.accounts[username] = account
+		writeJSON(w, 201, object{"username": username, "password": account.password,
+			"fulldomain": account.subdomain + "." + s.zones[0], "subdomain": account.subdomain, "allowfrom": []string{}})
+	} else if _, ok := route(r, "POST", "/update"); ok {
+		var body struct {
+			Subdomain string `json:"subdomain"`
+			TXT       string `json:"txt"`
+		}
+		account, ok := s.accounts[r.Header.Get("X-Api-User")]
+		if !ok || account.password != r.Header.Get("X-Api-Key") {
+			writeJSON(w, 401, object{"error": "forbidden"})
+			return
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil || body.Subdomain != account.subdomain {
+			writeJSON(w, 401, object{"error": "forbidden"})
+			return
+		}
+		// the value is the base64 of a SHA-256 digest
+		if len(body.TXT) != 43 {
+			writeJSON(w, 400, object{"error": "bad_txt"})
+			return
+		}
+		var values []string
+		for _, rec := range s.find(s.zones[0], account.subdomain, "TXT") {
+			values = append(values, rec.value)
+		}
+		if len(values) > 1 {
+			values = values[len(values)-1:]
+		}
+		s.change("UPDATE", s.zones[0], account.subdomain, "TXT", append(values, body.TXT), 1)
+		writeJSON(w, 200, object{"txt": body.TXT})
+	} else {
+		notFound(w)
+	}
+}
+
+// checkAcmeDNS checks the acmedns provider, which can't list or delete
+// records, by registering an account for example.net and updating its
+// records.
+func checkAcmeDNS(s *Server, d dns.DNS) error {
+	a := d.(*dns.AcmeDNS)
+	account, err := a.Register("*.example.net")
+	if err != nil {
+		return fmt.Errorf("Register: %w", err)
+	}
+	if a.Account("example.net") != account {
+		return errors.New("Register: no account of example.net")
+	}
+	content, err := ioutil.ReadFile(a.Storage)
+	if err != nil {
+		return fmt.Errorf("Register: %w", err)
+	}
+	var saved map[string]*dns.AcmeDNSAccount
+	if err := json.Unmarshal(content, &saved); err != nil || !reflect.DeepEqual(saved, a.Accounts) {
+		return fmt.Errorf("Register: saved %s (%v)", content, err)
+	}
+
+	i := strings.Index(account.FullDomain, ".")
+	zone := account.FullDomain[i+1:]
+	domains, err := d.GetListOfDomains()
+	if err != nil {
+		return fmt.Errorf("GetListOfDomains: %w", err)
+	}
+	if len(domains) != 1 || domains[0] != zone {
+		return fmt.Errorf("GetListOfDomains: got %v, want %s", domains, zone)
+	}
+	var values []string
+	for i := 0; i < 3; i++ {
+		value := randomString(32, base64.RawURLEncoding.EncodeToString)
+		if _, err := d.AddNewRecord(zone, account.SubDomain, "TXT", value); err != nil {
+			return fmt.Errorf("AddNewRecord: %w", err)
+		}
+		if values = append(values, value); len(values) > 2 {
+			values = values[1:]
+		}
+		if got := s.Values(zone, account.SubDomain, "TXT"); !reflect.DeepEqual(got, values) {
+			return fmt.Errorf("AddNewRecord: values are %q, want %q", got, values)
+		}
+	}
+	if _, err := d.AddNewRecord(zone, "other", "TXT", values[0]); err == nil {
+		return errors.New("AddNewRecord: added a record without an account")
+	}
+	ids, err := d.GetRecordIdsFor(zone, account.SubDomain, "TXT")
+	if err != nil || len(ids) != 0 {
+		return fmt.Errorf("GetRecordIdsFor: got %q (%v), want none", ids, err)
+	}
+	return nil
+}
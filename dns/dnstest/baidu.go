@@ -0,0 +1,118 @@
+package dnstest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// verifyBaidu checks the BCE auth v1 signature of Baidu AI Cloud.
+func (s *Server) verifyBaidu(r *http.Request, body []byte) error {
+	parts := strings.Split(r.Header.Get("Authorization"), "/")
+	if len(parts) != 6 || parts[0] != "bce-auth-v1" {
+		return errors.New("bad authorization")
+	}
+	if parts[1] != accessKey {
+		return errors.New("bad access key " + parts[1])
+	}
+	if parts[2] != r.Header.Get("X-Bce-Date") {
+		return errors.New("timestamp is not x-bce-date")
+	}
+	if err := checkTime("2006-01-02T15:04:05Z", parts[2]); err != nil {
+		return err
+	}
+	names, err := signedNames(parts[4], "host", "x-bce-date")
+	if err != nil {
+		return err
+	}
+	var headers []string
+	for _, name := range names {
+		headers = append(headers, escape(name, false)+":"+escape(headerValue(r, name), false))
+	}
+	sort.Strings(headers)
+	signingKey := hex.EncodeToString(hmacSum([]byte(s.Token), strings.Join(parts[:4], "/")))
+	canonical := r.Method + "\n" + escape(r.URL.Path, true) + "\n" +
+		sortedQuery(r.URL.Query(), "authorization") + "\n" + strings.Join(headers, "\n")
+	return equalHex(parts[5], hmacSum([]byte(signingKey), canonical))
+}
+
+// baidu serves the DNS API of Baidu AI Cloud, whose lists are paged by
+// markers, the ID of the first item of the next page here.
+func (s *Server) baidu(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.signed(w, r, s.verifyBaidu); !ok {
+		return
+	}
+	type object = map[string]interface{}
+	// page returns the items from the marker, no more than maxKeys or
+	// PageSize, and the marker of the next page
+	page := func(ids []string) (start, end int, next string) {
+		if marker := r.URL.Query().Get("marker"); marker != "" {
+			for start = 0; start < len(ids) && ids[start] != marker; start++ {
+			}
+		}
+		size, _ := strconv.Atoi(r.URL.Query().Get("maxKeys"))
+		if size < 1 || size > s.PageSize {
+			size = s.PageSize
+		}
+		end = start + size
+		if end >= len(ids) {
+			return start, len(ids), ""
+		}
+		return start, end, ids[end]
+	}
+	list := func(key string, items []object, ids []string) {
+		start, end, next := page(ids)
+		writeJSON(w, 200, object{key: items[start:end], "isTruncated": next != "", "nextMarker": next})
+	}
+	// changed checks the client token which makes a change idempotent
+	changed := func() bool {
+		if r.URL.Query().Get("clientToken") == "" {
+			writeJSON(w, 400, object{"code": "InvalidParameter", "message": "no clientToken"})
+			return false
+		}
+		return true
+	}
+	if _, ok := route(r, "GET", "/v1/dns/zone"); ok {
+		var zones []object
+		for _, z := range s.zones {
+			zones = append(zones, object{"id": z, "name": z})
+		}
+		list("zones", zones, s.zones)
+	} else if parts, ok := route(r, "GET", "/v1/dns/zone/*/record"); ok && s.hasZone(parts[3]) {
+		var records []object
+		var ids []string
+		for _, rec := range s.find(parts[3], r.URL.Query().Get("rr"), "") {
+			records = append(records, object{"id": rec.id, "rr": rec.name, "type": rec.dtype, "value": rec.value, "ttl": rec.ttl})
+			ids = append(ids, rec.id)
+		}
+		list("records", records, ids)
+	} else if parts, ok := route(r, "POST", "/v1/dns/zone/*/record"); ok && s.hasZone(parts[3]) {
+		var body struct {
+			Rr    string `json:"rr"`
+			Type  string `json:"type"`
+			Value string `json:"value"`
+			TTL   int    `json:"ttl"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil || body.Rr == "" || body.TTL < 1 {
+			writeJSON(w, 400, object{"code": "InvalidParameter", "message": "bad record"})
+			return
+		}
+		if changed() {
+			s.add(parts[3], body.Rr, body.Type, body.Value, body.TTL)
+			w.WriteHeader(http.StatusOK)
+		}
+	} else if parts, ok := route(r, "DELETE", "/v1/dns/zone/*/record/*"); ok && s.hasZone(parts[3]) {
+		if !changed() {
+			return
+		}
+		if s.remove(func(rec record) bool { return rec.zone == parts[3] && rec.id == parts[5] }) == 0 {
+			notFound(w)
+		}
+	} else {
+		notFound(w)
+	}
+}
@@ -0,0 +1,160 @@
+package dnstest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// verifyDNSPod checks the TC3-HMAC-SHA256 signature of Tencent Cloud.
+func (s *Server) verifyDNSPod(r *http.Request, body []byte) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "TC3-HMAC-SHA256 ") {
+		return errors.New("bad authorization")
+	}
+	params := map[string]string{}
+	for _, param := range strings.Split(strings.TrimPrefix(auth, "TC3-HMAC-SHA256 "), ", ") {
+		if i := strings.Index(param, "="); i > 0 {
+			params[param[:i]] = param[i+1:]
+		}
+	}
+	// the credential is the secret ID and the scope
+	credential := strings.SplitN(params["Credential"], "/", 2)
+	if len(credential) != 2 || credential[0] != accessKey {
+		return errors.New("bad credential " + params["Credential"])
+	}
+	timestamp := r.Header.Get("X-TC-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("bad timestamp " + timestamp)
+	}
+	t := time.Unix(unix, 0).UTC()
+	if err := checkTime(time.RFC3339, t.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	scope := strings.Split(credential[1], "/")
+	if len(scope) != 3 || scope[0] != t.Format("2006-01-02") || scope[1] != "dnspod" || scope[2] != "tc3_request" {
+		return errors.New("bad scope " + credential[1])
+	}
+	names, err := signedNames(params["SignedHeaders"], "content-type", "host")
+	if err != nil {
+		return err
+	}
+	var headers string
+	for _, name := range names {
+		headers += name + ":" + strings.ToLower(headerValue(r, name)) + "\n"
+	}
+	canonical := r.Method + "\n" + r.URL.Path + "\n" + r.URL.RawQuery + "\n" +
+		headers + "\n" + params["SignedHeaders"] + "\n" + sha256Sum(body)
+	key := []byte("TC3" + s.Token)
+	for _, part := range scope {
+		key = hmacSum(key, part)
+	}
+	return equalHex(params["Signature"], hmacSum(key, "TC3-HMAC-SHA256\n"+timestamp+"\n"+credential[1]+"\n"+
+		sha256Sum([]byte(canonical))))
+}
+
+// dnspod serves the DNSPod API of Tencent Cloud, whose actions are posted to
+// the root with the X-TC-Action header. Errors are in the response with the
+// status 200, like the real API, and an empty list of records is the error
+// ResourceNotFound.NoDataOfRecord.
+func (s *Server) dnspod(w http.ResponseWriter, r *http.Request) {
+	type object = map[string]interface{}
+	respond := func(response object) {
+		response["RequestId"] = "dnstest"
+		writeJSON(w, 200, object{"Response": response})
+	}
+	fail := func(code, message string) {
+		respond(object{"Error": object{"Code": code, "Message": message}})
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = s.verifyDNSPod(r, body)
+	}
+	if err != nil {
+		fail("AuthFailure.SignatureFailure", err.Error())
+		return
+	}
+	if r.Method != "POST" || r.URL.Path != "/" || r.Header.Get("X-TC-Version") != "2021-03-23" {
+		fail("InvalidAction", "bad request")
+		return
+	}
+	var params struct {
+		Domain, Subdomain, SubDomain, RecordType, RecordLine, Value string
+		Offset, Limit                                               int
+		RecordId                                                    uint64
+		TTL                                                         *int
+	}
+	if err := json.Unmarshal(body, &params); err != nil {
+		fail("InvalidParameter", err.Error())
+		return
+	}
+	// page returns the range of the items from Offset, no more than Limit or
+	// PageSize
+	page := func(n int) (start, end int) {
+		size := params.Limit
+		if size < 1 || size > s.PageSize {
+			size = s.PageSize
+		}
+		start = params.Offset
+		if start > n {
+			start = n
+		}
+		end = start + size
+		if end > n {
+			end = n
+		}
+		return
+	}
+	action := r.Header.Get("X-TC-Action")
+	if action != "DescribeDomainList" && !s.hasZone(params.Domain) {
+		fail("ResourceNotFound.NoDataOfDomain", "no domain "+params.Domain)
+		return
+	}
+	switch action {
+	case "DescribeDomainList":
+		var domains []object
+		for _, z := range s.zones {
+			domains = append(domains, object{"Name": z})
+		}
+		start, end := page(len(domains))
+		respond(object{"DomainCountInfo": object{"AllTotal": len(domains)}, "DomainList": domains[start:end]})
+	case "DescribeRecordList":
+		var records []object
+		for _, rec := range s.find(params.Domain, params.Subdomain, params.RecordType) {
+			id, _ := strconv.ParseUint(rec.id, 10, 64)
+			records = append(records, object{"RecordId": id, "Name": rec.name, "Type": rec.dtype, "Value": rec.value, "TTL": rec.ttl})
+		}
+		if len(records) == 0 {
+			fail("ResourceNotFound.NoDataOfRecord", "no records")
+			return
+		}
+		start, end := page(len(records))
+		respond(object{"RecordCountInfo": object{"TotalCount": len(records)}, "RecordList": records[start:end]})
+	case "CreateRecord":
+		ttl := 600
+		if params.TTL != nil {
+			ttl = *params.TTL
+		}
+		if params.SubDomain == "" || params.RecordType == "" || params.RecordLine != "默认" || ttl < 1 {
+			fail("InvalidParameter", "bad record")
+			return
+		}
+		rec := s.add(params.Domain, params.SubDomain, params.RecordType, params.Value, ttl)
+		id, _ := strconv.ParseUint(rec.id, 10, 64)
+		respond(object{"RecordId": id})
+	case "DeleteRecord":
+		id := strconv.FormatUint(params.RecordId, 10)
+		if s.remove(func(rec record) bool { return rec.zone == params.Domain && rec.id == id }) == 0 {
+			fail("ResourceNotFound.NoDataOfRecord", "no record "+id)
+			return
+		}
+		respond(object{})
+	default:
+		fail("InvalidAction", "no action "+action)
+	}
+}
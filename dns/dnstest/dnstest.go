@@ -0,0 +1,139 @@
+// Package dnstest checks that the providers of package dns behave the same,
+// against fake API servers or real accounts.
+//
+// A test can run the check against a real zone:
+//
+//	if err := dnstest.Run(provider, "example.com"); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// or against all the fake servers:
+//
+//	if err := dnstest.RunFakes(); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// The fake of exec runs the test binary, whose TestMain must call ExecMain.
+package dnstest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/caiguanhao/certutils/dns"
+)
+
+// Run checks that d lists the zone and adds, finds and deletes TXT records in
+// it as mkcert and chkcert expect. The records are added under a random name
+// and deleted even if the check fails.
+func Run(d dns.DNS, zone string) (err error) {
+	domains, err := d.GetListOfDomains()
+	if err != nil {
+		return fmt.Errorf("GetListOfDomains: %w", err)
+	}
+	if !contains(domains, zone) {
+		return fmt.Errorf("GetListOfDomains: %s is not in %v", zone, domains)
+	}
+
+	name := "_dnstest-" + randomString(4, hex.EncodeToString)
+	fullName := name + "." + zone
+	ids, err := d.GetRecordIdsFor(zone, name, "TXT")
+	if err != nil {
+		return fmt.Errorf("GetRecordIdsFor: %w", err)
+	}
+	if len(ids) != 0 {
+		return fmt.Errorf("GetRecordIdsFor: %s has records %v", fullName, ids)
+	}
+
+	// the values are like the ones of ACME challenges
+	var values, added []string
+	defer func() {
+		for _, id := range added {
+			if e := d.DeleteRecord(zone, id); e != nil && err == nil {
+				err = fmt.Errorf("DeleteRecord %s: %w", id, e)
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		value := randomString(32, base64.RawURLEncoding.EncodeToString)
+		id, err := d.AddNewRecord(zone, name, "TXT", value)
+		if err != nil {
+			return fmt.Errorf("AddNewRecord: %w", err)
+		}
+		if id == "" || contains(added, id) {
+			return fmt.Errorf("AddNewRecord: bad id %q of %s, the ids are %v", id, value, added)
+		}
+		values = append(values, value)
+		added = append(added, id)
+	}
+
+	if err := checkIds(d, zone, name, added); err != nil {
+		return err
+	}
+	records, err := d.GetRecords(zone)
+	if err != nil {
+		return fmt.Errorf("GetRecords: %w", err)
+	}
+	for i, value := range values {
+		found := false
+		for _, r := range records {
+			if r.Id != added[i] {
+				continue
+			}
+			found = true
+			if r.Type != "TXT" || r.Name != name || !strings.EqualFold(r.FullName, fullName) || r.Content != value {
+				return fmt.Errorf("GetRecords: got %+v, want TXT record %s (%s) %s", r, name, fullName, value)
+			}
+		}
+		if !found {
+			return fmt.Errorf("GetRecords: no record %s", added[i])
+		}
+	}
+
+	for len(added) > 0 {
+		id := added[0]
+		if err := d.DeleteRecord(zone, id); err != nil {
+			return fmt.Errorf("DeleteRecord %s: %w", id, err)
+		}
+		added = added[1:]
+		if err := checkIds(d, zone, name, added); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkIds checks that the IDs of the TXT records of name are want.
+func checkIds(d dns.DNS, zone, name string, want []string) error {
+	ids, err := d.GetRecordIdsFor(zone, name, "TXT")
+	if err != nil {
+		return fmt.Errorf("GetRecordIdsFor: %w", err)
+	}
+	got := append([]string{}, ids...)
+	want = append([]string{}, want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		return fmt.Errorf("GetRecordIdsFor: got %q, want %q", got, want)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString(n int, encode func([]byte) string) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return encode(b)
+}
@@ -0,0 +1,17 @@
+package dnstest
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	ExecMain()
+	os.Exit(m.Run())
+}
+
+func TestFakes(t *testing.T) {
+	if err := RunFakes(); err != nil {
+		t.Fatal(err)
+	}
+}
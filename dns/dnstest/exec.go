@@ -0,0 +1,101 @@
+package dnstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// execArg is the argument of the test binary which makes ExecMain relay a
+// request of dns.Exec to the exec fake.
+const execArg = "dnstest-exec"
+
+// ExecMain runs the program of the exec fake if the test binary is run as
+// one, and returns otherwise. The exec fake runs the test binary, so a test
+// of it must call ExecMain in TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		dnstest.ExecMain()
+//		os.Exit(m.Run())
+//	}
+//
+// The program posts its stdin to the fake server and writes the response to
+// stdout.
+func ExecMain() {
+	if len(os.Args) != 4 || os.Args[2] != execArg {
+		return
+	}
+	resp, err := http.Post(os.Args[3], "application/json", os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// execCommand returns the command of the exec fake, the test binary, which
+// runs no tests if it doesn't call ExecMain.
+func (s *Server) execCommand() []string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	return []string{exe, "-test.run=^$", execArg, s.URL}
+}
+
+// exec serves the requests of the program of dns.Exec, whose names are
+// relative to the domain.
+func (s *Server) exec(w http.ResponseWriter, r *http.Request) {
+	type object = map[string]interface{}
+	fail := func(message string) {
+		writeJSON(w, 200, object{"error": message})
+	}
+	var req struct {
+		Version                                 int
+		Action, Domain, Name, Type, Content, Id string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail("bad request: " + err.Error())
+		return
+	}
+	if req.Version != 1 {
+		fail(fmt.Sprintf("bad version %d", req.Version))
+		return
+	}
+	if req.Action != "list-domains" && !s.hasZone(req.Domain) {
+		fail("no domain " + req.Domain)
+		return
+	}
+	switch req.Action {
+	case "list-domains":
+		writeJSON(w, 200, object{"domains": s.zones})
+	case "list-records":
+		records := []object{}
+		for _, rec := range s.find(req.Domain, req.Name, req.Type) {
+			records = append(records, object{"id": rec.id, "type": rec.dtype, "name": rec.name, "content": rec.value})
+		}
+		writeJSON(w, 200, object{"records": records})
+	case "add":
+		if req.Name == "" || req.Type == "" {
+			fail("bad record")
+			return
+		}
+		rec := s.add(req.Domain, req.Name, req.Type, req.Content, 300)
+		writeJSON(w, 200, object{"id": rec.id})
+	case "delete":
+		if s.remove(func(rec record) bool { return rec.zone == req.Domain && rec.id == req.Id }) == 0 {
+			fail("no record " + req.Id)
+			return
+		}
+		writeJSON(w, 200, object{})
+	default:
+		fail("no action " + req.Action)
+	}
+}
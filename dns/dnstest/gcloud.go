@@ -0,0 +1,224 @@
+package dnstest
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// googleClientEmail is the service account of the Google Cloud DNS fake, its
+// key is the key of the server.
+const googleClientEmail = "dnstest@dnstest.iam.gserviceaccount.com"
+
+// verifyJWT checks the JWT which a service account exchanges for an access
+// token, it is signed with RS256 by the key of the server.
+func (s *Server) verifyJWT(assertion string) error {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return errors.New("bad JWT")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("bad JWT signature")
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, hash[:], signature) != nil {
+		return errors.New("JWT signature does not match")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims struct {
+		Iss   string `json:"iss"`
+		Scope string `json:"scope"`
+		Aud   string `json:"aud"`
+		Iat   int64  `json:"iat"`
+		Exp   int64  `json:"exp"`
+	}
+	for i, v := range []interface{}{&header, &claims} {
+		content, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil || json.Unmarshal(content, v) != nil {
+			return errors.New("bad JWT")
+		}
+	}
+	now := time.Now().Unix()
+	switch {
+	case header.Alg != "RS256":
+		return errors.New("JWT is not RS256")
+	case claims.Iss != googleClientEmail:
+		return errors.New("bad issuer " + claims.Iss)
+	case claims.Aud != s.URL+"/token":
+		return errors.New("bad audience " + claims.Aud)
+	case !contains(strings.Fields(claims.Scope), "https://www.googleapis.com/auth/ndev.clouddns.readwrite"):
+		return errors.New("no Cloud DNS scope in " + claims.Scope)
+	case claims.Iat > now+60 || claims.Exp <= now || claims.Exp-claims.Iat > 3600:
+		return errors.New("bad JWT times")
+	}
+	return nil
+}
+
+// googleCloud serves the API of Google Cloud DNS and the token endpoint of
+// Google OAuth 2.0, which gives the token of the server for the JWT of the
+// service account. The name of the managed zone of example.com is
+// example-com.
+func (s *Server) googleCloud(w http.ResponseWriter, r *http.Request) {
+	type (
+		object = map[string]interface{}
+		rrset  struct {
+			Name    string   `json:"name"`
+			Type    string   `json:"type"`
+			TTL     int      `json:"ttl"`
+			RRDatas []string `json:"rrdatas"`
+		}
+	)
+	failed := func(code int, reason, message string) {
+		writeJSON(w, code, object{"error": object{"code": code, "message": message,
+			"errors": []object{{"reason": reason, "message": message}}}})
+	}
+	if _, ok := route(r, "POST", "/token"); ok {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			writeJSON(w, 400, object{"error": "unsupported_grant_type"})
+			return
+		}
+		if err := s.verifyJWT(r.FormValue("assertion")); err != nil {
+			writeJSON(w, 400, object{"error": "invalid_grant", "error_description": err.Error()})
+			return
+		}
+		writeJSON(w, 200, object{"access_token": s.Token, "expires_in": 3599, "token_type": "Bearer"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+s.Token {
+		failed(401, "authError", "Invalid Credentials")
+		return
+	}
+	zone := func(name string) string {
+		for _, z := range s.zones {
+			if strings.Replace(z, ".", "-", -1) == name {
+				return z
+			}
+		}
+		return ""
+	}
+	// page returns the items from the page token, no more than maxResults or
+	// PageSize, and the token of the next page
+	page := func(n int) (start, end int, next string) {
+		start, _ = strconv.Atoi(r.URL.Query().Get("pageToken"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		if size < 1 || size > s.PageSize {
+			size = s.PageSize
+		}
+		if start < 0 || start > n {
+			start = n
+		}
+		if end = start + size; end >= n {
+			return start, n, ""
+		}
+		return start, end, strconv.Itoa(end)
+	}
+	rrsets := func(z string) []rrset {
+		var sets []rrset
+		index := map[string]int{}
+		for _, rec := range s.find(z, "", "") {
+			key := rec.name + " " + rec.dtype
+			value := quoteTXT(rec.dtype, rec.value)
+			if i, ok := index[key]; ok {
+				sets[i].RRDatas = append(sets[i].RRDatas, value)
+				continue
+			}
+			index[key] = len(sets)
+			sets = append(sets, rrset{absoluteName(z, rec.name), rec.dtype, rec.ttl, []string{value}})
+		}
+		return sets
+	}
+	if _, ok := route(r, "GET", "/dns/v1/projects/dnstest/managedZones"); ok {
+		var zones []object
+		for _, z := range s.zones {
+			zones = append(zones, object{"name": strings.Replace(z, ".", "-", -1), "dnsName": z + ".", "visibility": "public"})
+		}
+		start, end, next := page(len(zones))
+		writeJSON(w, 200, object{"managedZones": zones[start:end], "nextPageToken": next})
+	} else if parts, ok := route(r, "GET", "/dns/v1/projects/dnstest/managedZones/*/rrsets"); ok && zone(parts[5]) != "" {
+		name, dtype := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+		if dtype != "" && name == "" {
+			failed(400, "required", "type is given without name")
+			return
+		}
+		var sets []rrset
+		for _, set := range rrsets(zone(parts[5])) {
+			if (name == "" || strings.EqualFold(set.Name, name)) && (dtype == "" || set.Type == dtype) {
+				sets = append(sets, set)
+			}
+		}
+		start, end, next := page(len(sets))
+		writeJSON(w, 200, object{"rrsets": sets[start:end], "nextPageToken": next})
+	} else if parts, ok := route(r, "POST", "/dns/v1/projects/dnstest/managedZones/*/changes"); ok && zone(parts[5]) != "" {
+		z := zone(parts[5])
+		var body struct {
+			Additions []rrset `json:"additions"`
+			Deletions []rrset `json:"deletions"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil || len(body.Additions)+len(body.Deletions) == 0 {
+			failed(400, "invalid", "bad change")
+			return
+		}
+		// a deletion must match the record set exactly, and an addition can
+		// only add a record set which doesn't exist after the deletions
+		deleted := map[string]bool{}
+		for _, set := range body.Deletions {
+			var current []string
+			for _, rec := range s.find(z, relativeName(z, set.Name), set.Type) {
+				if rec.ttl == set.TTL {
+					current = append(current, quoteTXT(rec.dtype, rec.value))
+				}
+			}
+			values := append([]string{}, set.RRDatas...)
+			sort.Strings(current)
+			sort.Strings(values)
+			if len(current) == 0 || strings.Join(current, "\n") != strings.Join(values, "\n") {
+				failed(412, "conditionNotMet", "deletion of "+set.Name+" "+set.Type+" does not match")
+				return
+			}
+			deleted[set.Name+" "+set.Type] = true
+		}
+		for _, set := range body.Additions {
+			name := relativeName(z, set.Name)
+			bad := name == "" || !strings.HasSuffix(set.Name, ".") || set.TTL < 1 || len(set.RRDatas) == 0
+			for _, value := range set.RRDatas {
+				_, quoted := unquoteTXT(set.Type, value)
+				bad = bad || !quoted
+			}
+			if bad {
+				failed(400, "invalid", "bad addition of "+set.Name+" "+set.Type)
+				return
+			}
+			if len(s.find(z, name, set.Type)) > 0 && !deleted[set.Name+" "+set.Type] {
+				failed(409, "alreadyExists", set.Name+" "+set.Type+" exists")
+				return
+			}
+		}
+		for _, set := range body.Deletions {
+			s.change("deletion", z, relativeName(z, set.Name), set.Type, nil, 0)
+		}
+		for _, set := range body.Additions {
+			var values []string
+			for _, value := range set.RRDatas {
+				value, _ = unquoteTXT(set.Type, value)
+				values = append(values, value)
+			}
+			s.change("addition", z, relativeName(z, set.Name), set.Type, values, set.TTL)
+		}
+		writeJSON(w, 200, object{"id": strconv.Itoa(len(s.changes)), "status": "pending"})
+	} else if parts, ok := route(r, "GET", "/dns/v1/projects/dnstest/managedZones/*/changes/*"); ok && zone(parts[5]) != "" {
+		writeJSON(w, 200, object{"id": parts[7], "status": "done"})
+	} else {
+		failed(404, "notFound", "not found")
+	}
+}
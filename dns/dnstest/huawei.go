@@ -0,0 +1,190 @@
+package dnstest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// verifyHuawei checks the SDK-HMAC-SHA256 signature of Huawei Cloud.
+func (s *Server) verifyHuawei(r *http.Request, body []byte) error {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "SDK-HMAC-SHA256 ")
+	params := map[string]string{}
+	for _, param := range strings.Split(auth, ", ") {
+		if i := strings.Index(param, "="); i > 0 {
+			params[param[:i]] = param[i+1:]
+		}
+	}
+	if params["Access"] != accessKey {
+		return errors.New("bad access key " + params["Access"])
+	}
+	date := r.Header.Get("X-Sdk-Date")
+	if err := checkTime("20060102T150405Z", date); err != nil {
+		return err
+	}
+	names, err := signedNames(params["SignedHeaders"], "host", "x-sdk-date")
+	if err != nil {
+		return err
+	}
+	var headers string
+	for _, name := range names {
+		headers += name + ":" + headerValue(r, name) + "\n"
+	}
+	uri := escape(r.URL.Path, true)
+	if !strings.HasSuffix(uri, "/") {
+		uri += "/"
+	}
+	canonical := r.Method + "\n" + uri + "\n" + sortedQuery(r.URL.Query()) + "\n" +
+		headers + "\n" + params["SignedHeaders"] + "\n" + sha256Sum(body)
+	return equalHex(params["Signature"], hmacSum([]byte(s.Token),
+		"SDK-HMAC-SHA256\n"+date+"\n"+sha256Sum([]byte(canonical))))
+}
+
+// huawei serves the DNS API of Huawei Cloud, which has record sets of the
+// values of a name and type. The ID of a zone is its index from 1, the ID of
+// a record set is its name and type in hex.
+func (s *Server) huawei(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.signed(w, r, s.verifyHuawei); !ok {
+		return
+	}
+	type object = map[string]interface{}
+	zone := func(id string) string {
+		i, _ := strconv.Atoi(id)
+		if i < 1 || i > len(s.zones) {
+			return ""
+		}
+		return s.zones[i-1]
+	}
+	// page returns the items from offset, no more than limit or PageSize
+	page := func(n int) (start, end int) {
+		start, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit < 1 || limit > s.PageSize {
+			limit = s.PageSize
+		}
+		if start < 0 || start > n {
+			start = n
+		}
+		end = start + limit
+		if end > n {
+			end = n
+		}
+		return
+	}
+	recordSets := func(z string) []object {
+		var sets []object
+		index := map[string]int{}
+		for _, rec := range s.find(z, "", "") {
+			key := rec.name + " " + rec.dtype
+			if i, ok := index[key]; ok {
+				sets[i]["records"] = append(sets[i]["records"].([]string), quoteTXT(rec.dtype, rec.value))
+				continue
+			}
+			index[key] = len(sets)
+			sets = append(sets, object{"id": hex.EncodeToString([]byte(key)), "name": absoluteName(z, rec.name),
+				"type": rec.dtype, "ttl": rec.ttl, "records": []string{quoteTXT(rec.dtype, rec.value)}})
+		}
+		return sets
+	}
+	// recordSet returns the name and type of a record set ID
+	recordSet := func(z, id string) (string, string) {
+		key, _ := hex.DecodeString(id)
+		parts := strings.SplitN(string(key), " ", 2)
+		if len(parts) != 2 || len(s.find(z, parts[0], parts[1])) == 0 {
+			return "", ""
+		}
+		return parts[0], parts[1]
+	}
+	var body struct {
+		Name    string   `json:"name"`
+		Type    string   `json:"type"`
+		TTL     int      `json:"ttl"`
+		Records []string `json:"records"`
+	}
+	// decode decodes the body and checks the values
+	decode := func(dtype string) bool {
+		if json.NewDecoder(r.Body).Decode(&body) != nil || len(body.Records) == 0 || body.TTL < 1 {
+			return false
+		}
+		if dtype == "" {
+			dtype = body.Type
+		}
+		for _, value := range body.Records {
+			if _, quoted := unquoteTXT(dtype, value); !quoted {
+				return false
+			}
+		}
+		return true
+	}
+	values := func(dtype string) []string {
+		var values []string
+		for _, value := range body.Records {
+			value, _ = unquoteTXT(dtype, value)
+			values = append(values, value)
+		}
+		return values
+	}
+	badRequest := func() {
+		writeJSON(w, 400, object{"code": "DNS.0303", "message": "bad record set"})
+	}
+	if _, ok := route(r, "GET", "/v2/zones"); ok {
+		var zones []object
+		for i, z := range s.zones {
+			zones = append(zones, object{"id": strconv.Itoa(i + 1), "name": z + ".", "zone_type": "public"})
+		}
+		start, end := page(len(zones))
+		writeJSON(w, 200, object{"zones": zones[start:end], "metadata": object{"total_count": len(zones)}})
+	} else if parts, ok := route(r, "GET", "/v2/zones/*/recordsets"); ok && zone(parts[2]) != "" {
+		// the name is matched fuzzily like the API does
+		var sets []object
+		name, dtype := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+		for _, set := range recordSets(zone(parts[2])) {
+			if strings.Contains(set["name"].(string), name) && (dtype == "" || set["type"] == dtype) {
+				sets = append(sets, set)
+			}
+		}
+		start, end := page(len(sets))
+		writeJSON(w, 200, object{"recordsets": sets[start:end], "metadata": object{"total_count": len(sets)}})
+	} else if parts, ok := route(r, "POST", "/v2/zones/*/recordsets"); ok && zone(parts[2]) != "" {
+		z := zone(parts[2])
+		if !decode("") || relativeName(z, body.Name) == "" || !strings.HasSuffix(body.Name, ".") {
+			badRequest()
+			return
+		}
+		name := relativeName(z, body.Name)
+		if len(s.find(z, name, body.Type)) > 0 {
+			writeJSON(w, 400, object{"code": "DNS.0312", "message": "record set exists"})
+			return
+		}
+		s.change("CREATE", z, name, body.Type, values(body.Type), body.TTL)
+		id := hex.EncodeToString([]byte(name + " " + body.Type))
+		writeJSON(w, 202, object{"id": id, "name": body.Name, "type": body.Type})
+	} else if parts, ok := route(r, "PUT", "/v2/zones/*/recordsets/*"); ok && zone(parts[2]) != "" {
+		z := zone(parts[2])
+		name, dtype := recordSet(z, parts[4])
+		if name == "" {
+			notFound(w)
+			return
+		}
+		if !decode(dtype) {
+			badRequest()
+			return
+		}
+		s.change("UPDATE", z, name, dtype, values(dtype), body.TTL)
+		writeJSON(w, 202, object{"id": parts[4], "name": absoluteName(z, name), "type": dtype})
+	} else if parts, ok := route(r, "DELETE", "/v2/zones/*/recordsets/*"); ok && zone(parts[2]) != "" {
+		z := zone(parts[2])
+		name, dtype := recordSet(z, parts[4])
+		if name == "" {
+			notFound(w)
+			return
+		}
+		s.change("DELETE", z, name, dtype, nil, 0)
+		writeJSON(w, 202, object{"id": parts[4], "name": absoluteName(z, name), "type": dtype})
+	} else {
+		notFound(w)
+	}
+}
@@ -0,0 +1,100 @@
+package dnstest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// powerDNS serves the API of PowerDNS Authoritative server, whose zones are
+// named with a dot and changed by replacing or deleting whole record sets.
+func (s *Server) powerDNS(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r, "X-Api-Key", "") {
+		return
+	}
+	type (
+		object = map[string]interface{}
+		rrset  struct {
+			Name       string `json:"name"`
+			Type       string `json:"type"`
+			TTL        int    `json:"ttl"`
+			ChangeType string `json:"changetype"`
+			Records    []struct {
+				Content  string `json:"content"`
+				Disabled bool   `json:"disabled"`
+			} `json:"records"`
+		}
+	)
+	zone := func(id string) string {
+		if z := strings.TrimSuffix(id, "."); id == z+"." && s.hasZone(z) {
+			return z
+		}
+		return ""
+	}
+	if _, ok := route(r, "GET", "/api/v1/servers/localhost/zones"); ok {
+		zones := []object{}
+		for _, z := range s.zones {
+			zones = append(zones, object{"id": z + ".", "name": z + ".", "kind": "Native"})
+		}
+		writeJSON(w, 200, zones)
+	} else if parts, ok := route(r, "GET", "/api/v1/servers/localhost/zones/*"); ok && zone(parts[5]) != "" {
+		z := zone(parts[5])
+		rrsets := []object{}
+		index := map[string]int{}
+		for _, rec := range s.find(z, "", "") {
+			content := object{"content": quoteTXT(rec.dtype, rec.value), "disabled": false}
+			key := rec.name + " " + rec.dtype
+			if i, ok := index[key]; ok {
+				rrsets[i]["records"] = append(rrsets[i]["records"].([]object), content)
+				continue
+			}
+			index[key] = len(rrsets)
+			rrsets = append(rrsets, object{"name": absoluteName(z, rec.name), "type": rec.dtype,
+				"ttl": rec.ttl, "records": []object{content}})
+		}
+		writeJSON(w, 200, object{"id": z + ".", "name": z + ".", "rrsets": rrsets})
+	} else if parts, ok := route(r, "PATCH", "/api/v1/servers/localhost/zones/*"); ok && zone(parts[5]) != "" {
+		z := zone(parts[5])
+		var body struct {
+			RRSets []rrset `json:"rrsets"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil {
+			writeJSON(w, 400, object{"error": "bad body"})
+			return
+		}
+		// the changes are checked before any is made
+		for _, set := range body.RRSets {
+			name := relativeName(z, set.Name)
+			bad := name == "" || !strings.HasSuffix(set.Name, ".")
+			switch set.ChangeType {
+			case "REPLACE":
+				bad = bad || len(set.Records) == 0 || set.TTL < 1
+				for _, rec := range set.Records {
+					_, quoted := unquoteTXT(set.Type, rec.Content)
+					bad = bad || !quoted
+				}
+			case "DELETE":
+				bad = bad || len(set.Records) > 0 && len(s.find(z, name, set.Type)) == 0
+			default:
+				bad = true
+			}
+			if bad {
+				writeJSON(w, 422, object{"error": "bad RRset " + set.Name + " " + set.Type})
+				return
+			}
+		}
+		for _, set := range body.RRSets {
+			var values []string
+			for _, rec := range set.Records {
+				if set.ChangeType == "REPLACE" {
+					value, _ := unquoteTXT(set.Type, rec.Content)
+					values = append(values, value)
+				}
+			}
+			s.change(set.ChangeType, z, relativeName(z, set.Name), set.Type, values, set.TTL)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		notFound(w)
+	}
+}
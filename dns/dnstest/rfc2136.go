@@ -0,0 +1,453 @@
+package dnstest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The rfc2136 fake is a DNS server on TCP and UDP with a DNS message codec
+// of its own, which answers queries, zone transfers (over TCP) and dynamic
+// updates. Transfers and updates must be signed with the TSIG key dnstest.
+// (hmac-sha256), whose secret is the token of the server.
+
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeSOA   = 6
+	dnsTypeTXT   = 16
+	dnsTypeTSIG  = 250
+	dnsTypeAXFR  = 252
+	dnsTypeANY   = 255
+
+	dnsClassIN   = 1
+	dnsClassNONE = 254
+	dnsClassANY  = 255
+
+	dnsNXDomain = 3
+	dnsRefused  = 5
+	dnsNotAuth  = 9
+	dnsNotZone  = 10
+
+	tsigKeyName = "dnstest."
+)
+
+var dnsTypes = map[string]uint16{"A": dnsTypeA, "CNAME": dnsTypeCNAME, "TXT": dnsTypeTXT}
+
+type (
+	dnsRR struct {
+		name         string
+		rtype, class uint16
+		ttl          uint32
+		data         []byte
+		// start is the offset of the record in the message
+		start int
+	}
+
+	dnsMessage struct {
+		id, flags                     uint16
+		qname                         string
+		qtype, qclass                 uint16
+		answer, authority, additional []dnsRR
+	}
+)
+
+// readName reads a name which may be compressed, and returns it in
+// lowercase with a trailing dot.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := 0
+	for hops := 0; hops < 64; {
+		if off >= len(b) {
+			break
+		}
+		n := int(b[off])
+		if n&0xc0 == 0xc0 {
+			if off+2 > len(b) {
+				break
+			}
+			if next == 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			hops++
+			continue
+		}
+		if n == 0 {
+			if next == 0 {
+				next = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")) + ".", next, nil
+		}
+		if off+1+n > len(b) {
+			break
+		}
+		labels = append(labels, string(b[off+1:off+1+n]))
+		off += 1 + n
+	}
+	return "", 0, errors.New("bad name")
+}
+
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label != "" {
+			b = append(append(b, byte(len(label))), label...)
+		}
+	}
+	return append(b, 0)
+}
+
+func appendRR(b []byte, rr dnsRR) []byte {
+	b = appendName(b, rr.name)
+	b = append(b, byte(rr.rtype>>8), byte(rr.rtype), byte(rr.class>>8), byte(rr.class))
+	b = append(b, byte(rr.ttl>>24), byte(rr.ttl>>16), byte(rr.ttl>>8), byte(rr.ttl))
+	b = append(b, byte(len(rr.data)>>8), byte(len(rr.data)))
+	return append(b, rr.data...)
+}
+
+func parseMessage(b []byte) (*dnsMessage, error) {
+	if len(b) < 12 {
+		return nil, errors.New("short message")
+	}
+	m := &dnsMessage{id: binary.BigEndian.Uint16(b), flags: binary.BigEndian.Uint16(b[2:])}
+	if binary.BigEndian.Uint16(b[4:]) != 1 {
+		return nil, errors.New("not one question")
+	}
+	name, off, err := readName(b, 12)
+	if err != nil || off+4 > len(b) {
+		return nil, errors.New("bad question")
+	}
+	m.qname, m.qtype, m.qclass = name, binary.BigEndian.Uint16(b[off:]), binary.BigEndian.Uint16(b[off+2:])
+	off += 4
+	for i, section := range []*[]dnsRR{&m.answer, &m.authority, &m.additional} {
+		for n := binary.BigEndian.Uint16(b[6+2*i:]); n > 0; n-- {
+			rr := dnsRR{start: off}
+			if rr.name, off, err = readName(b, off); err != nil || off+10 > len(b) {
+				return nil, errors.New("bad record")
+			}
+			rr.rtype, rr.class = binary.BigEndian.Uint16(b[off:]), binary.BigEndian.Uint16(b[off+2:])
+			rr.ttl = binary.BigEndian.Uint32(b[off+4:])
+			size := int(binary.BigEndian.Uint16(b[off+8:]))
+			if off += 10; off+size > len(b) {
+				return nil, errors.New("bad record")
+			}
+			rr.data = b[off : off+size]
+			off += size
+			*section = append(*section, rr)
+		}
+	}
+	return m, nil
+}
+
+// tsigVariables returns the TSIG variables of a MAC, only the timers after
+// the first message of a response.
+func tsigVariables(signed uint64, fudge uint16, timersOnly bool) []byte {
+	var b []byte
+	if !timersOnly {
+		b = appendName(b, tsigKeyName)
+		b = append(b, 0, dnsClassANY, 0, 0, 0, 0)
+		b = appendName(b, "hmac-sha256.")
+	}
+	b = append(b, byte(signed>>40), byte(signed>>32), byte(signed>>24), byte(signed>>16), byte(signed>>8), byte(signed))
+	b = append(b, byte(fudge>>8), byte(fudge))
+	if !timersOnly {
+		b = append(b, 0, 0, 0, 0) // error and other length
+	}
+	return b
+}
+
+// verifyTSIG checks the TSIG record of a request and returns its MAC.
+func (s *Server) verifyTSIG(b []byte, m *dnsMessage) ([]byte, error) {
+	tsig := m.additional[len(m.additional)-1]
+	if tsig.name != tsigKeyName {
+		return nil, errors.New("unknown key " + tsig.name)
+	}
+	algorithm, off, err := readName(tsig.data, 0)
+	if err != nil || algorithm != "hmac-sha256." || off+10 > len(tsig.data) {
+		return nil, errors.New("bad TSIG algorithm")
+	}
+	d := tsig.data[off:]
+	signed := uint64(binary.BigEndian.Uint16(d))<<32 | uint64(binary.BigEndian.Uint32(d[2:]))
+	fudge := binary.BigEndian.Uint16(d[6:])
+	size := int(binary.BigEndian.Uint16(d[8:]))
+	if 10+size+6 > len(d) {
+		return nil, errors.New("bad TSIG record")
+	}
+	mac := d[10 : 10+size]
+	// the MAC is of the message without TSIG, with the original ID
+	unsigned := append([]byte{}, b[:tsig.start]...)
+	copy(unsigned, d[10+size:12+size])
+	binary.BigEndian.PutUint16(unsigned[10:], uint16(len(m.additional)-1))
+	h := hmac.New(sha256.New, []byte(s.Token))
+	h.Write(unsigned)
+	h.Write(tsigVariables(signed, fudge, false))
+	if !hmac.Equal(mac, h.Sum(nil)) {
+		return nil, errors.New("bad TSIG signature")
+	}
+	if d := time.Now().Unix() - int64(signed); d > int64(fudge) || -d > int64(fudge) {
+		return nil, errors.New("bad TSIG time")
+	}
+	return mac, nil
+}
+
+// signResponses signs the messages of a response to a request with the MAC
+// requestMAC. The first and the last messages are signed, unless
+// UnsignedLast, and the others are not.
+func (s *Server) signResponses(msgs [][]byte, requestMAC []byte) {
+	prev, unsigned := requestMAC, []byte{}
+	signed := uint64(time.Now().Unix())
+	for i, msg := range msgs {
+		if i > 0 && (i != len(msgs)-1 || s.UnsignedLast) {
+			unsigned = append(unsigned, msg...)
+			continue
+		}
+		h := hmac.New(sha256.New, []byte(s.Token))
+		h.Write([]byte{byte(len(prev) >> 8), byte(len(prev))})
+		h.Write(prev)
+		h.Write(unsigned)
+		h.Write(msg)
+		h.Write(tsigVariables(signed, 300, i > 0))
+		mac := h.Sum(nil)
+		data := appendName(nil, "hmac-sha256.")
+		data = append(data, tsigVariables(signed, 300, true)...)
+		data = append(data, 0, byte(len(mac)))
+		data = append(data, mac...)
+		data = append(data, msg[0], msg[1], 0, 0, 0, 0)
+		msg = appendRR(msg, dnsRR{name: tsigKeyName, rtype: dnsTypeTSIG, class: dnsClassANY, data: data})
+		binary.BigEndian.PutUint16(msg[10:], binary.BigEndian.Uint16(msg[10:])+1)
+		msgs[i] = msg
+		prev, unsigned = mac, nil
+	}
+}
+
+// zoneOf returns the zone of a name and the name relative to it.
+func (s *Server) zoneOf(name string) (zone, relative string) {
+	for _, z := range s.zones {
+		if r := relativeName(z, name); r != "" && len(z) > len(zone) {
+			zone, relative = z, r
+		}
+	}
+	return
+}
+
+// rdata returns the wire form of the value of a record, false if its type
+// is not served.
+func rdata(dtype, value string) ([]byte, bool) {
+	switch dtype {
+	case "A":
+		ip := net.ParseIP(value).To4()
+		return ip, ip != nil
+	case "CNAME":
+		return appendName(nil, value), true
+	case "TXT":
+		var b []byte
+		for ; len(value) > 255; value = value[255:] {
+			b = append(append(b, 255), value[:255]...)
+		}
+		return append(append(b, byte(len(value))), value...), true
+	}
+	return nil, false
+}
+
+// rrs returns the records of the name and type in the zone, all if the
+// name is empty, with the SOA record at the apex.
+func (s *Server) rrs(zone, name string, rtype uint16) []dnsRR {
+	var rrs []dnsRR
+	if (name == "" || name == "@") && (rtype == dnsTypeSOA || rtype == dnsTypeANY) {
+		data := appendName(appendName(nil, "ns."+zone), "hostmaster."+zone)
+		for _, v := range []uint32{uint32(len(s.changes) + 1), 3600, 600, 86400, 60} {
+			data = append(data, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		}
+		rrs = append(rrs, dnsRR{name: zone + ".", rtype: dnsTypeSOA, class: dnsClassIN, ttl: 3600, data: data})
+	}
+	for _, rec := range s.find(zone, name, "") {
+		t := dnsTypes[rec.dtype]
+		if data, ok := rdata(rec.dtype, rec.value); ok && (rtype == dnsTypeANY || rtype == t) {
+			rrs = append(rrs, dnsRR{name: absoluteName(zone, rec.name), rtype: t, class: dnsClassIN, ttl: uint32(rec.ttl), data: data})
+		}
+	}
+	return rrs
+}
+
+// update applies the updates of a message to the zone, and returns the
+// response code.
+func (s *Server) update(zone string, updates []dnsRR) int {
+	for _, rr := range updates {
+		if name, _ := s.zoneOf(rr.name); name != zone {
+			return dnsNotZone
+		}
+	}
+	for _, rr := range updates {
+		_, name := s.zoneOf(rr.name)
+		dtype := ""
+		for t, code := range dnsTypes {
+			if code == rr.rtype {
+				dtype = t
+			}
+		}
+		if dtype == "" && rr.rtype != dnsTypeANY {
+			return dnsRefused
+		}
+		var value string
+		switch dtype {
+		case "A":
+			value = net.IP(rr.data).String()
+		case "CNAME":
+			value, _, _ = readName(rr.data, 0)
+		case "TXT":
+			for d := rr.data; len(d) > 0 && int(d[0]) < len(d); d = d[1+int(d[0]):] {
+				value += string(d[1 : 1+int(d[0])])
+			}
+		}
+		match := func(rec record) bool {
+			return rec.zone == zone && rec.name == name && (rr.rtype == dnsTypeANY || rec.dtype == dtype) &&
+				(rr.class == dnsClassANY || rec.value == value)
+		}
+		action := "DELETE"
+		switch {
+		case rr.class == dnsClassIN && dtype != "":
+			// an existing record is replaced, not added again
+			s.remove(match)
+			s.add(zone, name, dtype, value, int(rr.ttl))
+			action = "ADD"
+		case rr.class == dnsClassNONE, rr.class == dnsClassANY:
+			s.remove(match)
+		default:
+			return dnsRefused
+		}
+		s.changes = append(s.changes, action+" "+absoluteName(zone, name)+" "+dtype+" "+
+			strconv.Itoa(len(s.find(zone, name, dtype))))
+	}
+	return 0
+}
+
+// answer returns the messages of the response to a request, overTCP if it
+// is received over TCP.
+func (s *Server) answer(b []byte, overTCP bool) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := parseMessage(b)
+	if err != nil {
+		return nil
+	}
+	opcode := int(m.flags>>11) & 0xf
+	reply := func(rcode int, answer ...dnsRR) []byte {
+		// QR and AA, with the opcode and RD of the request
+		flags := 0x8400 | m.flags&0x7900 | uint16(rcode)
+		r := []byte{byte(m.id >> 8), byte(m.id), byte(flags >> 8), byte(flags), 0, 1}
+		r = append(r, byte(len(answer)>>8), byte(len(answer)), 0, 0, 0, 0)
+		r = appendName(r, m.qname)
+		r = append(r, byte(m.qtype>>8), byte(m.qtype), byte(m.qclass>>8), byte(m.qclass))
+		for _, rr := range answer {
+			r = appendRR(r, rr)
+		}
+		return r
+	}
+	var mac []byte
+	if n := len(m.additional); n > 0 && m.additional[n-1].rtype == dnsTypeTSIG {
+		if mac, err = s.verifyTSIG(b, m); err != nil {
+			return [][]byte{reply(dnsNotAuth)}
+		}
+	}
+	var msgs [][]byte
+	zone, name := s.zoneOf(m.qname)
+	switch {
+	case zone == "":
+		msgs = [][]byte{reply(dnsNotAuth)}
+	case opcode == 5:
+		if mac == nil || m.qtype != dnsTypeSOA || name != "@" {
+			msgs = [][]byte{reply(dnsRefused)}
+		} else {
+			msgs = [][]byte{reply(s.update(zone, m.authority))}
+		}
+	case opcode != 0:
+		msgs = [][]byte{reply(dnsRefused)}
+	case m.qtype == dnsTypeAXFR:
+		if mac == nil || !overTCP || name != "@" {
+			msgs = [][]byte{reply(dnsRefused)}
+			break
+		}
+		// a message for each record, between the SOA records
+		rrs := s.rrs(zone, "", dnsTypeANY)
+		for _, rr := range append(rrs, rrs[0]) {
+			msgs = append(msgs, reply(0, rr))
+		}
+	default:
+		if len(s.find(zone, name, "")) == 0 && name != "@" {
+			msgs = [][]byte{reply(dnsNXDomain, s.rrs(zone, "@", dnsTypeSOA)...)}
+		} else {
+			msgs = [][]byte{reply(0, s.rrs(zone, name, m.qtype)...)}
+		}
+	}
+	if mac != nil {
+		s.signResponses(msgs, mac)
+	}
+	return msgs
+}
+
+// listenDNS starts the DNS server of the rfc2136 fake on a port of the
+// loopback address for both TCP and UDP.
+func (s *Server) listenDNS() error {
+	for tries := 0; ; tries++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		c, err := net.ListenPacket("udp", l.Addr().String())
+		if err != nil {
+			l.Close()
+			if tries < 10 {
+				continue
+			}
+			return err
+		}
+		s.Addr, s.listeners = l.Addr().String(), []io.Closer{l, c}
+		go s.serveTCP(l)
+		go s.serveUDP(c)
+		return nil
+	}
+}
+
+func (s *Server) serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				b := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, b); err != nil {
+					return
+				}
+				for _, msg := range s.answer(b, true) {
+					conn.Write(append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...))
+				}
+			}
+		}()
+	}
+}
+
+func (s *Server) serveUDP(c net.PacketConn) {
+	b := make([]byte, 65535)
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		for _, msg := range s.answer(b[:n], false) {
+			c.WriteTo(msg, addr)
+		}
+	}
+}
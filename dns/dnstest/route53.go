@@ -0,0 +1,281 @@
+package dnstest
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// verifySigV4 checks the AWS Signature Version 4 of Route 53.
+func (s *Server) verifySigV4(r *http.Request, body []byte) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return errors.New("bad authorization")
+	}
+	params := map[string]string{}
+	for _, param := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		if i := strings.Index(param, "="); i > 0 {
+			params[param[:i]] = param[i+1:]
+		}
+	}
+	// the credential is the access key and the scope
+	credential := strings.SplitN(params["Credential"], "/", 2)
+	if len(credential) != 2 || credential[0] != accessKey {
+		return errors.New("bad credential " + params["Credential"])
+	}
+	date := r.Header.Get("X-Amz-Date")
+	if err := checkTime("20060102T150405Z", date); err != nil {
+		return err
+	}
+	scope := strings.Split(credential[1], "/")
+	if len(scope) != 4 || scope[0] != date[:8] || scope[2] != "route53" || scope[3] != "aws4_request" {
+		return errors.New("bad scope " + credential[1])
+	}
+	names, err := signedNames(params["SignedHeaders"], "host", "x-amz-date")
+	if err != nil {
+		return err
+	}
+	var headers string
+	for _, name := range names {
+		headers += name + ":" + headerValue(r, name) + "\n"
+	}
+	canonical := r.Method + "\n" + escape(r.URL.Path, true) + "\n" + sortedQuery(r.URL.Query()) + "\n" +
+		headers + "\n" + params["SignedHeaders"] + "\n" + sha256Sum(body)
+	key := []byte("AWS4" + s.Token)
+	for _, part := range scope {
+		key = hmacSum(key, part)
+	}
+	return equalHex(params["Signature"], hmacSum(key, "AWS4-HMAC-SHA256\n"+date+"\n"+credential[1]+"\n"+
+		sha256Sum([]byte(canonical))))
+}
+
+// route53 serves the XML API of Amazon Route 53, whose record sets are
+// listed in the order of their names with the labels reversed, then their
+// types, and paged by the name and type of the next one. The ID of a hosted
+// zone is Z and its index from 1.
+func (s *Server) route53(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.signed(w, r, s.verifySigV4); !ok {
+		return
+	}
+	type (
+		resourceRecord struct {
+			Value string `xml:"Value"`
+		}
+		rrset struct {
+			Name            string           `xml:"Name"`
+			Type            string           `xml:"Type"`
+			TTL             int              `xml:"TTL"`
+			ResourceRecords []resourceRecord `xml:"ResourceRecords>ResourceRecord"`
+		}
+		changeInfo struct {
+			Id     string `xml:"Id"`
+			Status string `xml:"Status"`
+		}
+	)
+	const xmlns = "https://route53.amazonaws.com/doc/2013-04-01/"
+	writeXML := func(code int, v interface{}) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(code)
+		w.Write([]byte(xml.Header))
+		xml.NewEncoder(w).Encode(v)
+	}
+	invalid := func(code, message string) {
+		type errorResponse struct {
+			XMLName xml.Name `xml:"ErrorResponse"`
+			Code    string   `xml:"Error>Code"`
+			Message string   `xml:"Error>Message"`
+		}
+		writeXML(400, errorResponse{Code: code, Message: message})
+	}
+	zone := func(id string) string {
+		i, _ := strconv.Atoi(strings.TrimPrefix(id, "Z"))
+		if !strings.HasPrefix(id, "Z") || i < 1 || i > len(s.zones) {
+			return ""
+		}
+		return s.zones[i-1]
+	}
+	maxItems := func() int {
+		n, _ := strconv.Atoi(r.URL.Query().Get("maxitems"))
+		if n < 1 || n > s.PageSize {
+			n = s.PageSize
+		}
+		return n
+	}
+	// order returns the key to sort a record set by
+	order := func(name, dtype string) string {
+		labels := strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".")
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return strings.Join(labels, ".") + " " + dtype
+	}
+	rrsets := func(z string) []rrset {
+		var sets []rrset
+		index := map[string]int{}
+		for _, rec := range s.find(z, "", "") {
+			key := rec.name + " " + rec.dtype
+			value := resourceRecord{quoteTXT(rec.dtype, rec.value)}
+			if i, ok := index[key]; ok {
+				sets[i].ResourceRecords = append(sets[i].ResourceRecords, value)
+				continue
+			}
+			index[key] = len(sets)
+			sets = append(sets, rrset{absoluteName(z, rec.name), rec.dtype, rec.ttl, []resourceRecord{value}})
+		}
+		sort.Slice(sets, func(i, j int) bool {
+			return order(sets[i].Name, sets[i].Type) < order(sets[j].Name, sets[j].Type)
+		})
+		return sets
+	}
+	if _, ok := route(r, "GET", "/2013-04-01/hostedzone"); ok {
+		type hostedZone struct {
+			Id          string `xml:"Id"`
+			Name        string `xml:"Name"`
+			PrivateZone bool   `xml:"Config>PrivateZone"`
+		}
+		var result struct {
+			XMLName     xml.Name     `xml:"ListHostedZonesResponse"`
+			Xmlns       string       `xml:"xmlns,attr"`
+			HostedZones []hostedZone `xml:"HostedZones>HostedZone"`
+			IsTruncated bool         `xml:"IsTruncated"`
+			NextMarker  string       `xml:"NextMarker,omitempty"`
+			MaxItems    int          `xml:"MaxItems"`
+		}
+		result.Xmlns, result.MaxItems = xmlns, maxItems()
+		start := 0
+		if marker := r.URL.Query().Get("marker"); marker != "" {
+			if zone(marker) == "" {
+				invalid("InvalidInput", "bad marker "+marker)
+				return
+			}
+			start, _ = strconv.Atoi(strings.TrimPrefix(marker, "Z"))
+			start--
+		}
+		for i := start; i < len(s.zones); i++ {
+			id := "Z" + strconv.Itoa(i+1)
+			if len(result.HostedZones) == result.MaxItems {
+				result.IsTruncated, result.NextMarker = true, id
+				break
+			}
+			result.HostedZones = append(result.HostedZones, hostedZone{"/hostedzone/" + id, s.zones[i] + ".", false})
+		}
+		writeXML(200, result)
+	} else if parts, ok := route(r, "GET", "/2013-04-01/hostedzone/*/rrset"); ok && zone(parts[2]) != "" {
+		var result struct {
+			XMLName            xml.Name `xml:"ListResourceRecordSetsResponse"`
+			Xmlns              string   `xml:"xmlns,attr"`
+			ResourceRecordSets []rrset  `xml:"ResourceRecordSets>ResourceRecordSet"`
+			IsTruncated        bool     `xml:"IsTruncated"`
+			NextRecordName     string   `xml:"NextRecordName,omitempty"`
+			NextRecordType     string   `xml:"NextRecordType,omitempty"`
+			MaxItems           int      `xml:"MaxItems"`
+		}
+		result.Xmlns, result.MaxItems = xmlns, maxItems()
+		name, dtype := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+		if dtype != "" && name == "" {
+			invalid("InvalidInput", "type is given without name")
+			return
+		}
+		for _, set := range rrsets(zone(parts[2])) {
+			// the list starts from the name and type
+			if name != "" && order(set.Name, set.Type) < order(name, dtype) {
+				continue
+			}
+			if len(result.ResourceRecordSets) == result.MaxItems {
+				result.IsTruncated, result.NextRecordName, result.NextRecordType = true, set.Name, set.Type
+				break
+			}
+			result.ResourceRecordSets = append(result.ResourceRecordSets, set)
+		}
+		writeXML(200, result)
+	} else if parts, ok := route(r, "POST", "/2013-04-01/hostedzone/*/rrset"); ok && zone(parts[2]) != "" {
+		z := zone(parts[2])
+		var body struct {
+			Changes []struct {
+				Action string `xml:"Action"`
+				RRSet  rrset  `xml:"ResourceRecordSet"`
+			} `xml:"ChangeBatch>Changes>Change"`
+		}
+		if xml.NewDecoder(r.Body).Decode(&body) != nil || len(body.Changes) == 0 {
+			invalid("InvalidInput", "bad change batch")
+			return
+		}
+		// the changes of a batch are checked before any is made
+		for _, c := range body.Changes {
+			set, name := c.RRSet, relativeName(z, c.RRSet.Name)
+			if name == "" || set.TTL < 1 || len(set.ResourceRecords) == 0 {
+				invalid("InvalidChangeBatch", "bad record set "+set.Name+" "+set.Type)
+				return
+			}
+			var values []string
+			for _, rr := range set.ResourceRecords {
+				value, quoted := unquoteTXT(set.Type, rr.Value)
+				if !quoted {
+					invalid("InvalidChangeBatch", "TXT value is not quoted: "+rr.Value)
+					return
+				}
+				values = append(values, value)
+			}
+			existing := s.find(z, name, set.Type)
+			switch c.Action {
+			case "CREATE":
+				if len(existing) > 0 {
+					invalid("InvalidChangeBatch", "record set "+set.Name+" "+set.Type+" exists")
+					return
+				}
+			case "UPSERT":
+			case "DELETE":
+				// a deletion must match the record set exactly
+				var current []string
+				for _, rec := range existing {
+					current = append(current, rec.value)
+					if rec.ttl != set.TTL {
+						current = nil
+						break
+					}
+				}
+				sort.Strings(current)
+				sort.Strings(values)
+				if strings.Join(current, "\n") != strings.Join(values, "\n") {
+					invalid("InvalidChangeBatch", "record set "+set.Name+" "+set.Type+" does not match")
+					return
+				}
+			default:
+				invalid("InvalidChangeBatch", "bad action "+c.Action)
+				return
+			}
+		}
+		for _, c := range body.Changes {
+			var values []string
+			if c.Action != "DELETE" {
+				for _, rr := range c.RRSet.ResourceRecords {
+					value, _ := unquoteTXT(c.RRSet.Type, rr.Value)
+					values = append(values, value)
+				}
+			}
+			s.change(c.Action, z, relativeName(z, c.RRSet.Name), c.RRSet.Type, values, c.RRSet.TTL)
+		}
+		var result struct {
+			XMLName    xml.Name   `xml:"ChangeResourceRecordSetsResponse"`
+			Xmlns      string     `xml:"xmlns,attr"`
+			ChangeInfo changeInfo `xml:"ChangeInfo"`
+		}
+		result.Xmlns = xmlns
+		result.ChangeInfo = changeInfo{"/change/C" + strconv.Itoa(len(s.changes)), "PENDING"}
+		writeXML(200, result)
+	} else if parts, ok := route(r, "GET", "/2013-04-01/change/*"); ok {
+		var result struct {
+			XMLName    xml.Name   `xml:"GetChangeResponse"`
+			Xmlns      string     `xml:"xmlns,attr"`
+			ChangeInfo changeInfo `xml:"ChangeInfo"`
+		}
+		result.Xmlns = xmlns
+		result.ChangeInfo = changeInfo{"/change/" + parts[2], "INSYNC"}
+		writeXML(200, result)
+	} else {
+		notFound(w)
+	}
+}
@@ -0,0 +1,645 @@
+package dnstest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiguanhao/certutils/dns"
+)
+
+type (
+	// Server is a fake API server of a provider, with zones and records in
+	// memory. Lists are paged by PageSize, so the pagination of the providers
+	// is used even with a few records.
+	Server struct {
+		*httptest.Server
+		Provider string
+		Token    string
+		PageSize int
+		// Addr is the address of the DNS server of the rfc2136 fake, which
+		// has no HTTP server, on both TCP and UDP
+		Addr string
+		// UnsignedLast leaves the last message of a zone transfer of the
+		// rfc2136 fake unsigned, which clients must refuse
+		UnsignedLast bool
+		// Dir is a temporary directory of the zone files of the zonefile
+		// fake and the accounts of the acmedns fake, removed by Close
+		Dir string
+
+		mu      sync.Mutex
+		zones   []string
+		records []record
+		nextId  int
+		changes []string
+		// key is the key of the service account of Google Cloud DNS
+		key       *rsa.PrivateKey
+		listeners []io.Closer
+		// accounts are the accounts of acme-dns by their usernames
+		accounts map[string]acmeAccount
+	}
+
+	record struct {
+		id, zone, name, dtype, value string
+		ttl                          int
+	}
+
+	acmeAccount struct {
+		password, subdomain string
+	}
+)
+
+// Fakes are the providers which have fake servers, with the function to
+// create the provider of a server. The fakes of memory and zonefile are no
+// servers, but the Memory and the files of the zones in Dir. The records of
+// acmedns can't be listed, so Run can't check it, RunFakes checks it in its
+// own way.
+var Fakes = map[string]func(s *Server) dns.DNS{
+	"hetzner": func(s *Server) dns.DNS {
+		return &dns.Hetzner{Token: s.Token, Endpoint: s.URL}
+	},
+	"digitalocean": func(s *Server) dns.DNS {
+		return &dns.DigitalOcean{Token: s.Token, Endpoint: s.URL}
+	},
+	"linode": func(s *Server) dns.DNS {
+		return &dns.Linode{Token: s.Token, Endpoint: s.URL}
+	},
+	"gandi": func(s *Server) dns.DNS {
+		return &dns.Gandi{Token: s.Token, Endpoint: s.URL}
+	},
+	"powerdns": func(s *Server) dns.DNS {
+		return &dns.PowerDNS{URL: s.URL, APIKey: s.Token}
+	},
+	"huawei": func(s *Server) dns.DNS {
+		return &dns.Huawei{AccessKey: accessKey, SecretKey: s.Token, Endpoint: s.URL}
+	},
+	"baidu": func(s *Server) dns.DNS {
+		return &dns.Baidu{AccessKey: accessKey, SecretKey: s.Token, Endpoint: s.URL}
+	},
+	"route53": func(s *Server) dns.DNS {
+		return &dns.Route53{AccessKeyId: accessKey, SecretAccessKey: s.Token, Endpoint: s.URL}
+	},
+	"rfc2136": func(s *Server) dns.DNS {
+		return &dns.RFC2136{Nameserver: s.Addr, Zones: append([]string{}, s.zones...), TSIGKey: "dnstest",
+			TSIGSecret: base64.StdEncoding.EncodeToString([]byte(s.Token)), Timeout: 5 * time.Second}
+	},
+	"gcloud": func(s *Server) dns.DNS {
+		return &dns.GoogleCloud{Project: "dnstest", ClientEmail: googleClientEmail, PrivateKey: s.key,
+			TokenURL: s.URL + "/token", Endpoint: s.URL + "/dns/v1"}
+	},
+	"dnspod": func(s *Server) dns.DNS {
+		return &dns.DNSPod{SecretId: accessKey, SecretKey: s.Token, Endpoint: s.URL}
+	},
+	"acmedns": func(s *Server) dns.DNS {
+		return &dns.AcmeDNS{URL: s.URL, Storage: filepath.Join(s.Dir, "acmedns.json")}
+	},
+	"exec": func(s *Server) dns.DNS {
+		return &dns.Exec{Command: s.execCommand()}
+	},
+	"memory": func(s *Server) dns.DNS {
+		m := dns.NewMemory(s.zones...)
+		for _, rec := range s.records {
+			m.AddNewRecord(rec.zone, rec.name, rec.dtype, rec.value)
+		}
+		return m
+	},
+	"zonefile": func(s *Server) dns.DNS {
+		files := map[string]string{}
+		for _, zone := range s.zones {
+			files[zone] = s.zoneFile(zone)
+		}
+		return &dns.ZoneFile{Files: files}
+	},
+}
+
+// checks are the checks of the fakes which Run can't check.
+var checks = map[string]func(s *Server, d dns.DNS) error{
+	"acmedns": checkAcmeDNS,
+}
+
+// RunFakes runs the check against the fake server of every provider in
+// Fakes.
+func RunFakes() error {
+	var providers []string
+	for provider := range Fakes {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		s, err := NewServer(provider, "example.com", "example.net", "example.org")
+		if err != nil {
+			return err
+		}
+		if check := checks[provider]; check != nil {
+			err = check(s, Fakes[provider](s))
+		} else {
+			err = Run(Fakes[provider](s), "example.net")
+		}
+		s.Close()
+		if err != nil {
+			return errors.New(provider + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// NewServer starts a fake server of the provider with the zones, each has an
+// A record at the apex and a CNAME record of www.
+func NewServer(provider string, zones ...string) (*Server, error) {
+	s := &Server{Provider: provider, Token: "dnstest", PageSize: 2, zones: zones}
+	var handler http.HandlerFunc
+	switch provider {
+	case "hetzner":
+		handler = s.hetzner
+	case "digitalocean":
+		handler = s.digitalOcean
+	case "linode":
+		handler = s.linode
+	case "gandi":
+		handler = s.gandi
+	case "powerdns":
+		handler = s.powerDNS
+	case "huawei":
+		handler = s.huawei
+	case "baidu":
+		handler = s.baidu
+	case "route53":
+		handler = s.route53
+	case "gcloud":
+		handler = s.googleCloud
+		var err error
+		if s.key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, err
+		}
+	case "dnspod":
+		handler = s.dnspod
+	case "acmedns":
+		handler = s.acmeDNS
+	case "exec":
+		handler = s.exec
+	case "rfc2136", "memory", "zonefile":
+	default:
+		return nil, errors.New("dnstest: no fake server of " + provider)
+	}
+	for _, zone := range zones {
+		s.add(zone, "@", "A", "192.0.2.1", 300)
+		s.add(zone, "www", "CNAME", zone+".", 300)
+	}
+	if provider == "acmedns" || provider == "zonefile" {
+		var err error
+		if s.Dir, err = ioutil.TempDir("", "dnstest"); err != nil {
+			return nil, err
+		}
+	}
+	switch provider {
+	case "rfc2136":
+		return s, s.listenDNS()
+	case "zonefile":
+		return s, s.writeZoneFiles()
+	case "memory":
+		return s, nil
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handler(w, r)
+	}))
+	return s, nil
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	if s.Server != nil {
+		s.Server.Close()
+	}
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	if s.Dir != "" {
+		os.RemoveAll(s.Dir)
+	}
+}
+
+// Changes returns the changes of record sets made by the provider, in the
+// words of its API, like "REPLACE _acme-challenge.example.net. TXT 2" of
+// PowerDNS, with the name, type and number of values after the change.
+func (s *Server) Changes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.changes...)
+}
+
+// Values returns the values of the records of the name and type in the zone,
+// the name is relative to the zone, "@" at the apex.
+func (s *Server) Values(zone, name, dtype string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := []string{}
+	for _, r := range s.find(zone, name, dtype) {
+		values = append(values, r.value)
+	}
+	return values
+}
+
+// change replaces the values of the record set of the name and type, and
+// logs the change.
+func (s *Server) change(action, zone, name, dtype string, values []string, ttl int) {
+	s.remove(func(rec record) bool {
+		return rec.zone == zone && rec.name == name && rec.dtype == dtype
+	})
+	for _, value := range values {
+		s.add(zone, name, dtype, value, ttl)
+	}
+	s.changes = append(s.changes, action+" "+absoluteName(zone, name)+" "+dtype+" "+strconv.Itoa(len(values)))
+}
+
+func (s *Server) add(zone, name, dtype, value string, ttl int) record {
+	s.nextId++
+	r := record{strconv.Itoa(s.nextId), zone, name, dtype, value, ttl}
+	s.records = append(s.records, r)
+	return r
+}
+
+// find returns the records of the zone, and of the name and type if they are
+// not empty.
+func (s *Server) find(zone, name, dtype string) []record {
+	var records []record
+	for _, r := range s.records {
+		if r.zone == zone && (name == "" || r.name == name) && (dtype == "" || r.dtype == dtype) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// remove removes the records for which match returns true, and returns
+// their number.
+func (s *Server) remove(match func(r record) bool) int {
+	var records []record
+	for _, r := range s.records {
+		if !match(r) {
+			records = append(records, r)
+		}
+	}
+	n := len(s.records) - len(records)
+	s.records = records
+	return n
+}
+
+// absoluteName returns the fully qualified name of a record with a dot.
+func absoluteName(zone, name string) string {
+	if name == "@" {
+		return zone + "."
+	}
+	return name + "." + zone + "."
+}
+
+// relativeName returns the name of a record relative to the zone, or "" if
+// it is not in the zone.
+func relativeName(zone, name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == zone {
+		return "@"
+	}
+	if !strings.HasSuffix(name, "."+zone) {
+		return ""
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
+
+// quoteTXT returns the value of a TXT record in the presentation format.
+func quoteTXT(dtype, value string) string {
+	if dtype != "TXT" {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// unquoteTXT returns the value of a TXT record in the presentation format
+// without quotes, or false if it is not quoted.
+func unquoteTXT(dtype, value string) (string, bool) {
+	if dtype != "TXT" {
+		return value, true
+	}
+	unquoted, err := strconv.Unquote(value)
+	return unquoted, err == nil
+}
+
+func (s *Server) hasZone(zone string) bool {
+	for _, z := range s.zones {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// page returns the range of the requested page of n items and the number of
+// pages.
+func (s *Server) page(r *http.Request, sizeParam string, n int) (start, end, pages int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	size, _ := strconv.Atoi(r.URL.Query().Get(sizeParam))
+	if size < 1 || size > s.PageSize {
+		size = s.PageSize
+	}
+	pages = (n + size - 1) / size
+	start = (page - 1) * size
+	if start > n {
+		start = n
+	}
+	end = start + size
+	if end > n {
+		end = n
+	}
+	return
+}
+
+// authorized checks the header of the token and writes 401 if it is not.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request, header, prefix string) bool {
+	if r.Header.Get(header) != prefix+s.Token {
+		http.Error(w, `{"message":"unauthorized"}`, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// route splits the path and returns whether it is the method and has the
+// parts of pattern, "*" matches any part.
+func route(r *http.Request, method, pattern string) ([]string, bool) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	patterns := strings.Split(strings.Trim(pattern, "/"), "/")
+	if r.Method != method || len(parts) != len(patterns) {
+		return nil, false
+	}
+	for i, p := range patterns {
+		if p != "*" && p != parts[i] {
+			return nil, false
+		}
+	}
+	return parts, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "not found"})
+}
+
+// hetzner serves the API of Hetzner DNS, the ID of a zone is its name.
+func (s *Server) hetzner(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r, "Auth-API-Token", "") {
+		return
+	}
+	type object = map[string]interface{}
+	meta := func(pages int) object {
+		return object{"pagination": object{"last_page": pages}}
+	}
+	if _, ok := route(r, "GET", "/zones"); ok {
+		var zones []object
+		for _, z := range s.zones {
+			if name := r.URL.Query().Get("name"); name == "" || name == z {
+				zones = append(zones, object{"id": z, "name": z})
+			}
+		}
+		start, end, pages := s.page(r, "per_page", len(zones))
+		writeJSON(w, 200, object{"zones": zones[start:end], "meta": meta(pages)})
+	} else if _, ok := route(r, "GET", "/records"); ok {
+		var records []object
+		for _, rec := range s.find(r.URL.Query().Get("zone_id"), "", "") {
+			records = append(records, object{"id": rec.id, "zone_id": rec.zone, "name": rec.name, "type": rec.dtype, "value": rec.value})
+		}
+		start, end, pages := s.page(r, "per_page", len(records))
+		writeJSON(w, 200, object{"records": records[start:end], "meta": meta(pages)})
+	} else if _, ok := route(r, "POST", "/records"); ok {
+		var body struct {
+			ZoneId string `json:"zone_id"`
+			Type   string `json:"type"`
+			Name   string `json:"name"`
+			Value  string `json:"value"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil || !s.hasZone(body.ZoneId) {
+			writeJSON(w, 422, object{"message": "bad record"})
+			return
+		}
+		rec := s.add(body.ZoneId, body.Name, body.Type, body.Value, 300)
+		writeJSON(w, 200, object{"record": object{"id": rec.id, "name": rec.name, "type": rec.dtype, "value": rec.value}})
+	} else if parts, ok := route(r, "DELETE", "/records/*"); ok {
+		if s.remove(func(rec record) bool { return rec.id == parts[1] }) == 0 {
+			notFound(w)
+		}
+	} else {
+		notFound(w)
+	}
+}
+
+// digitalOcean serves the API of DigitalOcean Domains.
+func (s *Server) digitalOcean(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r, "Authorization", "Bearer ") {
+		return
+	}
+	type object = map[string]interface{}
+	links := func(page, pages int) object {
+		if page >= pages {
+			return object{}
+		}
+		return object{"pages": object{"next": "page=" + strconv.Itoa(page+1)}}
+	}
+	current := func() int {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		return page
+	}
+	if _, ok := route(r, "GET", "/domains"); ok {
+		var domains []object
+		for _, z := range s.zones {
+			domains = append(domains, object{"name": z})
+		}
+		start, end, pages := s.page(r, "per_page", len(domains))
+		writeJSON(w, 200, object{"domains": domains[start:end], "links": links(current(), pages)})
+	} else if parts, ok := route(r, "GET", "/domains/*/records"); ok && s.hasZone(parts[1]) {
+		zone := parts[1]
+		name := strings.TrimSuffix(r.URL.Query().Get("name"), "."+zone)
+		if name == zone {
+			name = "@"
+		}
+		var records []object
+		for _, rec := range s.find(zone, name, r.URL.Query().Get("type")) {
+			id, _ := strconv.Atoi(rec.id)
+			records = append(records, object{"id": id, "name": rec.name, "type": rec.dtype, "data": rec.value})
+		}
+		start, end, pages := s.page(r, "per_page", len(records))
+		writeJSON(w, 200, object{"domain_records": records[start:end], "links": links(current(), pages)})
+	} else if parts, ok := route(r, "POST", "/domains/*/records"); ok && s.hasZone(parts[1]) {
+		var body struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+			Data string `json:"data"`
+			TTL  int    `json:"ttl"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil || body.TTL < 30 {
+			writeJSON(w, 422, object{"message": "bad record"})
+			return
+		}
+		rec := s.add(parts[1], body.Name, body.Type, body.Data, body.TTL)
+		id, _ := strconv.Atoi(rec.id)
+		writeJSON(w, 201, object{"domain_record": object{"id": id, "name": rec.name, "type": rec.dtype, "data": rec.value}})
+	} else if parts, ok := route(r, "DELETE", "/domains/*/records/*"); ok {
+		if s.remove(func(rec record) bool { return rec.zone == parts[1] && rec.id == parts[3] }) == 0 {
+			notFound(w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		notFound(w)
+	}
+}
+
+// linode serves the Domains API of Linode, the ID of a zone is its index
+// from 1, the name of the records at the apex is empty.
+func (s *Server) linode(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r, "Authorization", "Bearer ") {
+		return
+	}
+	type object = map[string]interface{}
+	zone := func(id string) string {
+		i, _ := strconv.Atoi(id)
+		if i < 1 || i > len(s.zones) {
+			return ""
+		}
+		return s.zones[i-1]
+	}
+	if _, ok := route(r, "GET", "/domains"); ok {
+		var domains []object
+		for i, z := range s.zones {
+			domains = append(domains, object{"id": i + 1, "domain": z, "type": "master"})
+		}
+		start, end, pages := s.page(r, "page_size", len(domains))
+		writeJSON(w, 200, object{"data": domains[start:end], "pages": pages})
+	} else if parts, ok := route(r, "GET", "/domains/*/records"); ok && zone(parts[1]) != "" {
+		var records []object
+		for _, rec := range s.find(zone(parts[1]), "", "") {
+			id, _ := strconv.Atoi(rec.id)
+			name := rec.name
+			if name == "@" {
+				name = ""
+			}
+			records = append(records, object{"id": id, "name": name, "type": rec.dtype, "target": rec.value})
+		}
+		start, end, pages := s.page(r, "page_size", len(records))
+		writeJSON(w, 200, object{"data": records[start:end], "pages": pages})
+	} else if parts, ok := route(r, "POST", "/domains/*/records"); ok && zone(parts[1]) != "" {
+		var body struct {
+			Type   string `json:"type"`
+			Name   string `json:"name"`
+			Target string `json:"target"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil {
+			writeJSON(w, 400, object{"errors": []object{{"reason": "bad record"}}})
+			return
+		}
+		if body.Name == "" {
+			body.Name = "@"
+		}
+		rec := s.add(zone(parts[1]), body.Name, body.Type, body.Target, 300)
+		id, _ := strconv.Atoi(rec.id)
+		writeJSON(w, 200, object{"id": id, "name": body.Name, "type": rec.dtype, "target": rec.value})
+	} else if parts, ok := route(r, "DELETE", "/domains/*/records/*"); ok {
+		z := zone(parts[1])
+		if s.remove(func(rec record) bool { return rec.zone == z && rec.id == parts[3] }) == 0 {
+			notFound(w)
+			return
+		}
+		writeJSON(w, 200, object{})
+	} else {
+		notFound(w)
+	}
+}
+
+// gandi serves the API of Gandi LiveDNS, which has record sets instead of
+// records.
+func (s *Server) gandi(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r, "Authorization", "Bearer ") {
+		return
+	}
+	type object = map[string]interface{}
+	rrsets := func(records []record) []object {
+		var rrsets []object
+		index := map[string]int{}
+		for _, rec := range records {
+			key := rec.name + " " + rec.dtype
+			if i, ok := index[key]; ok {
+				rrsets[i]["rrset_values"] = append(rrsets[i]["rrset_values"].([]string), rec.value)
+				continue
+			}
+			index[key] = len(rrsets)
+			rrsets = append(rrsets, object{"rrset_name": rec.name, "rrset_type": rec.dtype,
+				"rrset_ttl": rec.ttl, "rrset_values": []string{rec.value}})
+		}
+		return rrsets
+	}
+	if _, ok := route(r, "GET", "/domains"); ok {
+		domains := []object{}
+		for _, z := range s.zones {
+			domains = append(domains, object{"fqdn": z})
+		}
+		start, end, _ := s.page(r, "per_page", len(domains))
+		writeJSON(w, 200, domains[start:end])
+	} else if parts, ok := route(r, "GET", "/domains/*/records"); ok && s.hasZone(parts[1]) {
+		list := append([]object{}, rrsets(s.find(parts[1], "", ""))...)
+		start, end, _ := s.page(r, "per_page", len(list))
+		writeJSON(w, 200, list[start:end])
+	} else if parts, ok := route(r, "GET", "/domains/*/records/*/*"); ok && s.hasZone(parts[1]) {
+		list := rrsets(s.find(parts[1], parts[3], parts[4]))
+		if len(list) == 0 {
+			notFound(w)
+			return
+		}
+		writeJSON(w, 200, list[0])
+	} else if parts, ok := route(r, "PUT", "/domains/*/records/*/*"); ok && s.hasZone(parts[1]) {
+		var body struct {
+			TTL    int      `json:"rrset_ttl"`
+			Values []string `json:"rrset_values"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil || len(body.Values) == 0 || body.TTL < 300 {
+			writeJSON(w, 400, object{"message": "bad record set"})
+			return
+		}
+		s.remove(func(rec record) bool {
+			return rec.zone == parts[1] && rec.name == parts[3] && rec.dtype == parts[4]
+		})
+		for _, value := range body.Values {
+			s.add(parts[1], parts[3], parts[4], value, body.TTL)
+		}
+		writeJSON(w, 201, object{"message": "DNS Record Created"})
+	} else if parts, ok := route(r, "DELETE", "/domains/*/records/*/*"); ok {
+		n := s.remove(func(rec record) bool {
+			return rec.zone == parts[1] && rec.name == parts[3] && rec.dtype == parts[4]
+		})
+		if n == 0 {
+			notFound(w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		notFound(w)
+	}
+}
@@ -0,0 +1,126 @@
+package dnstest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The signatures of the fake servers are checked here, apart from the code
+// of package dns which makes them, so that both have to follow the
+// documentation of the providers to agree.
+
+// accessKey is the access key ID of the providers which sign requests, the
+// secret is the token of the server.
+const accessKey = "DNSTESTACCESSKEY"
+
+// signed reads the body of the request and checks its signature with verify,
+// it writes 403 if the signature is bad.
+func (s *Server) signed(w http.ResponseWriter, r *http.Request, verify func(r *http.Request, body []byte) error) ([]byte, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = verify(r, body)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "bad signature: " + err.Error(), "code": "SignatureDoesNotMatch"})
+		return nil, false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// checkTime checks that the time of a signature is not more than 15 minutes
+// from now.
+func checkTime(layout, value string) error {
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return fmt.Errorf("bad time %q", value)
+	}
+	if d := time.Since(t); d > 15*time.Minute || d < -15*time.Minute {
+		return fmt.Errorf("time %s is too far from now", value)
+	}
+	return nil
+}
+
+// escape percent-encodes all bytes but the unreserved characters of RFC 3986,
+// and "/" if keepSlash.
+func escape(s string, keepSlash bool) string {
+	const unreserved = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.~"
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if strings.IndexByte(unreserved, c) >= 0 || c == '/' && keepSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// sortedQuery returns the escaped parameters of the query as "key=value",
+// sorted, without the keys in skip.
+func sortedQuery(query url.Values, skip ...string) string {
+	var params []string
+	for key, values := range query {
+		if contains(skip, key) {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, escape(key, false)+"="+escape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// headerValue returns the value of a signed header, the host is not in the
+// headers of a server request.
+func headerValue(r *http.Request, name string) string {
+	if name == "host" {
+		return r.Host
+	}
+	return strings.TrimSpace(r.Header.Get(name))
+}
+
+// signedNames splits the signed headers and checks that they are sorted,
+// lowercase and have the required ones.
+func signedNames(signed string, required ...string) ([]string, error) {
+	names := strings.Split(signed, ";")
+	if !sort.StringsAreSorted(names) || strings.ToLower(signed) != signed {
+		return nil, errors.New("signed headers are not sorted lowercase names: " + signed)
+	}
+	for _, name := range required {
+		if !contains(names, name) {
+			return nil, errors.New(name + " is not signed")
+		}
+	}
+	return names, nil
+}
+
+func hmacSum(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func sha256Sum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// equalHex compares a hex signature in constant time.
+func equalHex(signature string, sum []byte) error {
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(sum))) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
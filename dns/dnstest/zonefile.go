@@ -0,0 +1,31 @@
+package dnstest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// writeZoneFiles writes the zone files of the zonefile fake to Dir, with a
+// SOA record and the records of the zones. The files are the records of the
+// fake from then on, Values and Changes don't see them.
+func (s *Server) writeZoneFiles() error {
+	for _, zone := range s.zones {
+		var b strings.Builder
+		fmt.Fprintf(&b, "$ORIGIN %s.\n$TTL 300\n", zone)
+		fmt.Fprintf(&b, "@\tIN\tSOA\tns1 hostmaster (\n\t\t1 ; serial\n\t\t3600 600 86400 300 )\n")
+		for _, rec := range s.find(zone, "", "") {
+			fmt.Fprintf(&b, "%s\t%d\tIN\t%s\t%s\n", rec.name, rec.ttl, rec.dtype, quoteTXT(rec.dtype, rec.value))
+		}
+		if err := ioutil.WriteFile(s.zoneFile(zone), []byte(b.String()), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zoneFile returns the path of the file of the zone.
+func (s *Server) zoneFile(zone string) string {
+	return filepath.Join(s.Dir, "db."+zone)
+}
@@ -0,0 +1,252 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+type (
+	// Exec runs a program for each operation, which can be a script of any
+	// DNS tool. The program gets a JSON request on stdin:
+	//
+	//	{"version": 1, "action": "list-domains"}
+	//	{"version": 1, "action": "list-records", "domain": "example.com",
+	//	 "name": "_acme-challenge", "type": "TXT"}
+	//	{"version": 1, "action": "add", "domain": "example.com",
+	//	 "name": "_acme-challenge", "type": "TXT", "content": "..."}
+	//	{"version": 1, "action": "delete", "domain": "example.com", "id": "..."}
+	//
+	// and writes a JSON response to stdout:
+	//
+	//	{"domains": ["example.com"]}
+	//	{"records": [{"id": "...", "type": "TXT", "name": "_acme-challenge",
+	//	  "content": "..."}]}
+	//	{"id": "..."}
+	//	{}
+	//
+	// Names are relative to the domain, "@" for the domain itself. The name
+	// and type of list-records are filters the program may ignore. A failure
+	// is an exit status other than 0 (with the message on stderr) or a
+	// response of {"error": "message"}.
+	Exec struct {
+		// Command is the program and its arguments
+		Command []string
+		// Timeout is the most time of a run, 30 seconds by default
+		Timeout time.Duration
+	}
+
+	execRequest struct {
+		Version int    `json:"version"`
+		Action  string `json:"action"`
+		Domain  string `json:"domain,omitempty"`
+		Name    string `json:"name,omitempty"`
+		Type    string `json:"type,omitempty"`
+		Content string `json:"content,omitempty"`
+		Id      string `json:"id,omitempty"`
+	}
+
+	execRecord struct {
+		Id      string `json:"id"`
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Content string `json:"content"`
+	}
+)
+
+// execVersion is the version of the protocol.
+const execVersion = 1
+
+var _ DNS = (*Exec)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "exec",
+		Options: []Option{
+			{Name: "command", Type: OptionCommand, Required: true},
+			{Name: "timeout", Type: OptionDuration},
+		},
+		New: func(o Options) (DNS, error) {
+			return &Exec{
+				Command: o.Strings("command"),
+				Timeout: o.Duration("timeout"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewExecFromEnv()
+		},
+	})
+}
+
+// NewExecFromEnv returns an Exec configured by the environment variables
+// DNS_EXEC_COMMAND (the program and its arguments, separated by spaces) and
+// DNS_EXEC_TIMEOUT (like "30s").
+func NewExecFromEnv() (*Exec, error) {
+	e := &Exec{Command: strings.Fields(os.Getenv("DNS_EXEC_COMMAND"))}
+	if len(e.Command) == 0 {
+		return nil, errors.New("exec: please set DNS_EXEC_COMMAND")
+	}
+	if timeout := os.Getenv("DNS_EXEC_TIMEOUT"); timeout != "" {
+		var err error
+		if e.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, errors.New("exec: bad DNS_EXEC_TIMEOUT " + timeout)
+		}
+	}
+	return e, nil
+}
+
+// run runs the program with the request and decodes its response into
+// result.
+func (e *Exec) run(req execRequest, result interface{}) error {
+	if len(e.Command) == 0 {
+		return errors.New("exec: no command")
+	}
+	req.Version = execVersion
+	input, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	prefix := "exec: " + e.Command[0] + " " + req.Action + ": "
+	cmd := exec.Command(e.Command[0], e.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return errors.New(prefix + err.Error())
+	}
+	// a program that times out is killed with the processes it started,
+	// and not waited for, as one that left its process group may still
+	// have its output open
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+	case <-timer.C:
+		killProcessGroup(cmd)
+		return errors.New(prefix + "timed out after " + timeout.String())
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(prefix + err.Error() + ": " + msg)
+		}
+		return errors.New(prefix + err.Error())
+	}
+
+	var response struct {
+		Error string `json:"error"`
+	}
+	output := bytes.TrimSpace(stdout.Bytes())
+	if err := json.Unmarshal(output, &response); err != nil {
+		return fmt.Errorf("%sbad response %q: %v", prefix, truncate(string(output), 200), err)
+	}
+	if response.Error != "" {
+		return errors.New(prefix + response.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(output, result); err != nil {
+		return fmt.Errorf("%sbad response %q: %v", prefix, truncate(string(output), 200), err)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func (e *Exec) GetListOfDomains() ([]string, error) {
+	var result struct {
+		Domains []string `json:"domains"`
+	}
+	if err := e.run(execRequest{Action: "list-domains"}, &result); err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	for _, domain := range result.Domains {
+		domains = append(domains, strings.TrimSuffix(domain, "."))
+	}
+	return domains, nil
+}
+
+func (e *Exec) getRecords(domain, dname, dtype string) ([]execRecord, error) {
+	var result struct {
+		Records []execRecord `json:"records"`
+	}
+	req := execRequest{Action: "list-records", Domain: domain, Name: dname, Type: dtype}
+	if err := e.run(req, &result); err != nil {
+		return nil, err
+	}
+	return result.Records, nil
+}
+
+func (e *Exec) GetRecords(domain string) (records []Record, err error) {
+	list, err := e.getRecords(domain, "", "")
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		fullName := domain
+		if r.Name != "@" {
+			fullName = r.Name + "." + fullName
+		}
+		records = append(records, Record{
+			Id:       r.Id,
+			Type:     r.Type,
+			Name:     r.Name,
+			FullName: fullName,
+			Content:  r.Content,
+		})
+	}
+	return
+}
+
+func (e *Exec) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	list, err := e.getRecords(domain, dname, dtype)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range list {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+func (e *Exec) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	var result struct {
+		Id string `json:"id"`
+	}
+	req := execRequest{Action: "add", Domain: domain, Name: dname, Type: dtype, Content: dvalue}
+	if err := e.run(req, &result); err != nil {
+		return "", err
+	}
+	if result.Id == "" {
+		return "", errors.New("exec: " + e.Command[0] + " add: no id in the response")
+	}
+	return result.Id, nil
+}
+
+func (e *Exec) DeleteRecord(domain, id string) error {
+	return e.run(execRequest{Action: "delete", Domain: domain, Id: id}, nil)
+}
@@ -0,0 +1,15 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package dns
+
+import "os/exec"
+
+// setProcessGroup does nothing, there are no process groups to use.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the program, the processes it started are left
+// running.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,199 @@
+package dns_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caiguanhao/certutils/dns"
+	"github.com/caiguanhao/certutils/dns/dnstest"
+)
+
+// newFake starts the fake server of the provider with the zones
+// example.com, example.net and example.org.
+func newFake(t *testing.T, provider string) (*dnstest.Server, dns.DNS) {
+	t.Helper()
+	s, err := dnstest.NewServer(provider, "example.com", "example.net", "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s, dnstest.Fakes[provider](s)
+}
+
+// testSigned runs the check against the fake server of a provider which
+// signs requests, and checks that the server refuses a bad signature.
+func testSigned(t *testing.T, provider string, withSecret func(d dns.DNS, secret string)) {
+	s, d := newFake(t, provider)
+	if err := dnstest.Run(d, "example.net"); err != nil {
+		t.Fatal(err)
+	}
+	withSecret(d, s.Token+"x")
+	if _, err := d.GetListOfDomains(); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("bad signature is not refused: %v", err)
+	}
+}
+
+// testRecordSets adds two TXT records of _acme-challenge.example.net to the
+// fake server of a provider with record sets and deletes them, and checks
+// the changes of the record set made by each step.
+func testRecordSets(t *testing.T, provider string, changes [][]string) (*dnstest.Server, dns.DNS) {
+	s, d := newFake(t, provider)
+	const name = "_acme-challenge"
+	step := func(i int, what string, do func() error, values ...string) {
+		t.Helper()
+		n := len(s.Changes())
+		if err := do(); err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if got := s.Values("example.net", name, "TXT"); !reflect.DeepEqual(got, append([]string{}, values...)) {
+			t.Errorf("%s: values are %q, want %q", what, got, values)
+		}
+		if got := s.Changes()[n:]; !reflect.DeepEqual(got, changes[i]) {
+			t.Errorf("%s: changes are %q, want %q", what, got, changes[i])
+		}
+	}
+	add := func(value string) func() error {
+		return func() error {
+			_, err := d.AddNewRecord("example.net", name, "TXT", value)
+			return err
+		}
+	}
+	first := `one "quoted" \ value`
+	step(0, "add first", add(first), first)
+	step(1, "add second", add("two"), first, "two")
+	ids, err := d.GetRecordIdsFor("example.net", name, "TXT")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("ids are %q (%v)", ids, err)
+	}
+	step(2, "delete first", func() error { return d.DeleteRecord("example.net", ids[0]) }, "two")
+	step(3, "delete last", func() error { return d.DeleteRecord("example.net", ids[1]) })
+	if err := d.DeleteRecord("example.net", ids[1]); err == nil {
+		t.Error("deleted a record twice")
+	}
+	return s, d
+}
+
+func TestHuaweiFake(t *testing.T) {
+	testSigned(t, "huawei", func(d dns.DNS, secret string) {
+		d.(*dns.Huawei).SecretKey = secret
+	})
+	testRecordSets(t, "huawei", [][]string{
+		{"CREATE _acme-challenge.example.net. TXT 1"},
+		{"UPDATE _acme-challenge.example.net. TXT 2"},
+		{"UPDATE _acme-challenge.example.net. TXT 1"},
+		{"DELETE _acme-challenge.example.net. TXT 0"},
+	})
+}
+
+func TestBaiduFake(t *testing.T) {
+	testSigned(t, "baidu", func(d dns.DNS, secret string) {
+		d.(*dns.Baidu).SecretKey = secret
+	})
+}
+
+// TestRoute53Fake checks that a record set is upserted while it has values
+// and deleted with the last one, the zones and record sets are more than a
+// page, so that they are listed by IsTruncated and the next marker or
+// record name.
+func TestRoute53Fake(t *testing.T) {
+	testSigned(t, "route53", func(d dns.DNS, secret string) {
+		d.(*dns.Route53).SecretAccessKey = secret
+	})
+	s, d := testRecordSets(t, "route53", [][]string{
+		{"UPSERT _acme-challenge.example.net. TXT 1"},
+		{"UPSERT _acme-challenge.example.net. TXT 2"},
+		{"UPSERT _acme-challenge.example.net. TXT 1"},
+		{"DELETE _acme-challenge.example.net. TXT 0"},
+	})
+	s.PageSize = 1
+	domains, err := d.GetListOfDomains()
+	if want := []string{"example.com", "example.net", "example.org"}; err != nil || !reflect.DeepEqual(domains, want) {
+		t.Errorf("domains are %q (%v), want %q", domains, err, want)
+	}
+	for _, value := range []string{"a", "b"} {
+		if _, err := d.AddNewRecord("example.net", "_x", "TXT", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := d.GetRecords("example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Name+" "+r.Type+" "+r.Content)
+	}
+	// the labels are sorted in reverse, so www is after _x
+	want := []string{"@ A 192.0.2.1", "_x TXT a", "_x TXT b", "www CNAME example.net."}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("records are %q, want %q", names, want)
+	}
+}
+
+// TestGoogleCloudFake checks that the service account gets a token and a
+// record set is replaced by a deletion and an addition in one change.
+func TestGoogleCloudFake(t *testing.T) {
+	s, d := newFake(t, "gcloud")
+	if err := dnstest.Run(d, "example.net"); err != nil {
+		t.Fatal(err)
+	}
+	testRecordSets(t, "gcloud", [][]string{
+		{"addition _acme-challenge.example.net. TXT 1"},
+		{"deletion _acme-challenge.example.net. TXT 0", "addition _acme-challenge.example.net. TXT 2"},
+		{"deletion _acme-challenge.example.net. TXT 0", "addition _acme-challenge.example.net. TXT 1"},
+		{"deletion _acme-challenge.example.net. TXT 0"},
+	})
+
+	// a token can't be got with another key
+	other, _ := newFake(t, "gcloud")
+	g := dnstest.Fakes["gcloud"](s).(*dns.GoogleCloud)
+	g.PrivateKey = dnstest.Fakes["gcloud"](other).(*dns.GoogleCloud).PrivateKey
+	if _, err := g.GetListOfDomains(); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("JWT of another key is not refused: %v", err)
+	}
+}
+
+// TestDNSPodFake checks that an error in the response of the status 200,
+// like a bad signature, is an error.
+func TestDNSPodFake(t *testing.T) {
+	_, d := newFake(t, "dnspod")
+	if err := dnstest.Run(d, "example.net"); err != nil {
+		t.Fatal(err)
+	}
+	d.(*dns.DNSPod).SecretKey += "x"
+	if _, err := d.GetListOfDomains(); err == nil || !strings.Contains(err.Error(), "AuthFailure.SignatureFailure") {
+		t.Errorf("bad signature is not refused: %v", err)
+	}
+}
+
+// TestAcmeDNSFake checks that the accounts registered and saved by one
+// AcmeDNS are used by another one with the same storage, and that an update
+// needs the password of the account.
+func TestAcmeDNSFake(t *testing.T) {
+	s, d := newFake(t, "acmedns")
+	a := d.(*dns.AcmeDNS)
+	account, err := a.Register("example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := strings.Repeat("a", 43)
+	b := dnstest.Fakes["acmedns"](s).(*dns.AcmeDNS)
+	if _, err := b.AddNewRecord("example.com", account.SubDomain, "TXT", value); err == nil {
+		t.Error("updated a record without the storage")
+	}
+	p, err := dns.Lookup("acmedns").New(dns.Options{"url": s.URL, "storage": a.Storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddNewRecord("example.com", account.SubDomain, "TXT", value); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Values("example.com", account.SubDomain, "TXT"); !reflect.DeepEqual(got, []string{value}) {
+		t.Errorf("values are %q", got)
+	}
+	account.Password += "x"
+	if _, err := a.AddNewRecord("example.com", account.SubDomain, "TXT", value); err == nil || !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("bad password is not refused: %v", err)
+	}
+}
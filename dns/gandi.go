@@ -0,0 +1,224 @@
+package dns
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+type (
+	// Gandi uses the API of Gandi LiveDNS. A record set of Gandi has all
+	// values of a name and type, the ID of a record is its name, type and
+	// quoted content.
+	Gandi struct {
+		// Token is a personal access token, or an API key if APIKey is true
+		Token  string
+		APIKey bool
+		// Endpoint is https://api.gandi.net/v5/livedns by default
+		Endpoint string
+		TTL      int
+		Client   *http.Client
+	}
+
+	gandiRRSet struct {
+		Name   string   `json:"rrset_name,omitempty"`
+		Type   string   `json:"rrset_type,omitempty"`
+		TTL    int      `json:"rrset_ttl,omitempty"`
+		Values []string `json:"rrset_values"`
+	}
+)
+
+var _ DNS = (*Gandi)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "gandi",
+		Options: []Option{
+			{Name: "token", Type: OptionString, Required: true},
+			{Name: "api_key", Type: OptionBool},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &Gandi{
+				Token:    o.String("token"),
+				APIKey:   o.Bool("api_key"),
+				Endpoint: o.String("endpoint"),
+				TTL:      o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewGandiFromEnv()
+		},
+	})
+}
+
+// NewGandiFromEnv returns a Gandi configured by the environment variable
+// GANDI_PAT, or the deprecated GANDI_API_KEY.
+func NewGandiFromEnv() (*Gandi, error) {
+	g := &Gandi{Token: os.Getenv("GANDI_PAT")}
+	if g.Token == "" {
+		g.Token, g.APIKey = os.Getenv("GANDI_API_KEY"), true
+	}
+	if g.Token == "" {
+		return nil, errors.New("gandi: please set GANDI_PAT")
+	}
+	return g, nil
+}
+
+// api returns the API, Gandi has no total in the list responses, a list
+// ends with an empty page.
+func (g *Gandi) api() restAPI {
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.gandi.net/v5/livedns"
+	}
+	authorization := "Bearer " + g.Token
+	if g.APIKey {
+		authorization = "Apikey " + g.Token
+	}
+	return restAPI{
+		name:      "gandi",
+		endpoint:  endpoint,
+		header:    http.Header{"Authorization": {authorization}},
+		client:    g.Client,
+		pageParam: "page",
+		sizeParam: "per_page",
+		pageSize:  100,
+	}
+}
+
+func (g *Gandi) GetListOfDomains() ([]string, error) {
+	domains := []string{}
+	var result []struct {
+		FQDN string `json:"fqdn"`
+	}
+	err := g.api().list("/domains", nil, func() interface{} {
+		result = nil
+		return &result
+	}, func(int) bool {
+		for _, d := range result {
+			domains = append(domains, d.FQDN)
+		}
+		return len(result) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (g *Gandi) GetRecords(domain string) (records []Record, err error) {
+	var result []gandiRRSet
+	err = g.api().list("/domains/"+url.PathEscape(domain)+"/records", nil, func() interface{} {
+		result = nil
+		return &result
+	}, func(int) bool {
+		for _, rrset := range result {
+			fullName := domain
+			if rrset.Name != "@" {
+				fullName = rrset.Name + "." + fullName
+			}
+			for _, value := range rrset.Values {
+				content := unquoteTXT(rrset.Type, value)
+				records = append(records, Record{
+					Id:       recordId(rrset.Name, rrset.Type, content),
+					Type:     rrset.Type,
+					Name:     rrset.Name,
+					FullName: fullName,
+					Content:  content,
+				})
+			}
+		}
+		return len(result) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (g *Gandi) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	rrset, err := g.getRRSet(domain, dname, dtype)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, value := range rrset.Values {
+		ids = append(ids, recordId(dname, dtype, unquoteTXT(dtype, value)))
+	}
+	return ids, nil
+}
+
+func gandiRRSetPath(domain, dname, dtype string) string {
+	return "/domains/" + url.PathEscape(domain) + "/records/" + url.PathEscape(dname) + "/" + url.PathEscape(dtype)
+}
+
+// getRRSet returns the record set of the name and type, or an empty one.
+func (g *Gandi) getRRSet(domain, dname, dtype string) (*gandiRRSet, error) {
+	var rrset gandiRRSet
+	err := g.api().do("GET", gandiRRSetPath(domain, dname, dtype), nil, nil, &rrset)
+	if isNotFound(err) {
+		return &gandiRRSet{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rrset, nil
+}
+
+// AddNewRecord adds the value to the record set of the name and type.
+func (g *Gandi) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	rrset, err := g.getRRSet(domain, dname, dtype)
+	if err != nil {
+		return "", err
+	}
+	id := recordId(dname, dtype, dvalue)
+	for _, value := range rrset.Values {
+		if unquoteTXT(dtype, value) == dvalue {
+			return id, nil
+		}
+	}
+	body := gandiRRSet{
+		TTL:    rrset.TTL,
+		Values: append(rrset.Values, quoteTXT(dtype, dvalue)),
+	}
+	if body.TTL == 0 {
+		body.TTL = g.TTL
+	}
+	if body.TTL == 0 {
+		body.TTL = 300
+	}
+	if err := g.api().do("PUT", gandiRRSetPath(domain, dname, dtype), nil, body, nil); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DeleteRecord removes the value from the record set, or deletes the record
+// set if it is the last value.
+func (g *Gandi) DeleteRecord(domain, id string) error {
+	dname, dtype, content, err := parseRecordId(id)
+	if err != nil {
+		return errors.New("gandi: " + err.Error())
+	}
+	rrset, err := g.getRRSet(domain, dname, dtype)
+	if err != nil {
+		return err
+	}
+	var values []string
+	for _, value := range rrset.Values {
+		if unquoteTXT(dtype, value) != content {
+			values = append(values, value)
+		}
+	}
+	if len(values) == len(rrset.Values) {
+		return errors.New("gandi: no record " + id)
+	}
+	if len(values) == 0 {
+		return g.api().do("DELETE", gandiRRSetPath(domain, dname, dtype), nil, nil, nil)
+	}
+	body := gandiRRSet{TTL: rrset.TTL, Values: values}
+	return g.api().do("PUT", gandiRRSetPath(domain, dname, dtype), nil, body, nil)
+}
@@ -0,0 +1,497 @@
+package dns
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// GoogleCloud uses the API of Google Cloud DNS, authorized with the
+	// access tokens of a service account. A record set of Google Cloud DNS
+	// has all values of a name and type, the ID of a record is its name, type
+	// and quoted content.
+	GoogleCloud struct {
+		Project     string
+		ClientEmail string
+		PrivateKey  *rsa.PrivateKey
+		// TokenURL is https://oauth2.googleapis.com/token by default
+		TokenURL string
+		// Endpoint is https://dns.googleapis.com/dns/v1 by default
+		Endpoint string
+		TTL      int
+		// Wait waits until changes are done, up to WaitTimeout (2 minutes by
+		// default)
+		Wait        bool
+		WaitTimeout time.Duration
+		Client      *http.Client
+
+		mu          sync.Mutex
+		accessToken string
+		expiry      time.Time
+	}
+
+	googleZone struct {
+		Name       string `json:"name"`
+		DNSName    string `json:"dnsName"`
+		Visibility string `json:"visibility"`
+	}
+
+	googleRRSet struct {
+		Name    string   `json:"name"`
+		Type    string   `json:"type"`
+		TTL     int      `json:"ttl,omitempty"`
+		RRDatas []string `json:"rrdatas"`
+	}
+
+	googleChange struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	}
+)
+
+const (
+	googleScope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+	// googlePollInterval is the interval to check the status of a change
+	googlePollInterval = 2 * time.Second
+)
+
+var _ DNS = (*GoogleCloud)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "gcloud",
+		Options: []Option{
+			{Name: "credentials", Type: OptionString, Required: true},
+			{Name: "project", Type: OptionString},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+			{Name: "wait", Type: OptionBool},
+			{Name: "wait_timeout", Type: OptionDuration},
+		},
+		New: func(o Options) (DNS, error) {
+			g, err := newGoogleCloudFromFile(o.String("credentials"))
+			if err != nil {
+				return nil, err
+			}
+			if project := o.String("project"); project != "" {
+				g.Project = project
+			}
+			g.Endpoint = o.String("endpoint")
+			g.TTL = o.Int("ttl")
+			g.Wait = o.Bool("wait")
+			g.WaitTimeout = o.Duration("wait_timeout")
+			return g, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewGoogleCloudFromEnv()
+		},
+	})
+}
+
+// NewGoogleCloudFromEnv returns a GoogleCloud configured by the service
+// account key file in the environment variable GOOGLE_APPLICATION_CREDENTIALS,
+// and optionally GOOGLE_CLOUD_PROJECT (default the project of the key),
+// GOOGLE_DNS_ENDPOINT and GOOGLE_DNS_WAIT.
+func NewGoogleCloudFromEnv() (*GoogleCloud, error) {
+	file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if file == "" {
+		return nil, errors.New("gcloud: please set GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	g, err := newGoogleCloudFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+		g.Project = project
+	}
+	g.Endpoint = os.Getenv("GOOGLE_DNS_ENDPOINT")
+	if wait := os.Getenv("GOOGLE_DNS_WAIT"); wait != "" {
+		if g.Wait, err = strconv.ParseBool(wait); err != nil {
+			return nil, errors.New("gcloud: bad GOOGLE_DNS_WAIT " + wait)
+		}
+	}
+	return g, nil
+}
+
+// newGoogleCloudFromFile returns a GoogleCloud with the service account key
+// file.
+func newGoogleCloudFromFile(file string) (*GoogleCloud, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New("gcloud: " + err.Error())
+	}
+	return NewGoogleCloudFromKey(content)
+}
+
+// NewGoogleCloudFromKey returns a GoogleCloud with the JSON key of a service
+// account.
+func NewGoogleCloudFromKey(content []byte) (*GoogleCloud, error) {
+	var key struct {
+		Type        string `json:"type"`
+		ProjectId   string `json:"project_id"`
+		PrivateKey  string `json:"private_key"`
+		ClientEmail string `json:"client_email"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(content, &key); err != nil {
+		return nil, errors.New("gcloud: bad key: " + err.Error())
+	}
+	if key.Type != "service_account" {
+		return nil, errors.New("gcloud: the key is not of a service account")
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("gcloud: bad private key")
+	}
+	var privateKey *rsa.PrivateKey
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		var ok bool
+		if privateKey, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("gcloud: the private key is not RSA")
+		}
+	} else if privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, errors.New("gcloud: bad private key: " + err.Error())
+	}
+	return &GoogleCloud{
+		Project:     key.ProjectId,
+		ClientEmail: key.ClientEmail,
+		PrivateKey:  privateKey,
+		TokenURL:    key.TokenURI,
+	}, nil
+}
+
+// token returns the access token, a new one is requested with a signed JWT
+// if it expires in a minute.
+func (g *GoogleCloud) token() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.accessToken != "" && time.Now().Add(time.Minute).Before(g.expiry) {
+		return g.accessToken, nil
+	}
+	tokenURL := g.TokenURL
+	if tokenURL == "" {
+		tokenURL = "https://oauth2.googleapis.com/token"
+	}
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   g.ClientEmail,
+		"scope": googleScope,
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	encoding := base64.RawURLEncoding
+	jwt := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(jwt))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, g.PrivateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", errors.New("gcloud: " + err.Error())
+	}
+	jwt += "." + encoding.EncodeToString(signature)
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = doJSON(g.Client, request{
+		method: "POST",
+		url:    tokenURL,
+		header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+		body: []byte(url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {jwt},
+		}.Encode()),
+	}, &result)
+	if err != nil {
+		return "", errors.New("gcloud: " + err.Error())
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("gcloud: no access token from " + tokenURL)
+	}
+	g.accessToken = result.AccessToken
+	g.expiry = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return g.accessToken, nil
+}
+
+func (g *GoogleCloud) do(method, path string, query url.Values, body, result interface{}) error {
+	token, err := g.token()
+	if err != nil {
+		return err
+	}
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = "https://dns.googleapis.com/dns/v1"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + "/projects/" + url.PathEscape(g.Project) + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	err = doJSON(g.Client, request{
+		method: method,
+		url:    u,
+		header: http.Header{"Authorization": {"Bearer " + token}},
+		body:   body,
+	}, result)
+	if err != nil {
+		return errors.New("gcloud: " + err.Error())
+	}
+	return nil
+}
+
+// list gets the pages of a list until there is no next page token, page
+// returns the result to decode the next page into and add adds its items.
+func (g *GoogleCloud) list(path string, query url.Values, page func() interface{}, add func() string) error {
+	pageToken := ""
+	for {
+		q := url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		if err := g.do("GET", path, q, nil, page()); err != nil {
+			return err
+		}
+		if pageToken = add(); pageToken == "" {
+			return nil
+		}
+	}
+}
+
+func (g *GoogleCloud) getZones() ([]googleZone, error) {
+	var zones []googleZone
+	var result struct {
+		ManagedZones  []googleZone `json:"managedZones"`
+		NextPageToken string       `json:"nextPageToken"`
+	}
+	err := g.list("/managedZones", nil, func() interface{} {
+		result.ManagedZones, result.NextPageToken = nil, ""
+		return &result
+	}, func() string {
+		for _, z := range result.ManagedZones {
+			if z.Visibility != "private" {
+				zones = append(zones, z)
+			}
+		}
+		return result.NextPageToken
+	})
+	return zones, err
+}
+
+// zoneName returns the name of the managed zone of the domain.
+func (g *GoogleCloud) zoneName(domain string) (string, error) {
+	zones, err := g.getZones()
+	if err != nil {
+		return "", err
+	}
+	for _, z := range zones {
+		if strings.EqualFold(z.DNSName, fqdn(domain)) {
+			return z.Name, nil
+		}
+	}
+	return "", errors.New("gcloud: no zone " + domain)
+}
+
+func (g *GoogleCloud) GetListOfDomains() ([]string, error) {
+	zones, err := g.getZones()
+	if err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	for _, z := range zones {
+		domains = append(domains, strings.TrimSuffix(z.DNSName, "."))
+	}
+	return domains, nil
+}
+
+// getRRSets returns the record sets of the zone, query filters them.
+func (g *GoogleCloud) getRRSets(zone string, query url.Values) ([]googleRRSet, error) {
+	var rrsets []googleRRSet
+	var result struct {
+		RRSets        []googleRRSet `json:"rrsets"`
+		NextPageToken string        `json:"nextPageToken"`
+	}
+	err := g.list("/managedZones/"+url.PathEscape(zone)+"/rrsets", query, func() interface{} {
+		result.RRSets, result.NextPageToken = nil, ""
+		return &result
+	}, func() string {
+		rrsets = append(rrsets, result.RRSets...)
+		return result.NextPageToken
+	})
+	return rrsets, err
+}
+
+func (g *GoogleCloud) GetRecords(domain string) (records []Record, err error) {
+	zone, err := g.zoneName(domain)
+	if err != nil {
+		return nil, err
+	}
+	rrsets, err := g.getRRSets(zone, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, rrset := range rrsets {
+		name := relativeName(domain, rrset.Name)
+		for _, value := range rrset.RRDatas {
+			content := unquoteTXT(rrset.Type, value)
+			records = append(records, Record{
+				Id:       recordId(name, rrset.Type, content),
+				Type:     rrset.Type,
+				Name:     name,
+				FullName: strings.TrimSuffix(rrset.Name, "."),
+				Content:  content,
+			})
+		}
+	}
+	return
+}
+
+func (g *GoogleCloud) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	records, err := g.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range records {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+// findRRSet returns the zone name and the record set of the name and type,
+// or nil if there is none.
+func (g *GoogleCloud) findRRSet(domain, dname, dtype string) (string, *googleRRSet, error) {
+	zone, err := g.zoneName(domain)
+	if err != nil {
+		return "", nil, err
+	}
+	name := fqdn(domain)
+	if dname != "@" {
+		name = fqdn(dname + "." + domain)
+	}
+	rrsets, err := g.getRRSets(zone, url.Values{"name": {name}, "type": {dtype}})
+	if err != nil {
+		return "", nil, err
+	}
+	for _, rrset := range rrsets {
+		if strings.EqualFold(rrset.Name, name) && rrset.Type == dtype {
+			return zone, &rrset, nil
+		}
+	}
+	return zone, nil, nil
+}
+
+// change deletes and adds the record sets in a change, and waits until the
+// change is done if g.Wait.
+func (g *GoogleCloud) change(zone string, deletion, addition *googleRRSet) error {
+	body := map[string][]*googleRRSet{}
+	if deletion != nil {
+		body["deletions"] = []*googleRRSet{deletion}
+	}
+	if addition != nil {
+		body["additions"] = []*googleRRSet{addition}
+	}
+	path := "/managedZones/" + url.PathEscape(zone) + "/changes"
+	var change googleChange
+	if err := g.do("POST", path, nil, body, &change); err != nil {
+		return err
+	}
+	if !g.Wait {
+		return nil
+	}
+	timeout := g.WaitTimeout
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+	deadline := time.Now().Add(timeout)
+	for change.Status != "done" {
+		if time.Now().After(deadline) {
+			return errors.New("gcloud: change " + change.Id + " is not done after " + timeout.String())
+		}
+		time.Sleep(googlePollInterval)
+		if err := g.do("GET", path+"/"+url.PathEscape(change.Id), nil, nil, &change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddNewRecord adds the value to the record set of the name and type.
+func (g *GoogleCloud) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	zone, rrset, err := g.findRRSet(domain, dname, dtype)
+	if err != nil {
+		return "", err
+	}
+	id := recordId(dname, dtype, dvalue)
+	addition := &googleRRSet{Type: dtype, TTL: g.TTL}
+	if rrset != nil {
+		for _, value := range rrset.RRDatas {
+			if unquoteTXT(dtype, value) == dvalue {
+				return id, nil
+			}
+		}
+		addition.Name, addition.TTL = rrset.Name, rrset.TTL
+		addition.RRDatas = append(addition.RRDatas, rrset.RRDatas...)
+	} else {
+		addition.Name = fqdn(domain)
+		if dname != "@" {
+			addition.Name = fqdn(dname + "." + domain)
+		}
+	}
+	if addition.TTL == 0 {
+		addition.TTL = 300
+	}
+	addition.RRDatas = append(addition.RRDatas, quoteTXT(dtype, dvalue))
+	if err := g.change(zone, rrset, addition); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DeleteRecord removes the value from the record set, or deletes the record
+// set if it is the last value.
+func (g *GoogleCloud) DeleteRecord(domain, id string) error {
+	dname, dtype, content, err := parseRecordId(id)
+	if err != nil {
+		return errors.New("gcloud: " + err.Error())
+	}
+	zone, rrset, err := g.findRRSet(domain, dname, dtype)
+	if err != nil {
+		return err
+	}
+	var values []string
+	if rrset != nil {
+		for _, value := range rrset.RRDatas {
+			if unquoteTXT(dtype, value) != content {
+				values = append(values, value)
+			}
+		}
+	}
+	if rrset == nil || len(values) == len(rrset.RRDatas) {
+		return errors.New("gcloud: no record " + id)
+	}
+	var addition *googleRRSet
+	if len(values) > 0 {
+		addition = &googleRRSet{Name: rrset.Name, Type: dtype, TTL: rrset.TTL, RRDatas: values}
+	}
+	return g.change(zone, rrset, addition)
+}
@@ -1,3 +1,8 @@
 module github.com/caiguanhao/certutils/dns
 
 go 1.15
+
+require (
+	github.com/BurntSushi/toml v1.2.1
+	gopkg.in/yaml.v2 v2.4.0
+)
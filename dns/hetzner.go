@@ -0,0 +1,212 @@
+package dns
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type (
+	// Hetzner uses the API of Hetzner DNS.
+	Hetzner struct {
+		Token string
+		// Endpoint is https://dns.hetzner.com/api/v1 by default
+		Endpoint string
+		TTL      int
+		Client   *http.Client
+	}
+
+	hetznerRecord struct {
+		Id    string `json:"id"`
+		Type  string `json:"type"`
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	hetznerMeta struct {
+		Pagination struct {
+			LastPage int `json:"last_page"`
+		} `json:"pagination"`
+	}
+)
+
+var _ DNS = (*Hetzner)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "hetzner",
+		Options: []Option{
+			{Name: "token", Type: OptionString, Required: true},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &Hetzner{
+				Token:    o.String("token"),
+				Endpoint: o.String("endpoint"),
+				TTL:      o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewHetznerFromEnv()
+		},
+	})
+}
+
+// NewHetznerFromEnv returns a Hetzner configured by the environment variable
+// HETZNER_DNS_API_TOKEN.
+func NewHetznerFromEnv() (*Hetzner, error) {
+	h := &Hetzner{Token: os.Getenv("HETZNER_DNS_API_TOKEN")}
+	if h.Token == "" {
+		return nil, errors.New("hetzner: please set HETZNER_DNS_API_TOKEN")
+	}
+	return h, nil
+}
+
+func (h *Hetzner) api() restAPI {
+	endpoint := h.Endpoint
+	if endpoint == "" {
+		endpoint = "https://dns.hetzner.com/api/v1"
+	}
+	return restAPI{
+		name:      "hetzner",
+		endpoint:  endpoint,
+		header:    http.Header{"Auth-Api-Token": {h.Token}},
+		client:    h.Client,
+		pageParam: "page",
+		sizeParam: "per_page",
+		pageSize:  100,
+	}
+}
+
+// getZones returns the zones, name filters them if it is not empty.
+func (h *Hetzner) getZones(name string) (names, ids []string, err error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	var result struct {
+		Zones []struct {
+			Id   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"zones"`
+		Meta hetznerMeta `json:"meta"`
+	}
+	err = h.api().list("/zones", query, func() interface{} {
+		result.Zones = nil
+		return &result
+	}, func(page int) bool {
+		for _, z := range result.Zones {
+			names = append(names, z.Name)
+			ids = append(ids, z.Id)
+		}
+		return page < result.Meta.Pagination.LastPage
+	})
+	return
+}
+
+func (h *Hetzner) zoneId(domain string) (string, error) {
+	names, ids, err := h.getZones(domain)
+	if err != nil {
+		return "", err
+	}
+	for i, name := range names {
+		if strings.EqualFold(name, domain) {
+			return ids[i], nil
+		}
+	}
+	return "", errors.New("hetzner: no zone " + domain)
+}
+
+func (h *Hetzner) GetListOfDomains() ([]string, error) {
+	names, _, err := h.getZones("")
+	if err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	return append(domains, names...), nil
+}
+
+func (h *Hetzner) getRecords(domain string) ([]hetznerRecord, error) {
+	zoneId, err := h.zoneId(domain)
+	if err != nil {
+		return nil, err
+	}
+	var records []hetznerRecord
+	var result struct {
+		Records []hetznerRecord `json:"records"`
+		Meta    hetznerMeta     `json:"meta"`
+	}
+	err = h.api().list("/records", url.Values{"zone_id": {zoneId}}, func() interface{} {
+		result.Records = nil
+		return &result
+	}, func(page int) bool {
+		records = append(records, result.Records...)
+		return page < result.Meta.Pagination.LastPage
+	})
+	return records, err
+}
+
+func (h *Hetzner) GetRecords(domain string) (records []Record, err error) {
+	list, err := h.getRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		fullName := domain
+		if r.Name != "@" {
+			fullName = r.Name + "." + fullName
+		}
+		records = append(records, Record{
+			Id:       r.Id,
+			Type:     r.Type,
+			Name:     r.Name,
+			FullName: fullName,
+			Content:  unquoteTXT(r.Type, r.Value),
+		})
+	}
+	return
+}
+
+func (h *Hetzner) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	list, err := h.getRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range list {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+func (h *Hetzner) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	zoneId, err := h.zoneId(domain)
+	if err != nil {
+		return "", err
+	}
+	body := map[string]interface{}{
+		"zone_id": zoneId,
+		"type":    dtype,
+		"name":    dname,
+		"value":   dvalue,
+	}
+	if h.TTL > 0 {
+		body["ttl"] = h.TTL
+	}
+	var result struct {
+		Record hetznerRecord `json:"record"`
+	}
+	if err := h.api().do("POST", "/records", nil, body, &result); err != nil {
+		return "", err
+	}
+	return result.Record.Id, nil
+}
+
+func (h *Hetzner) DeleteRecord(domain, id string) error {
+	return h.api().do("DELETE", "/records/"+url.PathEscape(id), nil, nil, nil)
+}
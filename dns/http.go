@@ -0,0 +1,225 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// httpClient is the default client of the providers with HTTP APIs.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// httpError is the error of a response which is not 2xx.
+type httpError struct {
+	Method, URL string
+	StatusCode  int
+	Status      string
+	Body        string
+}
+
+func (e *httpError) Error() string {
+	msg := e.Method + " " + e.URL + ": " + e.Status
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// request is a request of an HTTP API.
+type request struct {
+	method string
+	url    string
+	header http.Header
+	// body is sent as JSON unless it is []byte
+	body interface{}
+	// sign is called before the request is sent
+	sign func(req *http.Request, body []byte) error
+}
+
+// doJSON sends the request and decodes the JSON response into result, which
+// can be nil.
+func doJSON(client *http.Client, r request, result interface{}) error {
+	if r.header.Get("Accept") == "" {
+		r.header = cloneHeader(r.header)
+		r.header.Set("Accept", "application/json")
+	}
+	content, err := send(client, r)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("%s %s: %w", r.method, r.url, err)
+	}
+	return nil
+}
+
+// doXML is doJSON for XML APIs, the body is sent as XML unless it is []byte.
+func doXML(client *http.Client, r request, result interface{}) error {
+	if r.body != nil {
+		if _, ok := r.body.([]byte); !ok {
+			body, err := xml.Marshal(r.body)
+			if err != nil {
+				return err
+			}
+			r.body = append([]byte(xml.Header), body...)
+		}
+		if r.header.Get("Content-Type") == "" {
+			r.header = cloneHeader(r.header)
+			r.header.Set("Content-Type", "application/xml")
+		}
+	}
+	content, err := send(client, r)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+	if err := xml.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("%s %s: %w", r.method, r.url, err)
+	}
+	return nil
+}
+
+func cloneHeader(header http.Header) http.Header {
+	if header == nil {
+		return http.Header{}
+	}
+	return header.Clone()
+}
+
+// send sends the request and returns the content of the response, the body
+// is sent as JSON unless it is []byte.
+func send(client *http.Client, r request) ([]byte, error) {
+	if client == nil {
+		client = httpClient
+	}
+	var body []byte
+	switch b := r.body.(type) {
+	case nil:
+	case []byte:
+		body = b
+	default:
+		var err error
+		if body, err = json.Marshal(b); err != nil {
+			return nil, err
+		}
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(r.method, r.url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.sign != nil {
+		if err := r.sign(req, body); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &httpError{
+			Method:     r.method,
+			URL:        r.url,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(content)),
+		}
+	}
+	return content, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// uriEncode encodes s as in the canonical requests of request signing, all
+// bytes except A-Z, a-z, 0-9, "-", "_", "." and "~" are percent-encoded, and
+// "/" too if encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery returns the encoded query sorted by key and value.
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// canonicalHeaders returns the lowercase names of the headers, sorted and
+// joined with ";", and the headers as "name:value" lines.
+func canonicalHeaders(req *http.Request, names []string) (signed, canonical string) {
+	var lower []string
+	for _, name := range names {
+		lower = append(lower, strings.ToLower(name))
+	}
+	sort.Strings(lower)
+	var lines []string
+	for _, name := range lower {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		lines = append(lines, name+":"+strings.TrimSpace(value))
+	}
+	return strings.Join(lower, ";"), strings.Join(lines, "\n")
+}
@@ -0,0 +1,347 @@
+package dns
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Huawei uses the DNS API of Huawei Cloud, signed with AK/SK
+	// (SDK-HMAC-SHA256). A record set of Huawei Cloud has all values of a
+	// name and type, the ID of a record is its name, type and quoted content.
+	Huawei struct {
+		AccessKey string
+		SecretKey string
+		// ProjectId is only needed by regional endpoints
+		ProjectId string
+		// Endpoint is https://dns.myhuaweicloud.com by default
+		Endpoint string
+		TTL      int
+		Client   *http.Client
+	}
+
+	huaweiZone struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	huaweiRecordSet struct {
+		Id      string   `json:"id,omitempty"`
+		Name    string   `json:"name"`
+		Type    string   `json:"type"`
+		TTL     int      `json:"ttl,omitempty"`
+		Records []string `json:"records"`
+	}
+)
+
+// huaweiPageSize is the most items of a page the API returns
+const huaweiPageSize = 500
+
+var _ DNS = (*Huawei)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "huawei",
+		Options: []Option{
+			{Name: "access_key", Type: OptionString, Required: true},
+			{Name: "secret_key", Type: OptionString, Required: true},
+			{Name: "project_id", Type: OptionString},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &Huawei{
+				AccessKey: o.String("access_key"),
+				SecretKey: o.String("secret_key"),
+				ProjectId: o.String("project_id"),
+				Endpoint:  o.String("endpoint"),
+				TTL:       o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewHuaweiFromEnv()
+		},
+	})
+}
+
+// NewHuaweiFromEnv returns a Huawei configured by the environment variables
+// HUAWEICLOUD_ACCESS_KEY_ID, HUAWEICLOUD_SECRET_ACCESS_KEY and optionally
+// HUAWEICLOUD_PROJECT_ID and HUAWEICLOUD_DNS_ENDPOINT.
+func NewHuaweiFromEnv() (*Huawei, error) {
+	h := &Huawei{
+		AccessKey: os.Getenv("HUAWEICLOUD_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("HUAWEICLOUD_SECRET_ACCESS_KEY"),
+		ProjectId: os.Getenv("HUAWEICLOUD_PROJECT_ID"),
+		Endpoint:  os.Getenv("HUAWEICLOUD_DNS_ENDPOINT"),
+	}
+	if h.AccessKey == "" || h.SecretKey == "" {
+		return nil, errors.New("huawei: please set HUAWEICLOUD_ACCESS_KEY_ID and HUAWEICLOUD_SECRET_ACCESS_KEY")
+	}
+	return h, nil
+}
+
+// sign signs a request with SDK-HMAC-SHA256.
+func (h *Huawei) sign(req *http.Request, body []byte) error {
+	return h.signAt(req, body, time.Now())
+}
+
+// signAt signs a request at the time t, the Content-Type header is signed
+// if there is one.
+func (h *Huawei) signAt(req *http.Request, body []byte, t time.Time) error {
+	date := t.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Sdk-Date", date)
+	names := []string{"host", "x-sdk-date"}
+	if req.Header.Get("Content-Type") != "" {
+		names = append(names, "content-type")
+	}
+	if h.ProjectId != "" {
+		req.Header.Set("X-Project-Id", h.ProjectId)
+		names = append(names, "x-project-id")
+	}
+	signedHeaders, headers := canonicalHeaders(req, names)
+
+	// the canonical URI ends with "/"
+	uri := uriEncode(req.URL.Path, false)
+	if !strings.HasSuffix(uri, "/") {
+		uri += "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		canonicalQuery(req.URL.Query()),
+		headers + "\n",
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+	stringToSign := "SDK-HMAC-SHA256\n" + date + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256([]byte(h.SecretKey), stringToSign))
+	req.Header.Set("Authorization", "SDK-HMAC-SHA256 Access="+h.AccessKey+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+func (h *Huawei) do(method, path string, query url.Values, body, result interface{}) error {
+	endpoint := h.Endpoint
+	if endpoint == "" {
+		endpoint = "https://dns.myhuaweicloud.com"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	err := doJSON(h.Client, request{method: method, url: u, body: body, sign: h.sign}, result)
+	if err != nil {
+		return errors.New("huawei: " + err.Error())
+	}
+	return nil
+}
+
+// list gets the pages of a list until all items are read, add adds the
+// items of a page and returns their number and the total. The next page
+// starts after the items read, as a page can have fewer than the limit.
+func (h *Huawei) list(path string, query url.Values, page func() interface{}, add func() (int, int)) error {
+	for offset := 0; ; {
+		q := url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		q.Set("limit", strconv.Itoa(huaweiPageSize))
+		q.Set("offset", strconv.Itoa(offset))
+		if err := h.do("GET", path, q, nil, page()); err != nil {
+			return err
+		}
+		n, total := add()
+		offset += n
+		if n == 0 || offset >= total {
+			return nil
+		}
+	}
+}
+
+func (h *Huawei) getZones() ([]huaweiZone, error) {
+	var zones []huaweiZone
+	var result struct {
+		Zones    []huaweiZone `json:"zones"`
+		Metadata struct {
+			TotalCount int `json:"total_count"`
+		} `json:"metadata"`
+	}
+	err := h.list("/v2/zones", url.Values{"type": {"public"}}, func() interface{} {
+		result.Zones = nil
+		return &result
+	}, func() (int, int) {
+		zones = append(zones, result.Zones...)
+		return len(result.Zones), result.Metadata.TotalCount
+	})
+	return zones, err
+}
+
+func (h *Huawei) zoneId(domain string) (string, error) {
+	zones, err := h.getZones()
+	if err != nil {
+		return "", err
+	}
+	for _, z := range zones {
+		if strings.EqualFold(strings.TrimSuffix(z.Name, "."), domain) {
+			return z.Id, nil
+		}
+	}
+	return "", errors.New("huawei: no zone " + domain)
+}
+
+func (h *Huawei) GetListOfDomains() ([]string, error) {
+	zones, err := h.getZones()
+	if err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	for _, z := range zones {
+		domains = append(domains, strings.TrimSuffix(z.Name, "."))
+	}
+	return domains, nil
+}
+
+// getRecordSets returns the record sets of the zone, query filters them.
+func (h *Huawei) getRecordSets(zoneId string, query url.Values) ([]huaweiRecordSet, error) {
+	var sets []huaweiRecordSet
+	var result struct {
+		RecordSets []huaweiRecordSet `json:"recordsets"`
+		Metadata   struct {
+			TotalCount int `json:"total_count"`
+		} `json:"metadata"`
+	}
+	err := h.list("/v2/zones/"+zoneId+"/recordsets", query, func() interface{} {
+		result.RecordSets = nil
+		return &result
+	}, func() (int, int) {
+		sets = append(sets, result.RecordSets...)
+		return len(result.RecordSets), result.Metadata.TotalCount
+	})
+	return sets, err
+}
+
+func (h *Huawei) GetRecords(domain string) (records []Record, err error) {
+	zoneId, err := h.zoneId(domain)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := h.getRecordSets(zoneId, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, set := range sets {
+		name := relativeName(domain, set.Name)
+		for _, value := range set.Records {
+			content := unquoteTXT(set.Type, value)
+			records = append(records, Record{
+				Id:       recordId(name, set.Type, content),
+				Type:     set.Type,
+				Name:     name,
+				FullName: strings.TrimSuffix(set.Name, "."),
+				Content:  content,
+			})
+		}
+	}
+	return
+}
+
+func (h *Huawei) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	records, err := h.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range records {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+// findRecordSet returns the zone ID and the record set of the name and type,
+// or an empty record set.
+func (h *Huawei) findRecordSet(domain, dname, dtype string) (string, *huaweiRecordSet, error) {
+	zoneId, err := h.zoneId(domain)
+	if err != nil {
+		return "", nil, err
+	}
+	name := fqdn(domain)
+	if dname != "@" {
+		name = fqdn(dname + "." + domain)
+	}
+	sets, err := h.getRecordSets(zoneId, url.Values{"name": {name}, "type": {dtype}})
+	if err != nil {
+		return "", nil, err
+	}
+	for _, set := range sets {
+		if strings.EqualFold(set.Name, name) && set.Type == dtype {
+			return zoneId, &set, nil
+		}
+	}
+	return zoneId, &huaweiRecordSet{Name: name, Type: dtype}, nil
+}
+
+// AddNewRecord adds the value to the record set of the name and type.
+func (h *Huawei) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	zoneId, set, err := h.findRecordSet(domain, dname, dtype)
+	if err != nil {
+		return "", err
+	}
+	id := recordId(dname, dtype, dvalue)
+	for _, value := range set.Records {
+		if unquoteTXT(dtype, value) == dvalue {
+			return id, nil
+		}
+	}
+	set.Records = append(set.Records, quoteTXT(dtype, dvalue))
+	if set.TTL == 0 {
+		set.TTL = h.TTL
+	}
+	if set.TTL == 0 {
+		set.TTL = 300
+	}
+	if set.Id == "" {
+		err = h.do("POST", "/v2/zones/"+zoneId+"/recordsets", nil, set, nil)
+	} else {
+		err = h.do("PUT", "/v2/zones/"+zoneId+"/recordsets/"+set.Id, nil,
+			map[string]interface{}{"records": set.Records, "ttl": set.TTL}, nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DeleteRecord removes the value from the record set, or deletes the record
+// set if it is the last value.
+func (h *Huawei) DeleteRecord(domain, id string) error {
+	dname, dtype, content, err := parseRecordId(id)
+	if err != nil {
+		return errors.New("huawei: " + err.Error())
+	}
+	zoneId, set, err := h.findRecordSet(domain, dname, dtype)
+	if err != nil {
+		return err
+	}
+	var values []string
+	for _, value := range set.Records {
+		if unquoteTXT(dtype, value) != content {
+			values = append(values, value)
+		}
+	}
+	if set.Id == "" || len(values) == len(set.Records) {
+		return errors.New("huawei: no record " + id)
+	}
+	if len(values) == 0 {
+		return h.do("DELETE", "/v2/zones/"+zoneId+"/recordsets/"+set.Id, nil, nil, nil)
+	}
+	return h.do("PUT", "/v2/zones/"+zoneId+"/recordsets/"+set.Id, nil,
+		map[string]interface{}{"records": values, "ttl": set.TTL}, nil)
+}
@@ -0,0 +1,29 @@
+package dns
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestHuaweiSign checks the signature of the example in the documentation of
+// Huawei Cloud API signing (AK/SK authentication).
+func TestHuaweiSign(t *testing.T) {
+	h := &Huawei{AccessKey: "QTWAOYTTINDUT2QVKYUC", SecretKey: "MFyfvK41ba2giqM7Uio6PznpdUKGpownRZlmVmHc"}
+	req, err := http.NewRequest("GET", "https://service.region.example.com/v1/77b6a44cba5143ab91d13ab9a8ff44fd/vpcs?limit=2&marker=13551d6b-755d-4757-b956-536f674975c0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := h.signAt(req, nil, time.Date(2019, 11, 15, 3, 36, 55, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Sdk-Date"); got != "20191115T033655Z" {
+		t.Errorf("X-Sdk-Date is %s", got)
+	}
+	want := "SDK-HMAC-SHA256 Access=QTWAOYTTINDUT2QVKYUC, SignedHeaders=content-type;host;x-sdk-date, " +
+		"Signature=7be6668032f70418fcc22abc52071e57aff61b84a1d2381bb430d6870f4f6ebe"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization is\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package dns
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Linode uses the Domains API of Linode (Akamai). The name of the records
+	// at the apex is empty in Linode, it is "@" as in the other providers.
+	Linode struct {
+		Token string
+		// Endpoint is https://api.linode.com/v4 by default
+		Endpoint string
+		TTL      int
+		Client   *http.Client
+	}
+
+	linodeDomain struct {
+		Id     int64  `json:"id"`
+		Domain string `json:"domain"`
+		Type   string `json:"type"`
+	}
+
+	linodeRecord struct {
+		Id     int64  `json:"id"`
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		Target string `json:"target"`
+	}
+)
+
+var _ DNS = (*Linode)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "linode",
+		Options: []Option{
+			{Name: "token", Type: OptionString, Required: true},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &Linode{
+				Token:    o.String("token"),
+				Endpoint: o.String("endpoint"),
+				TTL:      o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewLinodeFromEnv()
+		},
+	})
+}
+
+// NewLinodeFromEnv returns a Linode configured by the environment variable
+// LINODE_TOKEN.
+func NewLinodeFromEnv() (*Linode, error) {
+	l := &Linode{Token: os.Getenv("LINODE_TOKEN")}
+	if l.Token == "" {
+		return nil, errors.New("linode: please set LINODE_TOKEN")
+	}
+	return l, nil
+}
+
+func (l *Linode) api() restAPI {
+	endpoint := l.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.linode.com/v4"
+	}
+	return restAPI{
+		name:      "linode",
+		endpoint:  endpoint,
+		header:    http.Header{"Authorization": {"Bearer " + l.Token}},
+		client:    l.Client,
+		pageParam: "page",
+		sizeParam: "page_size",
+		pageSize:  500,
+	}
+}
+
+// getDomains returns the master domains, the domains of slave zones can't
+// be changed.
+func (l *Linode) getDomains() ([]linodeDomain, error) {
+	var domains []linodeDomain
+	var result struct {
+		Data  []linodeDomain `json:"data"`
+		Pages int            `json:"pages"`
+	}
+	err := l.api().list("/domains", nil, func() interface{} {
+		result.Data = nil
+		return &result
+	}, func(page int) bool {
+		for _, d := range result.Data {
+			if d.Type == "master" {
+				domains = append(domains, d)
+			}
+		}
+		return page < result.Pages
+	})
+	return domains, err
+}
+
+func (l *Linode) domainId(domain string) (string, error) {
+	domains, err := l.getDomains()
+	if err != nil {
+		return "", err
+	}
+	for _, d := range domains {
+		if strings.EqualFold(d.Domain, domain) {
+			return strconv.FormatInt(d.Id, 10), nil
+		}
+	}
+	return "", errors.New("linode: no domain " + domain)
+}
+
+func (l *Linode) GetListOfDomains() ([]string, error) {
+	list, err := l.getDomains()
+	if err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	for _, d := range list {
+		domains = append(domains, d.Domain)
+	}
+	return domains, nil
+}
+
+func (l *Linode) getRecords(domain string) ([]linodeRecord, error) {
+	domainId, err := l.domainId(domain)
+	if err != nil {
+		return nil, err
+	}
+	var records []linodeRecord
+	var result struct {
+		Data  []linodeRecord `json:"data"`
+		Pages int            `json:"pages"`
+	}
+	err = l.api().list("/domains/"+domainId+"/records", nil, func() interface{} {
+		result.Data = nil
+		return &result
+	}, func(page int) bool {
+		for _, r := range result.Data {
+			if r.Name == "" {
+				r.Name = "@"
+			}
+			records = append(records, r)
+		}
+		return page < result.Pages
+	})
+	return records, err
+}
+
+func (l *Linode) GetRecords(domain string) (records []Record, err error) {
+	list, err := l.getRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		fullName := domain
+		if r.Name != "@" {
+			fullName = r.Name + "." + fullName
+		}
+		records = append(records, Record{
+			Id:       strconv.FormatInt(r.Id, 10),
+			Type:     r.Type,
+			Name:     r.Name,
+			FullName: fullName,
+			Content:  r.Target,
+		})
+	}
+	return
+}
+
+func (l *Linode) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	list, err := l.getRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range list {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, strconv.FormatInt(r.Id, 10))
+		}
+	}
+	return ids, nil
+}
+
+func (l *Linode) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	domainId, err := l.domainId(domain)
+	if err != nil {
+		return "", err
+	}
+	name := dname
+	if name == "@" {
+		name = ""
+	}
+	body := map[string]interface{}{
+		"type":   dtype,
+		"name":   name,
+		"target": dvalue,
+	}
+	if l.TTL > 0 {
+		body["ttl_sec"] = l.TTL
+	}
+	var result linodeRecord
+	if err := l.api().do("POST", "/domains/"+domainId+"/records", nil, body, &result); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(result.Id, 10), nil
+}
+
+func (l *Linode) DeleteRecord(domain, id string) error {
+	domainId, err := l.domainId(domain)
+	if err != nil {
+		return err
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return errors.New("linode: bad record id " + id)
+	}
+	return l.api().do("DELETE", "/domains/"+domainId+"/records/"+id, nil, nil, nil)
+}
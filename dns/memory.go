@@ -0,0 +1,202 @@
+package dns
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps zones and records in memory, for tests of the users of DNS.
+// It can inject faults: latency, errors of the next calls and lists which
+// stop after some pages, like a provider with broken pagination.
+type Memory struct {
+	mu      sync.Mutex
+	zones   map[string][]Record
+	nextId  int
+	latency time.Duration
+	errors  map[string][]error
+	calls   map[string]int
+
+	// pageSize and maxPages truncate lists to maxPages pages of pageSize
+	pageSize, maxPages int
+}
+
+var _ DNS = (*Memory)(nil)
+
+// NewMemory returns a Memory with the zones, which have no records.
+func NewMemory(zones ...string) *Memory {
+	m := &Memory{
+		zones:  map[string][]Record{},
+		errors: map[string][]error{},
+		calls:  map[string]int{},
+	}
+	for _, zone := range zones {
+		m.zones[zone] = nil
+	}
+	return m
+}
+
+// SetLatency makes every call take d longer.
+func (m *Memory) SetLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency = d
+}
+
+// FailNext makes the next calls of the method op (like "AddNewRecord")
+// return the errors, one for each call.
+func (m *Memory) FailNext(op string, errs ...error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[op] = append(m.errors[op], errs...)
+}
+
+// Truncate makes lists return only the first pages of pageSize items, no
+// more than maxPages pages, as if the pagination of a provider stopped
+// early. Truncate(0, 0) returns whole lists again.
+func (m *Memory) Truncate(pageSize, maxPages int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pageSize, m.maxPages = pageSize, maxPages
+}
+
+// Calls returns the number of calls of the method op.
+func (m *Memory) Calls(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[op]
+}
+
+// Records returns all records of the zone, without faults.
+func (m *Memory) Records(zone string) []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record{}, m.zones[zone]...)
+}
+
+// call counts a call of op, waits for the latency and returns its injected
+// error. It returns with m.mu locked.
+func (m *Memory) call(op string) error {
+	m.mu.Lock()
+	m.calls[op] += 1
+	latency := m.latency
+	if latency > 0 {
+		m.mu.Unlock()
+		time.Sleep(latency)
+		m.mu.Lock()
+	}
+	if errs := m.errors[op]; len(errs) > 0 {
+		m.errors[op] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+// truncate returns the number of items of a list of n items to return.
+func (m *Memory) truncate(n int) int {
+	if m.pageSize > 0 && m.maxPages > 0 && n > m.pageSize*m.maxPages {
+		return m.pageSize * m.maxPages
+	}
+	return n
+}
+
+func (m *Memory) GetListOfDomains() ([]string, error) {
+	err := m.call("GetListOfDomains")
+	defer m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	for zone := range m.zones {
+		domains = append(domains, zone)
+	}
+	sort.Strings(domains)
+	return domains[:m.truncate(len(domains))], nil
+}
+
+func (m *Memory) zone(domain string) ([]Record, error) {
+	records, ok := m.zones[domain]
+	if !ok {
+		return nil, errors.New("memory: no zone " + domain)
+	}
+	return records, nil
+}
+
+func (m *Memory) GetRecords(domain string) ([]Record, error) {
+	err := m.call("GetRecords")
+	defer m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.zone(domain)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Record{}, records[:m.truncate(len(records))]...), nil
+}
+
+func (m *Memory) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	err := m.call("GetRecordIdsFor")
+	defer m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.zone(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range records[:m.truncate(len(records))] {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	err := m.call("AddNewRecord")
+	defer m.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if _, err := m.zone(domain); err != nil {
+		return "", err
+	}
+	fullName := domain
+	if dname != "@" {
+		fullName = dname + "." + domain
+	}
+	m.nextId += 1
+	r := Record{
+		Id:       strconv.Itoa(m.nextId),
+		Type:     strings.ToUpper(dtype),
+		Name:     dname,
+		FullName: fullName,
+		Content:  dvalue,
+	}
+	m.zones[domain] = append(m.zones[domain], r)
+	return r.Id, nil
+}
+
+func (m *Memory) DeleteRecord(domain, id string) error {
+	err := m.call("DeleteRecord")
+	defer m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	records, err := m.zone(domain)
+	if err != nil {
+		return err
+	}
+	for i, r := range records {
+		if r.Id == id {
+			m.zones[domain] = append(records[:i:i], records[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("memory: no record " + id)
+}
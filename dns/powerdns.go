@@ -0,0 +1,236 @@
+package dns
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type (
+	// PowerDNS uses the HTTP API of PowerDNS Authoritative server. PowerDNS
+	// has no record IDs, the ID of a record is its name, type and quoted
+	// content.
+	PowerDNS struct {
+		// URL is the URL of the API, like http://127.0.0.1:8081
+		URL      string
+		APIKey   string
+		ServerID string
+		TTL      int
+		Client   *http.Client
+	}
+
+	powerDNSRRSet struct {
+		Name       string           `json:"name"`
+		Type       string           `json:"type"`
+		TTL        int              `json:"ttl,omitempty"`
+		ChangeType string           `json:"changetype,omitempty"`
+		Records    []powerDNSRecord `json:"records"`
+	}
+
+	powerDNSRecord struct {
+		Content  string `json:"content"`
+		Disabled bool   `json:"disabled"`
+	}
+)
+
+var _ DNS = (*PowerDNS)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "powerdns",
+		Options: []Option{
+			{Name: "url", Type: OptionString, Required: true},
+			{Name: "api_key", Type: OptionString, Required: true},
+			{Name: "server_id", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			return &PowerDNS{
+				URL:      o.String("url"),
+				APIKey:   o.String("api_key"),
+				ServerID: o.String("server_id"),
+				TTL:      o.Int("ttl"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewPowerDNSFromEnv()
+		},
+	})
+}
+
+// NewPowerDNSFromEnv returns a PowerDNS configured by the environment
+// variables PDNS_API_URL, PDNS_API_KEY and PDNS_SERVER_ID (default
+// "localhost").
+func NewPowerDNSFromEnv() (*PowerDNS, error) {
+	p := &PowerDNS{
+		URL:      os.Getenv("PDNS_API_URL"),
+		APIKey:   os.Getenv("PDNS_API_KEY"),
+		ServerID: os.Getenv("PDNS_SERVER_ID"),
+	}
+	if p.URL == "" || p.APIKey == "" {
+		return nil, errors.New("powerdns: please set PDNS_API_URL and PDNS_API_KEY")
+	}
+	return p, nil
+}
+
+func (p *PowerDNS) do(method, path string, body, result interface{}) error {
+	server := p.ServerID
+	if server == "" {
+		server = "localhost"
+	}
+	err := doJSON(p.Client, request{
+		method: method,
+		url:    strings.TrimSuffix(p.URL, "/") + "/api/v1/servers/" + url.PathEscape(server) + path,
+		header: http.Header{"X-Api-Key": {p.APIKey}},
+		body:   body,
+	}, result)
+	if err != nil {
+		return errors.New("powerdns: " + err.Error())
+	}
+	return nil
+}
+
+// zonePath returns the path of a zone, the zone ID is its name with a dot.
+func (p *PowerDNS) zonePath(domain string) string {
+	return "/zones/" + url.PathEscape(fqdn(domain))
+}
+
+func (p *PowerDNS) GetListOfDomains() ([]string, error) {
+	var result []struct {
+		Name string `json:"name"`
+	}
+	if err := p.do("GET", "/zones", nil, &result); err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	for _, z := range result {
+		domains = append(domains, strings.TrimSuffix(z.Name, "."))
+	}
+	return domains, nil
+}
+
+func (p *PowerDNS) getRRSets(domain string) ([]powerDNSRRSet, error) {
+	var result struct {
+		RRSets []powerDNSRRSet `json:"rrsets"`
+	}
+	if err := p.do("GET", p.zonePath(domain), nil, &result); err != nil {
+		return nil, err
+	}
+	return result.RRSets, nil
+}
+
+func (p *PowerDNS) GetRecords(domain string) (records []Record, err error) {
+	rrsets, err := p.getRRSets(domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, rrset := range rrsets {
+		name := relativeName(domain, rrset.Name)
+		for _, r := range rrset.Records {
+			content := unquoteTXT(rrset.Type, r.Content)
+			records = append(records, Record{
+				Id:       recordId(name, rrset.Type, content),
+				Type:     rrset.Type,
+				Name:     name,
+				FullName: strings.TrimSuffix(rrset.Name, "."),
+				Content:  content,
+			})
+		}
+	}
+	return
+}
+
+func (p *PowerDNS) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	records, err := p.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range records {
+		if r.Name == dname && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+// findRRSet returns the RRSet of the name and type in the zone, or an
+// empty one.
+func (p *PowerDNS) findRRSet(domain, dname, dtype string) (*powerDNSRRSet, error) {
+	rrsets, err := p.getRRSets(domain)
+	if err != nil {
+		return nil, err
+	}
+	name := fqdn(domain)
+	if dname != "@" {
+		name = fqdn(dname + "." + domain)
+	}
+	for _, rrset := range rrsets {
+		if strings.EqualFold(rrset.Name, name) && rrset.Type == dtype {
+			return &rrset, nil
+		}
+	}
+	return &powerDNSRRSet{Name: name, Type: dtype}, nil
+}
+
+// patch replaces the RRSet, or deletes it if it has no records.
+func (p *PowerDNS) patch(domain string, rrset *powerDNSRRSet) error {
+	rrset.ChangeType = "REPLACE"
+	if len(rrset.Records) == 0 {
+		rrset.ChangeType = "DELETE"
+	}
+	if rrset.TTL == 0 {
+		rrset.TTL = p.TTL
+	}
+	if rrset.TTL == 0 {
+		rrset.TTL = 60
+	}
+	body := map[string][]*powerDNSRRSet{"rrsets": {rrset}}
+	return p.do("PATCH", p.zonePath(domain), body, nil)
+}
+
+// AddNewRecord adds the record to the existing records of the same name and
+// type, as PowerDNS replaces whole RRSets.
+func (p *PowerDNS) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	rrset, err := p.findRRSet(domain, dname, dtype)
+	if err != nil {
+		return "", err
+	}
+	id := recordId(dname, dtype, dvalue)
+	for _, r := range rrset.Records {
+		if unquoteTXT(dtype, r.Content) == dvalue {
+			return id, nil
+		}
+	}
+	rrset.Records = append(rrset.Records, powerDNSRecord{Content: quoteTXT(dtype, dvalue)})
+	if err := p.patch(domain, rrset); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DeleteRecord removes the record from the records of the same name and
+// type.
+func (p *PowerDNS) DeleteRecord(domain, id string) error {
+	dname, dtype, content, err := parseRecordId(id)
+	if err != nil {
+		return errors.New("powerdns: " + err.Error())
+	}
+	rrset, err := p.findRRSet(domain, dname, dtype)
+	if err != nil {
+		return err
+	}
+	records := []powerDNSRecord{}
+	for _, r := range rrset.Records {
+		if unquoteTXT(dtype, r.Content) != content {
+			records = append(records, r)
+		}
+	}
+	if len(records) == len(rrset.Records) {
+		return errors.New("powerdns: no record " + id)
+	}
+	rrset.Records = records
+	return p.patch(domain, rrset)
+}
@@ -0,0 +1,38 @@
+package dns_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/caiguanhao/certutils/dns"
+	"github.com/caiguanhao/certutils/dns/dnstest"
+)
+
+func TestPowerDNS(t *testing.T) {
+	_, p := newFake(t, "powerdns")
+	if err := dnstest.Run(p, "example.net"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPowerDNSRRSet checks that the records of a name are changed by
+// replacing the RRSet while it has values and deleting it with the last one.
+func TestPowerDNSRRSet(t *testing.T) {
+	_, p := testRecordSets(t, "powerdns", [][]string{
+		{"REPLACE _acme-challenge.example.net. TXT 1"},
+		{"REPLACE _acme-challenge.example.net. TXT 2"},
+		{"REPLACE _acme-challenge.example.net. TXT 1"},
+		{"DELETE _acme-challenge.example.net. TXT 0"},
+	})
+	records, err := p.GetRecords("example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []dns.Record{
+		{Id: `@ A "192.0.2.1"`, Type: "A", Name: "@", FullName: "example.net", Content: "192.0.2.1"},
+		{Id: `www CNAME "example.net."`, Type: "CNAME", Name: "www", FullName: "www.example.net", Content: "example.net."},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records are %+v, want %+v", records, want)
+	}
+}
@@ -0,0 +1,279 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Provider is a kind of DNS provider in the registry, which creates the
+	// DNS of an account from its options, or from environment variables.
+	Provider struct {
+		// Name is the name of the provider, like "cloudflare"
+		Name string
+		// Options are the options of the accounts of the provider
+		Options []Option
+		// New returns the DNS of an account with the options, which have the
+		// types of Options and are all set if they are required
+		New func(o Options) (DNS, error)
+		// FromEnv returns the DNS configured by environment variables
+		FromEnv func() (DNS, error)
+	}
+
+	// Option is an option of the accounts of a provider.
+	Option struct {
+		Name     string
+		Type     OptionType
+		Required bool
+	}
+
+	// OptionType is the type of the value of an option.
+	OptionType int
+
+	// Options are the options of an account by their names, with values of
+	// string, int, bool, time.Duration or []string by their types.
+	Options map[string]interface{}
+
+	// Accounts are named accounts of providers, like the tables of a config
+	// file. Each account has "provider", the name of its provider, and the
+	// options of the provider.
+	Accounts map[string]map[string]interface{}
+)
+
+const (
+	// OptionString is a string.
+	OptionString OptionType = iota
+	// OptionInt is an integer.
+	OptionInt
+	// OptionBool is true or false.
+	OptionBool
+	// OptionDuration is a duration like "30s".
+	OptionDuration
+	// OptionList is a list of strings, or a comma-separated string.
+	OptionList
+	// OptionCommand is a program and its arguments, or a string of them
+	// separated by spaces.
+	OptionCommand
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Provider{}
+)
+
+// Register adds a provider to the registry. It panics if the name of the
+// provider is already registered.
+func Register(p Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if p.Name == "" || p.New == nil || p.FromEnv == nil {
+		panic("dns: Register of incomplete provider " + p.Name)
+	}
+	if registry[p.Name] != nil {
+		panic("dns: Register called twice for provider " + p.Name)
+	}
+	registry[p.Name] = &p
+}
+
+// Lookup returns the registered provider of the name, or nil.
+func Lookup(name string) *Provider {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return registry[name]
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the value of a string option, or "".
+func (o Options) String(name string) string {
+	s, _ := o[name].(string)
+	return s
+}
+
+// Int returns the value of an int option, or 0.
+func (o Options) Int(name string) int {
+	i, _ := o[name].(int)
+	return i
+}
+
+// Bool returns the value of a bool option, or false.
+func (o Options) Bool(name string) bool {
+	b, _ := o[name].(bool)
+	return b
+}
+
+// Duration returns the value of a duration option, or 0.
+func (o Options) Duration(name string) time.Duration {
+	d, _ := o[name].(time.Duration)
+	return d
+}
+
+// Strings returns the value of a list or command option, or nil.
+func (o Options) Strings(name string) []string {
+	list, _ := o[name].([]string)
+	return list
+}
+
+// convert returns v, as decoded from a config file, as a value of the type.
+func (t OptionType) convert(v interface{}) (interface{}, error) {
+	switch t {
+	case OptionString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, errors.New("must be a string")
+	case OptionInt:
+		switch i := v.(type) {
+		case int:
+			return i, nil
+		case int64:
+			return int(i), nil
+		case float64:
+			if i == float64(int(i)) {
+				return int(i), nil
+			}
+		case string:
+			if n, err := strconv.Atoi(i); err == nil {
+				return n, nil
+			}
+		}
+		return nil, errors.New("must be an integer")
+	case OptionBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if value, err := strconv.ParseBool(b); err == nil {
+				return value, nil
+			}
+		}
+		return nil, errors.New("must be true or false")
+	case OptionDuration:
+		if s, ok := v.(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				return d, nil
+			}
+		}
+		return nil, errors.New(`must be a duration like "30s"`)
+	case OptionList, OptionCommand:
+		if s, ok := v.(string); ok {
+			if t == OptionCommand {
+				return strings.Fields(s), nil
+			}
+			var list []string
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			return list, nil
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			if list, ok := v.([]string); ok {
+				return list, nil
+			}
+			return nil, errors.New("must be a list of strings")
+		}
+		list := []string{}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.New("must be a list of strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, errors.New("has an unknown type")
+}
+
+// options returns the options of the account of the provider with the
+// types of the provider.
+func (p *Provider) options(values map[string]interface{}) (Options, error) {
+	o := Options{}
+	for name, value := range values {
+		if name == "provider" {
+			continue
+		}
+		var option *Option
+		for i := range p.Options {
+			if p.Options[i].Name == name {
+				option = &p.Options[i]
+			}
+		}
+		if option == nil {
+			return nil, errors.New("unknown option " + name + " of " + p.Name)
+		}
+		v, err := option.Type.convert(value)
+		if err != nil {
+			return nil, fmt.Errorf("option %s %s", name, err)
+		}
+		o[name] = v
+	}
+	var missing []string
+	for _, option := range p.Options {
+		if _, ok := o[option.Name]; option.Required && !ok {
+			missing = append(missing, option.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.New("please set " + strings.Join(missing, " and "))
+	}
+	return o, nil
+}
+
+// Names returns the sorted names of the accounts.
+func (a Accounts) Names() []string {
+	names := []string{}
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the DNS of the account name, or if there is no such account,
+// of the provider name configured by environment variables.
+func (a Accounts) New(name string) (DNS, error) {
+	values, ok := a[name]
+	if !ok {
+		p := Lookup(name)
+		if p == nil {
+			return nil, errors.New("bad dns type " + name)
+		}
+		return p.FromEnv()
+	}
+	providerName, _ := values["provider"].(string)
+	if providerName == "" {
+		return nil, errors.New("account " + name + ": please set provider")
+	}
+	p := Lookup(providerName)
+	if p == nil {
+		return nil, errors.New("account " + name + ": bad provider " + providerName)
+	}
+	o, err := p.options(values)
+	if err != nil {
+		return nil, errors.New("account " + name + ": " + err.Error())
+	}
+	client, err := p.New(o)
+	if err != nil {
+		return nil, errors.New("account " + name + ": " + err.Error())
+	}
+	return client, nil
+}
@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// restAPI is a REST API with JSON bodies, token authentication and page
+// number pagination, like the APIs of Hetzner, DigitalOcean, Linode and
+// Gandi.
+type restAPI struct {
+	// name is the name of the provider, the prefix of errors
+	name     string
+	endpoint string
+	// header has the authorization of the requests
+	header http.Header
+	client *http.Client
+	// pageParam and sizeParam are the query parameters of the page number
+	// (from 1) and the page size
+	pageParam, sizeParam string
+	pageSize             int
+}
+
+func (a restAPI) do(method, path string, query url.Values, body, result interface{}) error {
+	u := strings.TrimSuffix(a.endpoint, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	err := doJSON(a.client, request{method: method, url: u, header: a.header, body: body}, result)
+	if err != nil {
+		return fmt.Errorf("%s: %w", a.name, err)
+	}
+	return nil
+}
+
+// list gets the pages of a list from page 1, page returns the result to
+// decode the next page into and add adds its items and returns whether there
+// are more pages.
+func (a restAPI) list(path string, query url.Values, page func() interface{}, add func(page int) bool) error {
+	for n := 1; ; n++ {
+		q := url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		q.Set(a.pageParam, strconv.Itoa(n))
+		q.Set(a.sizeParam, strconv.Itoa(a.pageSize))
+		if err := a.do("GET", path, q, nil, page()); err != nil {
+			return err
+		}
+		if !add(n) {
+			return nil
+		}
+	}
+}
+
+// isNotFound returns whether err is of a response of 404 Not Found.
+func isNotFound(err error) bool {
+	var e *httpError
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,316 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type (
+	// RFC2136 changes records with dynamic updates (RFC 2136) signed with
+	// TSIG, and lists records with zone transfers if the server allows them.
+	// The ID of a record is its name, type and quoted content.
+	RFC2136 struct {
+		// Nameserver is the primary server of the zones, as host:port
+		Nameserver string
+		// Zones are the zones on the server, which can't be listed by DNS
+		Zones []string
+
+		// TSIGKey is the name of the key, TSIGSecret its base64 encoded
+		// secret, and TSIGAlgorithm hmac-sha256 (default) or hmac-sha512
+		TSIGKey       string
+		TSIGSecret    string
+		TSIGAlgorithm string
+
+		TTL     int
+		Timeout time.Duration
+	}
+)
+
+var _ DNS = (*RFC2136)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "rfc2136",
+		Options: []Option{
+			{Name: "nameserver", Type: OptionString, Required: true},
+			{Name: "zones", Type: OptionList},
+			{Name: "tsig_key", Type: OptionString},
+			{Name: "tsig_secret", Type: OptionString},
+			{Name: "tsig_algorithm", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+			{Name: "timeout", Type: OptionDuration},
+		},
+		New: func(o Options) (DNS, error) {
+			return &RFC2136{
+				Nameserver:    o.String("nameserver"),
+				Zones:         o.Strings("zones"),
+				TSIGKey:       o.String("tsig_key"),
+				TSIGSecret:    o.String("tsig_secret"),
+				TSIGAlgorithm: o.String("tsig_algorithm"),
+				TTL:           o.Int("ttl"),
+				Timeout:       o.Duration("timeout"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewRFC2136FromEnv()
+		},
+	})
+}
+
+// NewRFC2136FromEnv returns an RFC2136 configured by the environment
+// variables RFC2136_NAMESERVER, RFC2136_ZONES (comma-separated),
+// RFC2136_TSIG_KEY, RFC2136_TSIG_SECRET and RFC2136_TSIG_ALGORITHM.
+func NewRFC2136FromEnv() (*RFC2136, error) {
+	r := &RFC2136{
+		Nameserver:    os.Getenv("RFC2136_NAMESERVER"),
+		TSIGKey:       os.Getenv("RFC2136_TSIG_KEY"),
+		TSIGSecret:    os.Getenv("RFC2136_TSIG_SECRET"),
+		TSIGAlgorithm: os.Getenv("RFC2136_TSIG_ALGORITHM"),
+	}
+	for _, zone := range strings.Split(os.Getenv("RFC2136_ZONES"), ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			r.Zones = append(r.Zones, strings.TrimSuffix(zone, "."))
+		}
+	}
+	if r.Nameserver == "" {
+		return nil, errors.New("rfc2136: please set RFC2136_NAMESERVER")
+	}
+	return r, nil
+}
+
+func (r *RFC2136) key() (*tsigKey, error) {
+	if r.TSIGKey == "" {
+		return nil, nil
+	}
+	secret, err := base64.StdEncoding.DecodeString(r.TSIGSecret)
+	if err != nil {
+		return nil, errors.New("rfc2136: bad TSIG secret: " + err.Error())
+	}
+	algorithm := r.TSIGAlgorithm
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	return &tsigKey{name: fqdn(r.TSIGKey), algorithm: fqdn(algorithm), secret: secret}, nil
+}
+
+func (r *RFC2136) nameserver() string {
+	if _, _, err := net.SplitHostPort(r.Nameserver); err != nil {
+		return net.JoinHostPort(r.Nameserver, "53")
+	}
+	return r.Nameserver
+}
+
+// exchange sends a message over TCP and calls fn with each response until
+// fn returns true, the responses are verified if the message is signed.
+// fn checks the response code.
+func (r *RFC2136) exchange(m *message, fn func(msg []byte, resp *message) (bool, error)) error {
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	m.id = binary.BigEndian.Uint16(id[:])
+	msg, err := m.pack()
+	if err != nil {
+		return err
+	}
+	key, err := r.key()
+	if err != nil {
+		return err
+	}
+	var verifier *tsigVerifier
+	if key != nil {
+		var mac []byte
+		if msg, mac, err = key.sign(msg); err != nil {
+			return err
+		}
+		verifier = &tsigVerifier{key: key, prevMAC: mac}
+	}
+
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", r.nameserver(), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(append(packUint16(nil, uint16(len(msg))), msg...)); err != nil {
+		return err
+	}
+	for {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return err
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return err
+		}
+		resp, err := unpackMessage(msg)
+		if err != nil {
+			return err
+		}
+		if resp.id != m.id {
+			return errors.New("rfc2136: response ID mismatch")
+		}
+		if verifier != nil {
+			if err := verifier.verify(msg, resp); err != nil {
+				return errors.New("rfc2136: " + err.Error())
+			}
+		}
+		done, err := fn(msg, resp)
+		if err != nil {
+			return err
+		}
+		if done {
+			// the last message must be signed (RFC 8945 section 5.3.1)
+			if verifier != nil && len(verifier.unsigned) > 0 {
+				return errors.New("rfc2136: last response is not signed")
+			}
+			return nil
+		}
+	}
+}
+
+// name returns the fully qualified name of dname in the zone domain.
+func (r *RFC2136) name(domain, dname string) string {
+	if dname == "@" || dname == "" {
+		return fqdn(domain)
+	}
+	return fqdn(dname + "." + domain)
+}
+
+// relativeName returns the name of a record relative to the zone domain.
+func relativeName(domain, name string) string {
+	name = strings.TrimSuffix(name, ".")
+	if strings.EqualFold(name, domain) {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+domain)
+}
+
+func (r *RFC2136) GetListOfDomains() ([]string, error) {
+	if len(r.Zones) == 0 {
+		return nil, errors.New("rfc2136: no zones configured")
+	}
+	return r.Zones, nil
+}
+
+// GetRecords transfers the zone from the server.
+func (r *RFC2136) GetRecords(domain string) (records []Record, err error) {
+	m := &message{question: []question{{fqdn(domain), typeAXFR, classIN}}}
+	soas := 0
+	err = r.exchange(m, func(msg []byte, resp *message) (bool, error) {
+		if resp.rcode() != 0 {
+			return false, errors.New("rfc2136: zone transfer of " + domain + ": " + rcodeError(resp).Error())
+		}
+		for _, rr := range resp.answer {
+			if rr.rtype == typeSOA {
+				soas += 1
+				if soas == 2 {
+					return true, nil
+				}
+				continue
+			}
+			content := unpackData(msg, rr)
+			name := relativeName(domain, rr.name)
+			records = append(records, Record{
+				Id:       recordId(name, typeName(rr.rtype), content),
+				Type:     typeName(rr.rtype),
+				Name:     name,
+				FullName: strings.TrimSuffix(rr.name, "."),
+				Content:  content,
+			})
+		}
+		if soas == 0 {
+			return false, errors.New("rfc2136: zone transfer of " + domain + " is not allowed")
+		}
+		return false, nil
+	})
+	return
+}
+
+// GetRecordIdsFor queries the server for the records.
+func (r *RFC2136) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	rtype, err := typeCode(dtype)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{question: []question{{r.name(domain, dname), rtype, classIN}}}
+	ids := []string{}
+	err = r.exchange(m, func(msg []byte, resp *message) (bool, error) {
+		if resp.rcode() != 0 && resp.rcode() != rcodeNXDomain {
+			return false, errors.New("rfc2136: " + rcodeError(resp).Error())
+		}
+		for _, rr := range resp.answer {
+			if rr.rtype == rtype && strings.EqualFold(rr.name, r.name(domain, dname)) {
+				ids = append(ids, recordId(dname, dtype, unpackData(msg, rr)))
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *RFC2136) update(domain string, rr resource) error {
+	m := &message{
+		flags:     opcodeUpdate << 11,
+		question:  []question{{fqdn(domain), typeSOA, classIN}},
+		authority: []resource{rr},
+	}
+	return r.exchange(m, func(_ []byte, resp *message) (bool, error) {
+		if resp.rcode() != 0 {
+			return false, errors.New("rfc2136: update of " + domain + ": " + rcodeError(resp).Error())
+		}
+		return true, nil
+	})
+}
+
+func (r *RFC2136) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	rtype, err := typeCode(dtype)
+	if err != nil {
+		return "", err
+	}
+	data, err := packData(rtype, dvalue)
+	if err != nil {
+		return "", err
+	}
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = 60
+	}
+	rr := resource{name: r.name(domain, dname), rtype: rtype, class: classIN, ttl: uint32(ttl), data: data}
+	if err := r.update(domain, rr); err != nil {
+		return "", err
+	}
+	return recordId(dname, dtype, dvalue), nil
+}
+
+func (r *RFC2136) DeleteRecord(domain, id string) error {
+	dname, dtype, content, err := parseRecordId(id)
+	if err != nil {
+		return err
+	}
+	rtype, err := typeCode(dtype)
+	if err != nil {
+		return err
+	}
+	data, err := packData(rtype, content)
+	if err != nil {
+		return err
+	}
+	// class NONE deletes the record with the data
+	return r.update(domain, resource{name: r.name(domain, dname), rtype: rtype, class: classNONE, data: data})
+}
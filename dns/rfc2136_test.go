@@ -0,0 +1,78 @@
+package dns_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/caiguanhao/certutils/dns"
+	"github.com/caiguanhao/certutils/dns/dnstest"
+)
+
+// TestRFC2136Fake checks the updates, queries and zone transfers over TCP
+// with TSIG against the DNS server of the fake, and the records with a
+// resolver over UDP.
+func TestRFC2136Fake(t *testing.T) {
+	s, d := newFake(t, "rfc2136")
+	if err := dnstest.Run(d, "example.net"); err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("0123456789", 30)
+	for _, value := range []string{"one", long} {
+		if _, err := d.AddNewRecord("example.net", "_acme-challenge", "TXT", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolver := &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "udp", s.Addr)
+	}}
+	values, err := resolver.LookupTXT(context.Background(), "_acme-challenge.example.net.")
+	sort.Strings(values)
+	if want := []string{long, "one"}; err != nil || !reflect.DeepEqual(values, want) {
+		t.Errorf("TXT records over UDP are %q (%v), want %q", values, err, want)
+	}
+
+	records, err := d.GetRecords("example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Name+" "+r.Type+" "+r.Content)
+	}
+	want := []string{"@ A 192.0.2.1", "www CNAME example.net", "_acme-challenge TXT one", "_acme-challenge TXT " + long}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records are %q, want %q", got, want)
+	}
+
+	if err := d.DeleteRecord("example.net", records[2].Id); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Values("example.net", "_acme-challenge", "TXT"); !reflect.DeepEqual(got, []string{long}) {
+		t.Errorf("TXT records are %q after deleting one", got)
+	}
+}
+
+// TestRFC2136Unsigned checks that a zone transfer whose last message is not
+// signed is refused (RFC 8945 section 5.3.1), and that changes with a bad
+// key are refused by the server.
+func TestRFC2136Unsigned(t *testing.T) {
+	s, d := newFake(t, "rfc2136")
+	s.UnsignedLast = true
+	if _, err := d.GetRecords("example.net"); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("unsigned zone transfer is not refused: %v", err)
+	}
+
+	d.(*dns.RFC2136).TSIGSecret = "YmFk"
+	if _, err := d.AddNewRecord("example.net", "_x", "TXT", "x"); err == nil || !strings.Contains(err.Error(), "NOTAUTH") {
+		t.Errorf("update with a bad key is not refused: %v", err)
+	}
+	if got := s.Values("example.net", "_x", "TXT"); len(got) > 0 {
+		t.Errorf("records are added with a bad key: %q", got)
+	}
+}
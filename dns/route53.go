@@ -0,0 +1,439 @@
+package dns
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Route53 uses the API of Amazon Route 53, signed with AWS Signature
+	// Version 4. A record set of Route 53 has all values of a name and type,
+	// the ID of a record is its name, type and quoted content.
+	Route53 struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		// Region is the region to sign requests for, us-east-1 by default
+		Region string
+		// Endpoint is https://route53.amazonaws.com by default
+		Endpoint string
+		TTL      int
+		// Wait waits until changes are INSYNC, up to WaitTimeout (2 minutes
+		// by default)
+		Wait        bool
+		WaitTimeout time.Duration
+		Client      *http.Client
+	}
+
+	route53RRSet struct {
+		Name            string              `xml:"Name"`
+		Type            string              `xml:"Type"`
+		SetIdentifier   string              `xml:"SetIdentifier,omitempty"`
+		TTL             int                 `xml:"TTL,omitempty"`
+		ResourceRecords []route53Record     `xml:"ResourceRecords>ResourceRecord"`
+		AliasTarget     *route53AliasTarget `xml:"AliasTarget,omitempty"`
+	}
+
+	route53Record struct {
+		Value string `xml:"Value"`
+	}
+
+	route53AliasTarget struct {
+		DNSName string `xml:"DNSName"`
+	}
+
+	route53ChangeInfo struct {
+		Id     string `xml:"Id"`
+		Status string `xml:"Status"`
+	}
+)
+
+const (
+	route53Version = "2013-04-01"
+	route53Xmlns   = "https://route53.amazonaws.com/doc/2013-04-01/"
+	// route53PollInterval is the interval to check the status of a change
+	route53PollInterval = 5 * time.Second
+)
+
+var _ DNS = (*Route53)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "route53",
+		Options: []Option{
+			{Name: "access_key_id", Type: OptionString, Required: true},
+			{Name: "secret_access_key", Type: OptionString, Required: true},
+			{Name: "session_token", Type: OptionString},
+			{Name: "region", Type: OptionString},
+			{Name: "endpoint", Type: OptionString},
+			{Name: "ttl", Type: OptionInt},
+			{Name: "wait", Type: OptionBool},
+			{Name: "wait_timeout", Type: OptionDuration},
+		},
+		New: func(o Options) (DNS, error) {
+			return &Route53{
+				AccessKeyId:     o.String("access_key_id"),
+				SecretAccessKey: o.String("secret_access_key"),
+				SessionToken:    o.String("session_token"),
+				Region:          o.String("region"),
+				Endpoint:        o.String("endpoint"),
+				TTL:             o.Int("ttl"),
+				Wait:            o.Bool("wait"),
+				WaitTimeout:     o.Duration("wait_timeout"),
+			}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewRoute53FromEnv()
+		},
+	})
+}
+
+// NewRoute53FromEnv returns a Route53 configured by the environment variables
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optionally AWS_SESSION_TOKEN,
+// AWS_ROUTE53_REGION, AWS_ROUTE53_ENDPOINT and AWS_ROUTE53_WAIT.
+func NewRoute53FromEnv() (*Route53, error) {
+	r := &Route53{
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Region:          os.Getenv("AWS_ROUTE53_REGION"),
+		Endpoint:        os.Getenv("AWS_ROUTE53_ENDPOINT"),
+	}
+	if r.AccessKeyId == "" || r.SecretAccessKey == "" {
+		return nil, errors.New("route53: please set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if wait := os.Getenv("AWS_ROUTE53_WAIT"); wait != "" {
+		var err error
+		if r.Wait, err = strconv.ParseBool(wait); err != nil {
+			return nil, errors.New("route53: bad AWS_ROUTE53_WAIT " + wait)
+		}
+	}
+	return r, nil
+}
+
+// sign signs a request with AWS Signature Version 4.
+func (r *Route53) sign(req *http.Request, body []byte) error {
+	region := r.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	var names []string
+	if r.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.SessionToken)
+		names = append(names, "x-amz-security-token")
+	}
+	return signV4(req, body, r.AccessKeyId, r.SecretAccessKey, region, "route53", names, time.Now())
+}
+
+// signV4 signs a request of the service in the region with AWS Signature
+// Version 4 at the time t. The Host and X-Amz-Date headers are signed, and
+// the headers of names.
+func signV4(req *http.Request, body []byte, accessKeyId, secretAccessKey, region, service string, names []string, t time.Time) error {
+	date := t.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	names = append([]string{"host", "x-amz-date"}, names...)
+	signedHeaders, headers := canonicalHeaders(req, names)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		headers + "\n",
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+	scope := date[:8] + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		date,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyId+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+func (r *Route53) do(method, path string, query url.Values, body, result interface{}) error {
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = "https://route53.amazonaws.com"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + "/" + route53Version + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	err := doXML(r.Client, request{method: method, url: u, body: body, sign: r.sign}, result)
+	if err != nil {
+		return errors.New("route53: " + err.Error())
+	}
+	return nil
+}
+
+// getZones returns the IDs of the public hosted zones by their names.
+func (r *Route53) getZones() (names, ids []string, err error) {
+	marker := ""
+	for {
+		var result struct {
+			HostedZones []struct {
+				Id     string `xml:"Id"`
+				Name   string `xml:"Name"`
+				Config struct {
+					PrivateZone bool `xml:"PrivateZone"`
+				} `xml:"Config"`
+			} `xml:"HostedZones>HostedZone"`
+			IsTruncated bool   `xml:"IsTruncated"`
+			NextMarker  string `xml:"NextMarker"`
+		}
+		query := url.Values{"maxitems": {"100"}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		if err := r.do("GET", "/hostedzone", query, nil, &result); err != nil {
+			return nil, nil, err
+		}
+		for _, z := range result.HostedZones {
+			if z.Config.PrivateZone {
+				continue
+			}
+			names = append(names, strings.TrimSuffix(z.Name, "."))
+			ids = append(ids, strings.TrimPrefix(z.Id, "/hostedzone/"))
+		}
+		if !result.IsTruncated || result.NextMarker == "" {
+			return
+		}
+		marker = result.NextMarker
+	}
+}
+
+func (r *Route53) zoneId(domain string) (string, error) {
+	names, ids, err := r.getZones()
+	if err != nil {
+		return "", err
+	}
+	for i, name := range names {
+		if strings.EqualFold(name, domain) {
+			return ids[i], nil
+		}
+	}
+	return "", errors.New("route53: no zone " + domain)
+}
+
+func (r *Route53) GetListOfDomains() ([]string, error) {
+	names, _, err := r.getZones()
+	if err != nil {
+		return nil, err
+	}
+	domains := []string{}
+	return append(domains, names...), nil
+}
+
+// getRRSets returns the record sets of the zone, starting from name and type
+// if they are not empty, and up to max record sets if max > 0.
+func (r *Route53) getRRSets(zoneId, name, dtype string, max int) ([]route53RRSet, error) {
+	var rrsets []route53RRSet
+	for {
+		var result struct {
+			ResourceRecordSets   []route53RRSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+			IsTruncated          bool           `xml:"IsTruncated"`
+			NextRecordName       string         `xml:"NextRecordName"`
+			NextRecordType       string         `xml:"NextRecordType"`
+			NextRecordIdentifier string         `xml:"NextRecordIdentifier"`
+		}
+		query := url.Values{}
+		if name != "" {
+			query.Set("name", name)
+		}
+		if dtype != "" {
+			query.Set("type", dtype)
+		}
+		if max > 0 {
+			query.Set("maxitems", strconv.Itoa(max))
+		}
+		if err := r.do("GET", "/hostedzone/"+zoneId+"/rrset", query, nil, &result); err != nil {
+			return nil, err
+		}
+		rrsets = append(rrsets, result.ResourceRecordSets...)
+		if max > 0 || !result.IsTruncated || result.NextRecordName == "" {
+			return rrsets, nil
+		}
+		name, dtype = result.NextRecordName, result.NextRecordType
+	}
+}
+
+func (r *Route53) GetRecords(domain string) (records []Record, err error) {
+	zoneId, err := r.zoneId(domain)
+	if err != nil {
+		return nil, err
+	}
+	rrsets, err := r.getRRSets(zoneId, "", "", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, rrset := range rrsets {
+		name := relativeName(domain, rrset.Name)
+		for _, rr := range rrset.ResourceRecords {
+			content := unquoteTXT(rrset.Type, rr.Value)
+			records = append(records, Record{
+				Id:       recordId(name, rrset.Type, content),
+				Type:     rrset.Type,
+				Name:     name,
+				FullName: strings.TrimSuffix(rrset.Name, "."),
+				Content:  content,
+			})
+		}
+	}
+	return
+}
+
+func (r *Route53) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	records, err := r.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, rec := range records {
+		if rec.Name == dname && rec.Type == dtype {
+			ids = append(ids, rec.Id)
+		}
+	}
+	return ids, nil
+}
+
+// findRRSet returns the zone ID and the record set of the name and type, or
+// an empty record set.
+func (r *Route53) findRRSet(domain, dname, dtype string) (string, *route53RRSet, error) {
+	zoneId, err := r.zoneId(domain)
+	if err != nil {
+		return "", nil, err
+	}
+	name := fqdn(domain)
+	if dname != "@" {
+		name = fqdn(dname + "." + domain)
+	}
+	rrsets, err := r.getRRSets(zoneId, name, dtype, 1)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, rrset := range rrsets {
+		if strings.EqualFold(rrset.Name, name) && rrset.Type == dtype && rrset.SetIdentifier == "" {
+			return zoneId, &rrset, nil
+		}
+	}
+	return zoneId, &route53RRSet{Name: name, Type: dtype}, nil
+}
+
+// change changes the record set and waits until the change is INSYNC if
+// r.Wait.
+func (r *Route53) change(zoneId, action string, rrset *route53RRSet) error {
+	type change struct {
+		Action            string        `xml:"Action"`
+		ResourceRecordSet *route53RRSet `xml:"ResourceRecordSet"`
+	}
+	body := struct {
+		XMLName xml.Name `xml:"ChangeResourceRecordSetsRequest"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Changes []change `xml:"ChangeBatch>Changes>Change"`
+	}{
+		Xmlns:   route53Xmlns,
+		Changes: []change{{action, rrset}},
+	}
+	var result struct {
+		ChangeInfo route53ChangeInfo `xml:"ChangeInfo"`
+	}
+	if err := r.do("POST", "/hostedzone/"+zoneId+"/rrset/", nil, body, &result); err != nil {
+		return err
+	}
+	if !r.Wait {
+		return nil
+	}
+	return r.waitForChange(result.ChangeInfo)
+}
+
+func (r *Route53) waitForChange(info route53ChangeInfo) error {
+	timeout := r.WaitTimeout
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+	deadline := time.Now().Add(timeout)
+	id := strings.TrimPrefix(info.Id, "/change/")
+	for info.Status != "INSYNC" {
+		if time.Now().After(deadline) {
+			return errors.New("route53: change " + id + " is not INSYNC after " + timeout.String())
+		}
+		time.Sleep(route53PollInterval)
+		var result struct {
+			ChangeInfo route53ChangeInfo `xml:"ChangeInfo"`
+		}
+		if err := r.do("GET", "/change/"+id, nil, nil, &result); err != nil {
+			return err
+		}
+		info = result.ChangeInfo
+	}
+	return nil
+}
+
+// AddNewRecord adds the value to the record set of the name and type.
+func (r *Route53) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	zoneId, rrset, err := r.findRRSet(domain, dname, dtype)
+	if err != nil {
+		return "", err
+	}
+	id := recordId(dname, dtype, dvalue)
+	for _, rr := range rrset.ResourceRecords {
+		if unquoteTXT(dtype, rr.Value) == dvalue {
+			return id, nil
+		}
+	}
+	rrset.ResourceRecords = append(rrset.ResourceRecords, route53Record{quoteTXT(dtype, dvalue)})
+	if rrset.TTL == 0 {
+		rrset.TTL = r.TTL
+	}
+	if rrset.TTL == 0 {
+		rrset.TTL = 300
+	}
+	if err := r.change(zoneId, "UPSERT", rrset); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DeleteRecord removes the value from the record set, or deletes the record
+// set if it is the last value.
+func (r *Route53) DeleteRecord(domain, id string) error {
+	dname, dtype, content, err := parseRecordId(id)
+	if err != nil {
+		return errors.New("route53: " + err.Error())
+	}
+	zoneId, rrset, err := r.findRRSet(domain, dname, dtype)
+	if err != nil {
+		return err
+	}
+	var values []route53Record
+	for _, rr := range rrset.ResourceRecords {
+		if unquoteTXT(dtype, rr.Value) != content {
+			values = append(values, rr)
+		}
+	}
+	if len(values) == len(rrset.ResourceRecords) {
+		return errors.New("route53: no record " + id)
+	}
+	if len(values) == 0 {
+		// a deletion must match the record set exactly
+		return r.change(zoneId, "DELETE", rrset)
+	}
+	rrset.ResourceRecords = values
+	return r.change(zoneId, "UPSERT", rrset)
+}
@@ -0,0 +1,51 @@
+package dns
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignV4 checks the signatures of the AWS Signature Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	tests := []struct {
+		name, method, url, body, contentType, signedHeaders, signature string
+	}{
+		{"get-vanilla", "GET", "/", "", "", "host;x-amz-date",
+			"5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "GET", "/?Param2=value2&Param1=value1", "", "", "host;x-amz-date",
+			"b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-vanilla", "POST", "/", "", "", "host;x-amz-date",
+			"5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{"post-x-www-form-urlencoded", "POST", "/", "Param1=value1", "application/x-www-form-urlencoded",
+			"content-type;host;x-amz-date",
+			"ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, "https://example.amazonaws.com"+test.url, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+				names = append(names, "content-type")
+			}
+			err = signV4(req, []byte(test.body), "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				"us-east-1", "service", names, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date is %s", got)
+			}
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=" + test.signedHeaders + ", Signature=" + test.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization is\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal DNS message codec (RFC 1035) with TSIG (RFC 8945), enough for
+// dynamic updates (RFC 2136), queries and zone transfers over TCP.
+
+const (
+	typeA     = 1
+	typeNS    = 2
+	typeCNAME = 5
+	typeSOA   = 6
+	typePTR   = 12
+	typeMX    = 15
+	typeTXT   = 16
+	typeAAAA  = 28
+	typeTSIG  = 250
+	typeAXFR  = 252
+	typeANY   = 255
+
+	classIN   = 1
+	classNONE = 254
+	classANY  = 255
+
+	opcodeUpdate  = 5
+	rcodeNXDomain = 3
+)
+
+var (
+	typeNames = map[uint16]string{
+		typeA: "A", typeNS: "NS", typeCNAME: "CNAME", typeSOA: "SOA", typePTR: "PTR",
+		typeMX: "MX", typeTXT: "TXT", typeAAAA: "AAAA",
+	}
+
+	rcodeNames = map[int]string{
+		1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+		6: "YXDOMAIN", 7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE",
+		16: "BADSIG", 17: "BADKEY", 18: "BADTIME",
+	}
+)
+
+type (
+	question struct {
+		name         string
+		qtype, class uint16
+	}
+
+	resource struct {
+		name        string
+		rtype       uint16
+		class       uint16
+		ttl         uint32
+		data        []byte
+		off, dataAt int // offsets of the record and its data in the message
+	}
+
+	message struct {
+		id, flags  uint16
+		question   []question
+		answer     []resource
+		authority  []resource
+		additional []resource
+	}
+)
+
+func typeName(t uint16) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+func typeCode(name string) (uint16, error) {
+	for t, n := range typeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return 0, errors.New("unsupported record type " + name)
+}
+
+func rcodeName(rcode int) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return "RCODE" + strconv.Itoa(rcode)
+}
+
+// fqdn returns name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// packName appends the uncompressed wire form of name, in lowercase if
+// canonical.
+func packName(b []byte, name string, canonical bool) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if canonical {
+		name = strings.ToLower(name)
+	}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, errors.New("bad domain name " + name)
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+// unpackName reads a possibly compressed name at off, and returns it with a
+// trailing dot and the offset after it.
+func unpackName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("truncated name")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 100 {
+				return "", 0, errors.New("bad name pointer")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps += 1
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errors.New("truncated name")
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+func packUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func packUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func packResource(b []byte, r resource) ([]byte, error) {
+	b, err := packName(b, r.name, false)
+	if err != nil {
+		return nil, err
+	}
+	b = packUint16(b, r.rtype)
+	b = packUint16(b, r.class)
+	b = packUint32(b, r.ttl)
+	b = packUint16(b, uint16(len(r.data)))
+	return append(b, r.data...), nil
+}
+
+func (m *message) pack() ([]byte, error) {
+	b := make([]byte, 0, 512)
+	b = packUint16(b, m.id)
+	b = packUint16(b, m.flags)
+	b = packUint16(b, uint16(len(m.question)))
+	b = packUint16(b, uint16(len(m.answer)))
+	b = packUint16(b, uint16(len(m.authority)))
+	b = packUint16(b, uint16(len(m.additional)))
+	var err error
+	for _, q := range m.question {
+		if b, err = packName(b, q.name, false); err != nil {
+			return nil, err
+		}
+		b = packUint16(b, q.qtype)
+		b = packUint16(b, q.class)
+	}
+	for _, section := range [][]resource{m.answer, m.authority, m.additional} {
+		for _, r := range section {
+			if b, err = packResource(b, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+func unpackMessage(msg []byte) (*message, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("truncated message")
+	}
+	m := &message{
+		id:    binary.BigEndian.Uint16(msg),
+		flags: binary.BigEndian.Uint16(msg[2:]),
+	}
+	var counts [4]int
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+	off := 12
+	for i := 0; i < counts[0]; i++ {
+		name, next, err := unpackName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(msg) {
+			return nil, errors.New("truncated question")
+		}
+		m.question = append(m.question, question{name,
+			binary.BigEndian.Uint16(msg[next:]), binary.BigEndian.Uint16(msg[next+2:])})
+		off = next + 4
+	}
+	sections := []*[]resource{&m.answer, &m.authority, &m.additional}
+	for s, section := range sections {
+		for i := 0; i < counts[s+1]; i++ {
+			name, next, err := unpackName(msg, off)
+			if err != nil {
+				return nil, err
+			}
+			if next+10 > len(msg) {
+				return nil, errors.New("truncated record")
+			}
+			r := resource{
+				name:   name,
+				rtype:  binary.BigEndian.Uint16(msg[next:]),
+				class:  binary.BigEndian.Uint16(msg[next+2:]),
+				ttl:    binary.BigEndian.Uint32(msg[next+4:]),
+				off:    off,
+				dataAt: next + 10,
+			}
+			length := int(binary.BigEndian.Uint16(msg[next+8:]))
+			if r.dataAt+length > len(msg) {
+				return nil, errors.New("truncated record")
+			}
+			r.data = msg[r.dataAt : r.dataAt+length]
+			*section = append(*section, r)
+			off = r.dataAt + length
+		}
+	}
+	return m, nil
+}
+
+func (m *message) rcode() int {
+	return int(m.flags & 0xf)
+}
+
+func rcodeError(m *message) error {
+	return errors.New("server responded " + rcodeName(m.rcode()))
+}
+
+// packData returns the wire form of the data of a record.
+func packData(rtype uint16, content string) ([]byte, error) {
+	switch rtype {
+	case typeA, typeAAAA:
+		ip := net.ParseIP(content)
+		if ip4 := ip.To4(); rtype == typeA && ip4 != nil {
+			return ip4, nil
+		}
+		if rtype == typeAAAA && ip != nil && ip.To4() == nil {
+			return ip, nil
+		}
+		return nil, errors.New("bad IP address " + content)
+	case typeCNAME, typeNS, typePTR:
+		return packName(nil, fqdn(content), false)
+	case typeTXT:
+		var b []byte
+		for len(content) > 255 {
+			b = append(append(b, 255), content[:255]...)
+			content = content[255:]
+		}
+		return append(append(b, byte(len(content))), content...), nil
+	}
+	return nil, errors.New("unsupported record type " + typeName(rtype))
+}
+
+// unpackData returns the presentation form of the data of a record, names
+// without trailing dots and TXT strings joined.
+func unpackData(msg []byte, r resource) string {
+	switch r.rtype {
+	case typeA, typeAAAA:
+		return net.IP(r.data).String()
+	case typeCNAME, typeNS, typePTR:
+		if name, _, err := unpackName(msg, r.dataAt); err == nil {
+			return strings.TrimSuffix(name, ".")
+		}
+	case typeMX:
+		if len(r.data) > 2 {
+			if name, _, err := unpackName(msg, r.dataAt+2); err == nil {
+				return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(r.data), strings.TrimSuffix(name, "."))
+			}
+		}
+	case typeTXT:
+		var s strings.Builder
+		for data := r.data; len(data) > 0 && len(data) > int(data[0]); data = data[1+int(data[0]):] {
+			s.Write(data[1 : 1+int(data[0])])
+		}
+		return s.String()
+	}
+	// RFC 3597
+	return fmt.Sprintf(`\# %d %s`, len(r.data), hex.EncodeToString(r.data))
+}
+
+// tsigKey signs messages with TSIG.
+type tsigKey struct {
+	name      string
+	algorithm string
+	secret    []byte
+}
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha256.": sha256.New,
+	"hmac-sha512.": sha512.New,
+}
+
+func (k *tsigKey) mac(data []byte) ([]byte, error) {
+	h, ok := tsigAlgorithms[strings.ToLower(fqdn(k.algorithm))]
+	if !ok {
+		return nil, errors.New("unsupported TSIG algorithm " + k.algorithm)
+	}
+	m := hmac.New(h, k.secret)
+	m.Write(data)
+	return m.Sum(nil), nil
+}
+
+// variables returns the TSIG variables of the MAC, only the timers if
+// timersOnly.
+func (k *tsigKey) variables(signed uint64, fudge, rcode uint16, timersOnly bool) ([]byte, error) {
+	var b []byte
+	var err error
+	if !timersOnly {
+		if b, err = packName(b, k.name, true); err != nil {
+			return nil, err
+		}
+		b = packUint16(b, classANY)
+		b = packUint32(b, 0)
+		if b, err = packName(b, k.algorithm, true); err != nil {
+			return nil, err
+		}
+	}
+	b = packUint16(b, uint16(signed>>32))
+	b = packUint32(b, uint32(signed))
+	b = packUint16(b, fudge)
+	if !timersOnly {
+		b = packUint16(b, rcode)
+		b = packUint16(b, 0)
+	}
+	return b, nil
+}
+
+// sign appends a TSIG record to a packed message, and returns the signed
+// message and its MAC.
+func (k *tsigKey) sign(msg []byte) ([]byte, []byte, error) {
+	signed := uint64(time.Now().Unix())
+	const fudge = 300
+	vars, err := k.variables(signed, fudge, 0, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	mac, err := k.mac(append(append([]byte{}, msg...), vars...))
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := packName(nil, k.algorithm, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	data = packUint16(data, uint16(signed>>32))
+	data = packUint32(data, uint32(signed))
+	data = packUint16(data, fudge)
+	data = packUint16(data, uint16(len(mac)))
+	data = append(data, mac...)
+	data = append(data, msg[0], msg[1]) // original ID
+	data = packUint16(data, 0)          // error
+	data = packUint16(data, 0)          // other length
+	signedMsg, err := packResource(append([]byte{}, msg...), resource{
+		name: strings.ToLower(k.name), rtype: typeTSIG, class: classANY, data: data,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	arcount := binary.BigEndian.Uint16(msg[10:])
+	binary.BigEndian.PutUint16(signedMsg[10:], arcount+1)
+	return signedMsg, mac, nil
+}
+
+// tsigVerifier verifies the TSIG records of the responses to a signed
+// request, which may be more than one message for zone transfers.
+type tsigVerifier struct {
+	key     *tsigKey
+	prevMAC []byte
+	signed  int
+	// unsigned are the messages since the last signed one
+	unsigned []byte
+}
+
+func (v *tsigVerifier) verify(msg []byte, m *message) error {
+	var tsig *resource
+	if n := len(m.additional); n > 0 && m.additional[n-1].rtype == typeTSIG {
+		tsig = &m.additional[n-1]
+	}
+	if tsig == nil {
+		if v.signed == 0 {
+			if m.rcode() != 0 {
+				return rcodeError(m)
+			}
+			return errors.New("response is not signed")
+		}
+		// RFC 8945 allows up to 99 unsigned messages in a zone transfer
+		v.unsigned = append(v.unsigned, msg...)
+		if len(v.unsigned) > 100*65535 {
+			return errors.New("too many unsigned messages")
+		}
+		return nil
+	}
+	data := tsig.data
+	_, off, err := unpackName(msg, tsig.dataAt)
+	if err != nil {
+		return err
+	}
+	off -= tsig.dataAt
+	if off+10 > len(data) {
+		return errors.New("truncated TSIG record")
+	}
+	signed := uint64(binary.BigEndian.Uint16(data[off:]))<<32 | uint64(binary.BigEndian.Uint32(data[off+2:]))
+	fudge := binary.BigEndian.Uint16(data[off+6:])
+	size := int(binary.BigEndian.Uint16(data[off+8:]))
+	if off+10+size+6 > len(data) {
+		return errors.New("truncated TSIG record")
+	}
+	mac := data[off+10 : off+10+size]
+	rcode := binary.BigEndian.Uint16(data[off+12+size:])
+	if rcode != 0 {
+		return errors.New("TSIG error: " + rcodeName(int(rcode)))
+	}
+
+	// the message without TSIG and with the original ID
+	stripped := append([]byte{}, msg[:tsig.off]...)
+	copy(stripped, data[off+10+size:off+12+size])
+	binary.BigEndian.PutUint16(stripped[10:], uint16(len(m.additional)-1))
+
+	var b []byte
+	b = packUint16(b, uint16(len(v.prevMAC)))
+	b = append(b, v.prevMAC...)
+	b = append(b, v.unsigned...)
+	b = append(b, stripped...)
+	vars, err := v.key.variables(signed, fudge, rcode, v.signed > 0)
+	if err != nil {
+		return err
+	}
+	expected, err := v.key.mac(append(b, vars...))
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, expected) {
+		return errors.New("bad TSIG signature of response")
+	}
+	now := time.Now().Unix()
+	if d := now - int64(signed); d > int64(fudge) || -d > int64(fudge) {
+		return errors.New("TSIG time of response is off by " + strconv.FormatInt(d, 10) + "s")
+	}
+	v.prevMAC = mac
+	v.unsigned = nil
+	v.signed += 1
+	return nil
+}
@@ -0,0 +1,242 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 255) + strings.Repeat("y", 45)
+	records := []struct {
+		name, dtype, content string
+	}{
+		{"example.net.", "A", "192.0.2.1"},
+		{"example.net.", "AAAA", "2001:db8::1"},
+		{"www.example.net.", "CNAME", "example.net"},
+		{"_acme-challenge.example.net.", "TXT", "value"},
+		{"_acme-challenge.example.net.", "TXT", long},
+		{"_acme-challenge.example.net.", "TXT", ""},
+	}
+	m := &message{id: 0x1234, flags: opcodeUpdate << 11, question: []question{{"Example.NET.", typeSOA, classIN}}}
+	for _, r := range records {
+		rtype, err := typeCode(r.dtype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := packData(rtype, r.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.authority = append(m.authority, resource{name: r.name, rtype: rtype, class: classIN, ttl: 60, data: data})
+	}
+	msg, err := m.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unpackMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.id != m.id || got.flags != m.flags || len(got.question) != 1 || got.question[0] != m.question[0] {
+		t.Errorf("header is %#x %#x %+v", got.id, got.flags, got.question)
+	}
+	if len(got.answer) != 0 || len(got.additional) != 0 || len(got.authority) != len(records) {
+		t.Fatalf("sections have %d, %d and %d records", len(got.answer), len(got.authority), len(got.additional))
+	}
+	for i, r := range records {
+		rr := got.authority[i]
+		if rr.name != r.name || typeName(rr.rtype) != r.dtype || rr.class != classIN || rr.ttl != 60 {
+			t.Errorf("record %d is %s %s %d %d", i, rr.name, typeName(rr.rtype), rr.class, rr.ttl)
+		}
+		if content := unpackData(msg, rr); content != r.content {
+			t.Errorf("content of record %d is %q, want %q", i, content, r.content)
+		}
+	}
+}
+
+func TestUnpackName(t *testing.T) {
+	// www.example.net at 12, and a pointer to example.net in it at 29
+	msg := make([]byte, 12)
+	msg = append(msg, 3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'n', 'e', 't', 0)
+	msg = append(msg, 4, '_', 'a', 'c', 'm', 0xc0, 16)
+	name, next, err := unpackName(msg, 29)
+	if err != nil || name != "_acm.example.net." || next != len(msg) {
+		t.Errorf("name is %q, next %d (%v)", name, next, err)
+	}
+
+	for _, bad := range [][]byte{
+		append(make([]byte, 12), 0xc0, 12),     // pointer to itself
+		append(make([]byte, 12), 3, 'w', 'w'),  // truncated label
+		append(make([]byte, 12), 0xc0),         // truncated pointer
+		append(make([]byte, 12), 1, 'a', 0xc0), // truncated pointer after a label
+	} {
+		if name, _, err := unpackName(bad, 12); err == nil {
+			t.Errorf("%v is unpacked as %q", bad[12:], name)
+		}
+	}
+	if _, err := unpackMessage(append(make([]byte, 5), 1)); err == nil {
+		t.Error("truncated message is unpacked")
+	}
+}
+
+// signResponse signs a response as a server does (RFC 8945 section 5.3),
+// with the MAC of the request or the previous signed message and the
+// unsigned messages since then.
+func signResponse(t *testing.T, k *tsigKey, msg, prevMAC, unsigned []byte, first bool, signed uint64) ([]byte, []byte) {
+	t.Helper()
+	vars, err := k.variables(signed, 300, 0, !first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := append(packUint16(nil, uint16(len(prevMAC))), prevMAC...)
+	b = append(append(b, unsigned...), msg...)
+	mac, err := k.mac(append(b, vars...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := packName(nil, k.algorithm, true)
+	data = packUint16(data, uint16(signed>>32))
+	data = packUint32(data, uint32(signed))
+	data = packUint16(data, 300)
+	data = packUint16(data, uint16(len(mac)))
+	data = append(data, mac...)
+	data = append(data, msg[0], msg[1], 0, 0, 0, 0)
+	signedMsg, err := packResource(append([]byte{}, msg...), resource{name: k.name, rtype: typeTSIG, class: classANY, data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(signedMsg[10:], binary.BigEndian.Uint16(msg[10:])+1)
+	return signedMsg, mac
+}
+
+func TestTSIG(t *testing.T) {
+	k := &tsigKey{name: "Key.Example.", algorithm: "hmac-sha256.", secret: []byte("secret")}
+	request, err := (&message{id: 7, question: []question{{"example.net.", typeAXFR, classIN}}}).pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedRequest, requestMAC, err := k.sign(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the request is signed with the key name and algorithm in lowercase
+	m, err := unpackMessage(signedRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.additional) != 1 || m.additional[0].rtype != typeTSIG || m.additional[0].name != "key.example." {
+		t.Fatalf("additional records are %+v", m.additional)
+	}
+	tsig := m.additional[0]
+	algorithm, off, err := unpackName(signedRequest, tsig.dataAt)
+	if err != nil || algorithm != "hmac-sha256." {
+		t.Fatalf("algorithm is %q (%v)", algorithm, err)
+	}
+	off -= tsig.dataAt
+	signed := uint64(binary.BigEndian.Uint16(tsig.data[off:]))<<32 | uint64(binary.BigEndian.Uint32(tsig.data[off+2:]))
+	if d := time.Now().Unix() - int64(signed); d < 0 || d > 5 {
+		t.Errorf("signed %ds ago", d)
+	}
+	var vars []byte
+	vars, _ = packName(vars, "key.example.", false)
+	vars = packUint32(packUint16(vars, classANY), 0)
+	vars, _ = packName(vars, "hmac-sha256.", false)
+	vars = append(vars, tsig.data[off:off+8]...)
+	vars = append(vars, 0, 0, 0, 0)
+	h := hmac.New(sha256.New, k.secret)
+	h.Write(request)
+	h.Write(vars)
+	if !hmac.Equal(requestMAC, h.Sum(nil)) {
+		t.Errorf("MAC of request is %x", requestMAC)
+	}
+
+	response := func(i int) []byte {
+		m := &message{id: 7, flags: 0x8400, question: []question{{"example.net.", typeAXFR, classIN}}}
+		data, _ := packData(typeTXT, string(rune('a'+i)))
+		m.answer = []resource{{name: "example.net.", rtype: typeTXT, class: classIN, ttl: 60, data: data}}
+		msg, err := m.pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	// transfer returns the responses of a zone transfer of n messages signed
+	// by key, sign tells which are signed
+	transfer := func(key *tsigKey, n int, sign func(i int) bool) [][]byte {
+		var msgs [][]byte
+		prev, unsigned := requestMAC, []byte(nil)
+		for i := 0; i < n; i++ {
+			msg := response(i)
+			if sign(i) {
+				msg, prev = signResponse(t, key, msg, prev, unsigned, i == 0, uint64(time.Now().Unix()))
+				unsigned = nil
+			} else {
+				unsigned = append(unsigned, msg...)
+			}
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+	verify := func(msgs [][]byte) (*tsigVerifier, error) {
+		v := &tsigVerifier{key: k, prevMAC: requestMAC}
+		for i, msg := range msgs {
+			m, err := unpackMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.verify(msg, m); err != nil {
+				return v, fmt.Errorf("message %d: %w", i, err)
+			}
+		}
+		return v, nil
+	}
+
+	all := func(int) bool { return true }
+	firstAndLast := func(i int) bool { return i == 0 || i == 4 }
+	if _, err := verify(transfer(k, 3, all)); err != nil {
+		t.Errorf("signed messages: %v", err)
+	}
+	if v, err := verify(transfer(k, 5, firstAndLast)); err != nil || len(v.unsigned) != 0 || v.signed != 2 {
+		t.Errorf("unsigned messages in between: %v", err)
+	}
+	// exchange refuses the transfer if the last message is unsigned
+	if v, err := verify(transfer(k, 3, func(i int) bool { return i == 0 })); err != nil || len(v.unsigned) == 0 {
+		t.Errorf("unsigned last message: %v", err)
+	}
+	if _, err := verify(transfer(k, 2, func(i int) bool { return i == 1 })); err == nil {
+		t.Error("unsigned first message is accepted")
+	}
+
+	// a changed message, messages out of order or signed by another key are
+	// refused
+	msgs := transfer(k, 3, all)
+	msgs[1][len(response(1))-1] ^= 1
+	if _, err := verify(msgs); err == nil || !strings.Contains(err.Error(), "message 1") {
+		t.Errorf("changed message: %v", err)
+	}
+	msgs = transfer(k, 5, firstAndLast)
+	msgs[2] = response(9)
+	if _, err := verify(msgs); err == nil || !strings.Contains(err.Error(), "message 4") {
+		t.Errorf("changed unsigned message: %v", err)
+	}
+	msgs = transfer(k, 3, all)
+	msgs[1], msgs[2] = msgs[2], msgs[1]
+	if _, err := verify(msgs); err == nil {
+		t.Error("messages out of order are accepted")
+	}
+	other := *k
+	other.secret = []byte("other")
+	if _, err := verify(transfer(&other, 1, all)); err == nil {
+		t.Error("message signed by another key is accepted")
+	}
+	old, _ := signResponse(t, k, response(0), requestMAC, nil, true, uint64(time.Now().Add(-time.Hour).Unix()))
+	if _, err := verify([][]byte{old}); err == nil || !strings.Contains(err.Error(), "time") {
+		t.Errorf("message signed an hour ago: %v", err)
+	}
+}
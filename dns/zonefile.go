@@ -0,0 +1,447 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// ZoneFile changes records in zone files on disk in the master file
+	// format of RFC 1035, which a local authoritative server like BIND, Knot
+	// or NSD can serve. Added records are appended, deleted records are
+	// removed from the file, the rest of it is kept as it is, and the serial
+	// of the SOA record is increased on each change. The ID of a record is
+	// its name, type and quoted content.
+	ZoneFile struct {
+		// Files are the paths of the zone files by their zones
+		Files map[string]string
+		// Reload is a command to run with the zone as the last argument after
+		// the file of the zone is changed, like "rndc reload"
+		Reload []string
+
+		TTL int
+
+		mu sync.Mutex
+	}
+
+	// zoneEntry is a record in a zone file, on lines [start, end).
+	zoneEntry struct {
+		start, end int
+		owner      string
+		// implicit is true if the owner is the one of the previous record
+		implicit bool
+		rtype    string
+		rdata    []zoneToken
+	}
+
+	// zoneToken is a word or quoted string at column col of line.
+	zoneToken struct {
+		text      string
+		line, col int
+	}
+)
+
+var _ DNS = (*ZoneFile)(nil)
+
+func init() {
+	Register(Provider{
+		Name: "zonefile",
+		Options: []Option{
+			{Name: "files", Type: OptionList, Required: true},
+			{Name: "reload", Type: OptionCommand},
+			{Name: "ttl", Type: OptionInt},
+		},
+		New: func(o Options) (DNS, error) {
+			files, err := parseZoneFiles(o.Strings("files"))
+			if err != nil {
+				return nil, err
+			}
+			return &ZoneFile{Files: files, Reload: o.Strings("reload"), TTL: o.Int("ttl")}, nil
+		},
+		FromEnv: func() (DNS, error) {
+			return NewZoneFileFromEnv()
+		},
+	})
+}
+
+var zoneTTL = regexp.MustCompile(`^[0-9]+([smhdwSMHDW][0-9]*)*$`)
+
+// NewZoneFileFromEnv returns a ZoneFile configured by the environment
+// variables ZONE_FILES (comma-separated zone=path, like
+// example.com=/etc/bind/db.example.com) and ZONE_FILE_RELOAD (the command and
+// its arguments, separated by spaces).
+func NewZoneFileFromEnv() (*ZoneFile, error) {
+	files, err := parseZoneFiles(strings.Split(os.Getenv("ZONE_FILES"), ","))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("zonefile: please set ZONE_FILES")
+	}
+	return &ZoneFile{
+		Files:  files,
+		Reload: strings.Fields(os.Getenv("ZONE_FILE_RELOAD")),
+	}, nil
+}
+
+// parseZoneFiles returns the paths of the zone files by their zones from
+// entries like example.com=/etc/bind/db.example.com.
+func parseZoneFiles(entries []string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, file := range entries {
+		if file = strings.TrimSpace(file); file == "" {
+			continue
+		}
+		parts := strings.SplitN(file, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("zonefile: bad zone file " + file)
+		}
+		files[strings.ToLower(strings.TrimSuffix(parts[0], "."))] = parts[1]
+	}
+	return files, nil
+}
+
+// zoneTokens returns the tokens of the entry starting at line i of lines,
+// which continues to the next lines inside parentheses, and the line after
+// it.
+func zoneTokens(lines []string, i int) ([]zoneToken, int, error) {
+	var tokens []zoneToken
+	depth := 0
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		for col := 0; col < len(line); {
+			c := line[col]
+			switch {
+			case c == ';':
+				col = len(line)
+			case c == ' ' || c == '\t' || c == '\r':
+				col++
+			case c == '(':
+				depth++
+				col++
+			case c == ')':
+				if depth--; depth < 0 {
+					return nil, 0, fmt.Errorf("line %d: unbalanced )", i+1)
+				}
+				col++
+			default:
+				end := col
+				if c == '"' {
+					for end++; end < len(line) && line[end] != '"'; end++ {
+						if line[end] == '\\' {
+							end++
+						}
+					}
+					if end >= len(line) {
+						return nil, 0, fmt.Errorf("line %d: unterminated string", i+1)
+					}
+					end++
+				} else {
+					for ; end < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[end])); end++ {
+						if line[end] == '\\' {
+							end++
+						}
+					}
+					if end > len(line) {
+						end = len(line)
+					}
+				}
+				tokens = append(tokens, zoneToken{line[col:end], i, col})
+				col = end
+			}
+		}
+		if depth == 0 {
+			return tokens, i + 1, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("line %d: unbalanced (", len(lines))
+}
+
+// absoluteName returns name relative to origin as a domain name without the
+// trailing dot.
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(strings.TrimSuffix(name, "."))
+	case origin == "":
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name) + "." + origin
+}
+
+// parseZone returns the records of a zone file with the origin.
+func parseZone(lines []string, origin string) ([]zoneEntry, error) {
+	var entries []zoneEntry
+	owner := ""
+	for i := 0; i < len(lines); {
+		tokens, next, err := zoneTokens(lines, i)
+		if err != nil {
+			return nil, err
+		}
+		start := i
+		i = next
+		if len(tokens) == 0 {
+			continue
+		}
+		switch strings.ToUpper(tokens[0].text) {
+		case "$ORIGIN":
+			if len(tokens) < 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN without name", start+1)
+			}
+			origin = absoluteName(tokens[1].text, origin)
+			continue
+		case "$TTL":
+			continue
+		case "$INCLUDE", "$GENERATE":
+			return nil, fmt.Errorf("line %d: %s is not supported", start+1, tokens[0].text)
+		}
+		entry := zoneEntry{start: start, end: next}
+		if line := lines[start]; line[0] == ' ' || line[0] == '\t' {
+			if owner == "" {
+				return nil, fmt.Errorf("line %d: no owner name", start+1)
+			}
+			entry.implicit = true
+		} else {
+			owner = absoluteName(tokens[0].text, origin)
+			tokens = tokens[1:]
+		}
+		entry.owner = owner
+		// the TTL and the class can be in any order before the type
+		for n := 0; n < 2 && len(tokens) > 0; n++ {
+			word := strings.ToUpper(tokens[0].text)
+			if zoneTTL.MatchString(word) || word == "IN" || word == "CH" || word == "HS" || word == "CS" {
+				tokens = tokens[1:]
+			}
+		}
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("line %d: no record type", start+1)
+		}
+		entry.rtype = strings.ToUpper(tokens[0].text)
+		entry.rdata = tokens[1:]
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// content returns the content of the record like the other providers, TXT
+// records without quotes.
+func (e zoneEntry) content() string {
+	var words []string
+	for _, t := range e.rdata {
+		words = append(words, t.text)
+	}
+	return unquoteTXT(e.rtype, strings.Join(words, " "))
+}
+
+// inZone returns whether the owner of the record is in the zone domain.
+func (e zoneEntry) inZone(domain string) bool {
+	return e.owner == domain || strings.HasSuffix(e.owner, "."+domain)
+}
+
+func (z *ZoneFile) path(domain string) (string, error) {
+	path, ok := z.Files[domain]
+	if !ok {
+		return "", errors.New("zonefile: no file of zone " + domain)
+	}
+	return path, nil
+}
+
+// read returns the lines and records of the file of the zone.
+func (z *ZoneFile) read(domain string) (string, []string, []zoneEntry, error) {
+	path, err := z.path(domain)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, nil, errors.New("zonefile: " + err.Error())
+	}
+	lines := strings.Split(string(content), "\n")
+	entries, err := parseZone(lines, domain)
+	if err != nil {
+		return "", nil, nil, errors.New("zonefile: " + path + ": " + err.Error())
+	}
+	return path, lines, entries, nil
+}
+
+// write increases the serial of the SOA record in lines, replaces the file
+// at path with them and reloads the zone.
+func (z *ZoneFile) write(domain, path string, lines []string, entries []zoneEntry) error {
+	for _, e := range entries {
+		if e.rtype != "SOA" || !e.inZone(domain) || len(e.rdata) < 3 {
+			continue
+		}
+		t := e.rdata[2]
+		serial, err := strconv.ParseUint(t.text, 10, 32)
+		if err != nil {
+			return errors.New("zonefile: " + path + ": bad SOA serial " + t.text)
+		}
+		// serial numbers wrap around (RFC 1982), skipping 0
+		serial = (serial + 1) % (1 << 32)
+		if serial == 0 {
+			serial = 1
+		}
+		line := lines[t.line]
+		lines[t.line] = line[:t.col] + strconv.FormatUint(serial, 10) + line[t.col+len(t.text):]
+		break
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.New("zonefile: " + err.Error())
+	}
+	// the file is replaced at once, so the server never reads half of it
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return errors.New("zonefile: " + err.Error())
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strings.Join(lines, "\n"))
+	if err == nil {
+		err = f.Chmod(info.Mode())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return errors.New("zonefile: " + err.Error())
+	}
+	if len(z.Reload) > 0 {
+		if _, err := run(z.Reload[0], append(z.Reload[1:], domain)...); err != nil {
+			return errors.New("zonefile: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (z *ZoneFile) GetListOfDomains() ([]string, error) {
+	domains := []string{}
+	for domain := range z.Files {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
+
+func (z *ZoneFile) GetRecords(domain string) (records []Record, err error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	_, _, entries, err := z.read(domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.inZone(domain) {
+			continue
+		}
+		name := relativeName(domain, e.owner)
+		content := e.content()
+		records = append(records, Record{
+			Id:       recordId(name, e.rtype, content),
+			Type:     e.rtype,
+			Name:     name,
+			FullName: e.owner,
+			Content:  content,
+		})
+	}
+	return
+}
+
+func (z *ZoneFile) GetRecordIdsFor(domain, dname, dtype string) ([]string, error) {
+	records, err := z.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, r := range records {
+		if r.Name == strings.ToLower(dname) && r.Type == dtype {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids, nil
+}
+
+// findZoneEntry returns the index of the record with the name, type and content in
+// entries, or -1.
+func findZoneEntry(entries []zoneEntry, domain, dname, dtype, content string) int {
+	for i, e := range entries {
+		if e.inZone(domain) && relativeName(domain, e.owner) == strings.ToLower(dname) &&
+			e.rtype == dtype && e.content() == content {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddNewRecord appends the record to the file of the zone, unless it is
+// already there.
+func (z *ZoneFile) AddNewRecord(domain, dname, dtype, dvalue string) (string, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	path, lines, entries, err := z.read(domain)
+	if err != nil {
+		return "", err
+	}
+	id := recordId(strings.ToLower(dname), dtype, dvalue)
+	if findZoneEntry(entries, domain, dname, dtype, dvalue) >= 0 {
+		return id, nil
+	}
+	ttl := z.TTL
+	if ttl == 0 {
+		ttl = 60
+	}
+	name := domain
+	if dname != "@" {
+		name = dname + "." + domain
+	}
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	lines = append(lines, fmt.Sprintf("%s\t%d\tIN\t%s\t%s", fqdn(name), ttl, dtype, quoteTXT(dtype, dvalue)), "")
+	if err := z.write(domain, path, lines, entries); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DeleteRecord removes the lines of the record from the file of the zone, if
+// it is there.
+func (z *ZoneFile) DeleteRecord(domain, id string) error {
+	dname, dtype, content, err := parseRecordId(id)
+	if err != nil {
+		return errors.New("zonefile: " + err.Error())
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	path, lines, entries, err := z.read(domain)
+	if err != nil {
+		return err
+	}
+	i := findZoneEntry(entries, domain, dname, dtype, content)
+	if i < 0 {
+		return nil
+	}
+	e := entries[i]
+	// the next record takes the owner of the deleted one
+	if i+1 < len(entries) && !e.implicit && entries[i+1].implicit {
+		next := entries[i+1].start
+		lines[next] = fqdn(e.owner) + lines[next]
+	}
+	lines = append(lines[:e.start:e.start], lines[e.end:]...)
+	if entries, err = parseZone(lines, domain); err != nil {
+		return errors.New("zonefile: " + path + ": " + err.Error())
+	}
+	return z.write(domain, path, lines, entries)
+}
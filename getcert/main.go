@@ -3,10 +3,14 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -14,6 +18,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -21,6 +26,7 @@ import (
 	"sync"
 	"time"
 
+	"filippo.io/age"
 	"github.com/caiguanhao/ossslim"
 )
 
@@ -33,20 +39,51 @@ var (
 
 	force     bool
 	showDates bool
+	strict    bool
 
 	suffixes = []string{".cert", ".key"}
 
-	client ossslim.Client
+	client     ossslim.Client
+	identities []age.Identity
 )
 
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 const (
 	certsDir = "certs/"
+
+	// gcmMagic starts the header of objects uploaded with associated data,
+	// see encrypt in upcert.
+	gcmMagic = "certutils-gcm/v2 "
+
+	// ageMagic starts the plaintext of objects encrypted with age, see
+	// encryptAge in upcert.
+	ageMagic = "certutils-age/v1 "
 )
 
 func main() {
 	flag.BoolVar(&force, "f", false, "overwrite existing file")
-	flag.BoolVar(&showDates, "d", false, "display expiration dates")
+	flag.BoolVar(&showDates, "d", false, "display expiration dates and key types")
+	listOnly := flag.Bool("l", false, "print names of stored files and exit")
+	flag.BoolVar(&strict, "strict", false, "refuse legacy files uploaded without associated data or object name")
+	var identityFiles stringsFlag
+	flag.Var(&identityFiles, "i", "age identity file to decrypt files encrypted to recipients, can be used multiple times")
+	usePassphrase := flag.Bool("p", false, "decrypt files encrypted with a passphrase (from $GETCERT_PASSPHRASE or prompt)")
 	flag.Parse()
+	var err error
+	identities, err = getIdentities(identityFiles, *usePassphrase)
+	if err != nil {
+		log.Fatal(err)
+	}
 	client = ossslim.Client{
 		AccessKeyId:     ossAccessKeyId,
 		AccessKeySecret: ossAccessKeySecret,
@@ -54,18 +91,20 @@ func main() {
 		Bucket:          ossBucket,
 	}
 	targets := flag.Args()
+	var revoked map[string]bool
 	if len(targets) == 0 {
 		log.Println("getting list of certs")
-		result, err := client.List(certsDir, false)
+		files, err := listFiles()
 		if err != nil {
 			panic(err)
 		}
+		revoked = revokedNames(files)
 		names := []string{}
 		combined := map[string][]string{}
-		for _, f := range result.Files {
+		for _, f := range files {
 			for _, s := range suffixes {
-				if strings.HasSuffix(f.Name, s) {
-					name := strings.TrimSuffix(f.Name[len(certsDir):], s)
+				if strings.HasSuffix(f, s) {
+					name := strings.TrimSuffix(f[len(certsDir):], s)
 					if _, ok := combined[name]; !ok {
 						names = append(names, name)
 					}
@@ -75,6 +114,18 @@ func main() {
 		}
 		sort.Strings(names)
 
+		if *listOnly {
+			for _, name := range names {
+				if revoked[name] {
+					continue
+				}
+				for _, s := range combined[name] {
+					fmt.Println(name + s)
+				}
+			}
+			return
+		}
+
 		var notAfters *sync.Map
 		if showDates {
 			notAfters = getNotAfters(names)
@@ -83,7 +134,9 @@ func main() {
 		printTo := func(w io.Writer) {
 			for i, name := range names {
 				var extra string
-				if notAfters != nil {
+				if revoked[name] {
+					extra = " - revoked"
+				} else if notAfters != nil {
 					if notAfter, ok := notAfters.Load(name); ok {
 						extra = " - " + notAfter.(string)
 					}
@@ -137,11 +190,22 @@ func main() {
 			}
 		}
 	}
+	if revoked == nil {
+		files, err := listFiles()
+		if err != nil {
+			panic(err)
+		}
+		revoked = revokedNames(files)
+	}
 	for _, t := range targets {
 		if !strings.HasPrefix(t, certsDir) {
 			t = certsDir + t
 		}
 		file := filepath.Base(t)
+		if name := trimSuffixes(file); revoked[name] {
+			log.Println(file+":", name, "has been revoked")
+			continue
+		}
 		if !canWrite(file) {
 			continue
 		}
@@ -152,19 +216,103 @@ func main() {
 			log.Println(err)
 			continue
 		}
-		content, err := decrypt(buffer.Bytes())
-		if err != nil {
-			log.Println(err)
+		if buffer.Len() == 0 {
+			// upcert -revoke -delete-key empties the key
+			log.Println(file+": file is empty,", trimSuffixes(file), "has been revoked")
 			continue
 		}
-		err = ioutil.WriteFile(file, content, 0600)
+		content, uploadedAt, err := decrypt(t, buffer.Bytes())
 		if err != nil {
+			log.Println(file+":", err)
+			continue
+		}
+		if err := checkRollback(file, content, uploadedAt); err != nil {
+			log.Println(file+":", err)
+			continue
+		}
+		if err := writeFile(file, content); err != nil {
 			log.Println(err)
+			continue
 		}
 		log.Println("written", file)
 	}
 }
 
+// writeFile writes content to file with the mode 0600, also if the file
+// exists with another mode, as it can be a private key.
+func writeFile(file string, content []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// listFiles returns the names of all files in certsDir.
+func listFiles() ([]string, error) {
+	result, err := client.List(certsDir, false)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range result.Files {
+		files = append(files, f.Name)
+	}
+	return files, nil
+}
+
+// revokedNames returns names marked as revoked by upcert -revoke. The marks
+// are encrypted with the built-in key, a mark which fails to decrypt was not
+// written by upcert and is ignored. Legacy plain text marks are honored unless
+// -strict is used.
+func revokedNames(files []string) map[string]bool {
+	revoked := map[string]bool{}
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".revoked") {
+			continue
+		}
+		name := strings.TrimSuffix(f[len(certsDir):], ".revoked")
+		var buffer bytes.Buffer
+		if _, err := client.Download(f, &buffer); err != nil {
+			// a mark that can't be checked is honored
+			log.Println(name+".revoked:", err)
+			revoked[name] = true
+			continue
+		}
+		content := buffer.Bytes()
+		if !bytes.HasPrefix(content, []byte(gcmMagic)) {
+			if strict {
+				log.Println("warning:", name+".revoked is not encrypted, ignored by -strict")
+				continue
+			}
+			log.Println("warning:", name+".revoked is not encrypted, mark it again with upcert -revoke")
+			revoked[name] = true
+			continue
+		}
+		if _, _, err := decrypt(f, content); err != nil {
+			log.Println("warning:", name+".revoked is ignored:", err)
+			continue
+		}
+		revoked[name] = true
+	}
+	return revoked
+}
+
+func trimSuffixes(file string) string {
+	for _, s := range suffixes {
+		file = strings.TrimSuffix(file, s)
+	}
+	return file
+}
+
 func canWrite(path string) bool {
 	if force {
 		return true
@@ -192,21 +340,197 @@ func canWrite(path string) bool {
 	return input == "y"
 }
 
-func decrypt(content []byte) ([]byte, error) {
+func getIdentities(files []string, usePassphrase bool) ([]age.Identity, error) {
+	var ids []age.Identity
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		is, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bad identity file %s: %w", file, err)
+		}
+		ids = append(ids, is...)
+	}
+	if usePassphrase {
+		passphrase, err := readPassphrase("GETCERT_PASSPHRASE")
+		if err != nil {
+			return nil, err
+		}
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// readPassphrase returns the passphrase in the environment variable env, or
+// reads it from the terminal. The passphrase is kept as it is typed, only the
+// line ending is removed.
+func readPassphrase(env string) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+	stty := func(args ...string) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	reader := bufio.NewReader(os.Stdin)
+	var passphrase string
+	for passphrase == "" {
+		fmt.Fprint(os.Stderr, "Enter passphrase: ")
+		stty("-echo")
+		input, err := reader.ReadString('\n')
+		stty("echo")
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		passphrase = strings.TrimRight(input, "\r\n")
+	}
+	return passphrase, nil
+}
+
+// associatedData must match the one in upcert.
+func associatedData(object, kind string, timestamp int64) []byte {
+	return []byte(gcmMagic + object + "\n" + kind + "\n" + strconv.FormatInt(timestamp, 10))
+}
+
+// decrypt returns the content of an object and its upload time, which is
+// zero for legacy objects.
+func decrypt(object string, content []byte) ([]byte, time.Time, error) {
+	if bytes.HasPrefix(content, []byte("age-encryption.org/")) {
+		return decryptAge(object, content)
+	}
+	var ad []byte
+	var uploadedAt time.Time
+	if bytes.HasPrefix(content, []byte(gcmMagic)) {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			return nil, uploadedAt, errors.New("bad header")
+		}
+		timestamp, err := strconv.ParseInt(string(content[len(gcmMagic):i]), 10, 64)
+		if err != nil {
+			return nil, uploadedAt, errors.New("bad header")
+		}
+		kind := strings.TrimPrefix(path.Ext(object), ".")
+		ad = associatedData(object, kind, timestamp)
+		content = content[i+1:]
+		uploadedAt = time.Unix(timestamp, 0)
+		if uploadedAt.After(time.Now().Add(time.Hour)) {
+			return nil, uploadedAt, errors.New("upload time is in the future")
+		}
+	} else if strict {
+		return nil, uploadedAt, errors.New("legacy file without associated data, refused by -strict")
+	} else {
+		log.Println("warning:", object, "was uploaded without associated data, its name is not authenticated; re-upload it with upcert")
+	}
 	block, err := aes.NewCipher([]byte(encryptionKey))
 	if err != nil {
-		return nil, err
+		return nil, uploadedAt, err
 	}
 
 	aesgcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return nil, err
+		return nil, uploadedAt, err
 	}
 
 	nonceSize := aesgcm.NonceSize()
+	if len(content) < nonceSize {
+		return nil, uploadedAt, errors.New("ciphertext too short")
+	}
 	nonce, ciphertext := content[:nonceSize], content[nonceSize:]
 
-	return aesgcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, ad)
+	if err != nil && ad != nil {
+		return nil, uploadedAt, errors.New("authentication failed, object name, kind or upload time does not match")
+	}
+	return plaintext, uploadedAt, err
+}
+
+// decryptAge decrypts an object encrypted with age, whose plaintext starts
+// with its object name and upload time.
+func decryptAge(object string, content []byte) ([]byte, time.Time, error) {
+	var uploadedAt time.Time
+	if len(identities) == 0 {
+		return nil, uploadedAt, errors.New("file is encrypted with age, use -i or -p to decrypt")
+	}
+	r, err := age.Decrypt(bytes.NewReader(content), identities...)
+	if err != nil {
+		return nil, uploadedAt, err
+	}
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, uploadedAt, err
+	}
+	if !bytes.HasPrefix(plaintext, []byte(ageMagic)) {
+		if strict {
+			return nil, uploadedAt, errors.New("legacy age file without object name, refused by -strict")
+		}
+		log.Println("warning:", object, "was encrypted without its object name, its name is not authenticated; re-upload it with upcert")
+		return plaintext, uploadedAt, nil
+	}
+	lines := bytes.SplitN(plaintext[len(ageMagic):], []byte("\n"), 3)
+	if len(lines) != 3 {
+		return nil, uploadedAt, errors.New("bad header")
+	}
+	if string(lines[0]) != object {
+		return nil, uploadedAt, errors.New("authentication failed, object name does not match")
+	}
+	timestamp, err := strconv.ParseInt(string(lines[1]), 10, 64)
+	if err != nil {
+		return nil, uploadedAt, errors.New("bad header")
+	}
+	uploadedAt = time.Unix(timestamp, 0)
+	if uploadedAt.After(time.Now().Add(time.Hour)) {
+		return nil, uploadedAt, errors.New("upload time is in the future")
+	}
+	return lines[2], uploadedAt, nil
+}
+
+// checkRollback returns error if the downloaded certificate is older than the
+// one installed in file, i.e. it was uploaded before the installed one was
+// issued, or was issued before it, so that an old certificate put back in the
+// bucket is not installed again.
+func checkRollback(file string, content []byte, uploadedAt time.Time) error {
+	if !strings.HasSuffix(file, ".cert") {
+		return nil
+	}
+	installed, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	old := parseCertificate(installed)
+	if old == nil {
+		return nil
+	}
+	if !uploadedAt.IsZero() && uploadedAt.Before(old.NotBefore) {
+		return fmt.Errorf("rollback: uploaded at %s, before the installed certificate was issued at %s",
+			uploadedAt.UTC().Format(time.RFC3339), old.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if cert := parseCertificate(content); cert != nil && cert.NotBefore.Before(old.NotBefore) {
+		return fmt.Errorf("rollback: issued at %s, before the installed certificate was issued at %s",
+			cert.NotBefore.UTC().Format(time.RFC3339), old.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// parseCertificate returns the first certificate in content, or nil.
+func parseCertificate(content []byte) *x509.Certificate {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert
 }
 
 func getNotAfter(name string) (string, error) {
@@ -215,7 +539,7 @@ func getNotAfter(name string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	content, err := decrypt(buffer.Bytes())
+	content, _, err := decrypt(certsDir+name+".cert", buffer.Bytes())
 	if err != nil {
 		return "", err
 	}
@@ -225,7 +549,19 @@ func getNotAfter(name string) (string, error) {
 		return "", err
 	}
 	days := int(time.Until(cert.NotAfter).Hours() / 24)
-	return fmt.Sprintf("%s (%d days)", cert.NotAfter.Format("2006-01-02"), days), nil
+	return fmt.Sprintf("%s (%d days, %s)", cert.NotAfter.Format("2006-01-02"), days, describeKey(cert.PublicKey)), nil
+}
+
+// describeKey returns the key type of a public key in the same form as the
+// -key-type option of mkcert, for example "ecdsa-p256" or "rsa2048".
+func describeKey(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ecdsa-" + strings.ToLower(strings.Replace(k.Curve.Params().Name, "-", "", 1))
+	case *rsa.PublicKey:
+		return "rsa" + strconv.Itoa(k.N.BitLen())
+	}
+	return fmt.Sprintf("%T", pub)
 }
 
 func getNotAfters(names []string) *sync.Map {
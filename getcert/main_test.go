@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+// encrypt encrypts content with the built-in key like upcert does, as object
+// uploaded at timestamp, or without associated data (v1) if timestamp is 0.
+func encrypt(t *testing.T, object string, content []byte, timestamp int64) []byte {
+	block, err := aes.NewCipher([]byte(encryptionKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aesgcm.NonceSize())
+	rand.Read(nonce)
+	if timestamp == 0 {
+		return aesgcm.Seal(nonce, nonce, content, nil)
+	}
+	header := []byte(gcmMagic + strconv.FormatInt(timestamp, 10) + "\n")
+	kind := strings.TrimPrefix(filepath.Ext(object), ".")
+	return aesgcm.Seal(append(header, nonce...), nonce, content, associatedData(object, kind, timestamp))
+}
+
+func TestDecrypt(t *testing.T) {
+	encryptionKey = "0123456789abcdef0123456789abcdef"
+	defer func() { encryptionKey, strict = "", false }()
+	uploaded := encrypt(t, "certs/example.com.cert", []byte("CERT"), 1700000000)
+	// the upload time in the header is authenticated
+	older := append([]byte(gcmMagic+"1600000000"), uploaded[bytes.IndexByte(uploaded, '\n'):]...)
+	future := time.Now().Add(2 * time.Hour).Unix()
+
+	for _, test := range []struct {
+		name    string
+		object  string
+		content []byte
+		strict  bool
+		err     string
+	}{
+		{"valid", "certs/example.com.cert", uploaded, false, ""},
+		{"valid strict", "certs/example.com.cert", uploaded, true, ""},
+		{"renamed", "certs/example.net.cert", uploaded, false, "authentication failed, object name, kind or upload time does not match"},
+		{"copied to another kind", "certs/example.com.key", uploaded, false, "authentication failed, object name, kind or upload time does not match"},
+		{"older upload time", "certs/example.com.cert", older, false, "authentication failed, object name, kind or upload time does not match"},
+		{"future", "certs/example.com.cert", encrypt(t, "certs/example.com.cert", []byte("CERT"), future), false, "upload time is in the future"},
+		{"bad header", "certs/example.com.cert", []byte(gcmMagic + "1700000000"), false, "bad header"},
+		{"bad time", "certs/example.com.cert", []byte(gcmMagic + "yesterday\n"), false, "bad header"},
+		{"v1", "certs/example.com.cert", encrypt(t, "certs/example.com.cert", []byte("CERT"), 0), false, ""},
+		{"v1 strict", "certs/example.com.cert", encrypt(t, "certs/example.com.cert", []byte("CERT"), 0), true, "legacy file without associated data, refused by -strict"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			strict = test.strict
+			content, uploadedAt, err := decrypt(test.object, test.content)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("error is %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil || string(content) != "CERT" {
+				t.Errorf("content is %q (%v)", content, err)
+			}
+			if v1 := !bytes.HasPrefix(test.content, []byte(gcmMagic)); v1 != uploadedAt.IsZero() ||
+				!v1 && !uploadedAt.Equal(time.Unix(1700000000, 0)) {
+				t.Errorf("upload time is %s", uploadedAt)
+			}
+		})
+	}
+
+	encryptionKey = "fedcba9876543210fedcba9876543210"
+	if _, _, err := decrypt("certs/example.com.cert", uploaded); err == nil {
+		t.Error("decrypted with another key")
+	}
+}
+
+// certificate returns a self-signed certificate in PEM issued at notBefore.
+func certificate(t *testing.T, notBefore time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCheckRollback(t *testing.T) {
+	dir := t.TempDir()
+	issuedAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	installed := filepath.Join(dir, "example.com.cert")
+	if err := ioutil.WriteFile(installed, certificate(t, issuedAt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newer := certificate(t, issuedAt.Add(time.Hour))
+	older := certificate(t, issuedAt.Add(-time.Hour))
+
+	for _, test := range []struct {
+		name       string
+		file       string
+		content    []byte
+		uploadedAt time.Time
+		err        string
+	}{
+		{"newer", installed, newer, issuedAt.Add(2 * time.Hour), ""},
+		{"newer v1", installed, newer, time.Time{}, ""},
+		{"uploaded before", installed, newer, issuedAt.Add(-time.Minute), "rollback: uploaded at"},
+		{"issued before", installed, older, issuedAt.Add(time.Hour), "rollback: issued at"},
+		{"issued before v1", installed, older, time.Time{}, "rollback: issued at"},
+		{"not installed", filepath.Join(dir, "example.net.cert"), older, issuedAt.Add(-time.Hour), ""},
+		{"key", filepath.Join(dir, "example.com.key"), []byte("KEY"), issuedAt.Add(-time.Hour), ""},
+	} {
+		err := checkRollback(test.file, test.content, test.uploadedAt)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)) {
+			t.Errorf("%s: error is %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+// encryptAge encrypts plaintext to the identity like upcert does, with the
+// header given in plaintext.
+func encryptAge(t *testing.T, id *age.X25519Identity, plaintext string) []byte {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(plaintext))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecryptAge(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { identities, strict = nil, false }()
+	future := time.Now().Add(2 * time.Hour).Unix()
+
+	for _, test := range []struct {
+		name      string
+		object    string
+		plaintext string
+		strict    bool
+		content   string
+		err       string
+	}{
+		{"valid", "certs/example.com.cert", "certutils-age/v1 certs/example.com.cert\n1700000000\nCERT", false, "CERT", ""},
+		{"valid strict", "certs/example.com.cert", "certutils-age/v1 certs/example.com.cert\n1700000000\nCERT", true, "CERT", ""},
+		{"renamed", "certs/example.net.cert", "certutils-age/v1 certs/example.com.cert\n1700000000\nCERT", false, "", "authentication failed, object name does not match"},
+		{"other kind", "certs/example.com.key", "certutils-age/v1 certs/example.com.cert\n1700000000\nCERT", false, "", "authentication failed, object name does not match"},
+		{"no time", "certs/example.com.cert", "certutils-age/v1 certs/example.com.cert\n", false, "", "bad header"},
+		{"bad time", "certs/example.com.cert", "certutils-age/v1 certs/example.com.cert\nyesterday\nCERT", false, "", "bad header"},
+		{"future", "certs/example.com.cert", "certutils-age/v1 certs/example.com.cert\n" + strconv.FormatInt(future, 10) + "\nCERT", false, "", "upload time is in the future"},
+		{"legacy", "certs/example.com.cert", "CERT", false, "CERT", ""},
+		{"legacy strict", "certs/example.com.cert", "CERT", true, "", "legacy age file without object name, refused by -strict"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			identities, strict = []age.Identity{other, id}, test.strict
+			content, uploadedAt, err := decrypt(test.object, encryptAge(t, id, test.plaintext))
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("error is %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil || string(content) != test.content {
+				t.Errorf("content is %q (%v), want %q", content, err, test.content)
+			}
+			if legacy := !strings.HasPrefix(test.plaintext, ageMagic); legacy != uploadedAt.IsZero() ||
+				!legacy && !uploadedAt.Equal(time.Unix(1700000000, 0)) {
+				t.Errorf("upload time is %s", uploadedAt)
+			}
+		})
+	}
+
+	identities = []age.Identity{other}
+	if _, _, err := decrypt("certs/example.com.cert", encryptAge(t, id, "CERT")); err == nil {
+		t.Error("decrypted with another identity")
+	}
+	identities = nil
+	if _, _, err := decrypt("certs/example.com.cert", encryptAge(t, id, "CERT")); err == nil || err.Error() != "file is encrypted with age, use -i or -p to decrypt" {
+		t.Errorf("error without identities is %v", err)
+	}
+}
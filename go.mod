@@ -4,4 +4,9 @@ go 1.16
 
 replace github.com/caiguanhao/certutils/dns => ./dns
 
-require github.com/caiguanhao/certutils/dns v0.0.0
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/caiguanhao/certutils/dns v0.0.0
+	gopkg.in/yaml.v2 v2.4.0
+	software.sslmate.com/src/go-pkcs12 v0.2.0
+)
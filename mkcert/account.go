@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ACME accounts are kept in the state directory, so that certbot does not
+// register a new account for every certificate. Each email has its own
+// directory which is mounted as certbot's /etc/letsencrypt/accounts, where
+// certbot keeps one account for each server:
+//
+//	STATE_DIR/accounts/EMAIL/SERVER_HOST/SERVER_PATH/ACCOUNT_ID/regr.json
+
+const noEmail = "no-email"
+
+type account struct {
+	email, server, dir string
+
+	URI     string
+	Contact []string
+	Created string
+}
+
+// accountsDir returns the directory of the accounts of an email.
+func accountsDir(email string) string {
+	if email == "" {
+		email = noEmail
+	}
+	email = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(email)
+	return filepath.Join(stateDir, "accounts", email)
+}
+
+// serverPath returns the path of a server in the accounts directory, which
+// is the same as certbot's.
+func serverPath(server string) string {
+	u, err := url.Parse(server)
+	if err != nil {
+		return server
+	}
+	return filepath.FromSlash(u.Host + u.Path)
+}
+
+func loadAccount(dir string) (*account, error) {
+	a := &account{dir: dir}
+	var regr struct {
+		Body struct {
+			Contact []string `json:"contact"`
+		} `json:"body"`
+		URI string `json:"uri"`
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "regr.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &regr); err != nil {
+		return nil, err
+	}
+	a.URI = regr.URI
+	a.Contact = regr.Body.Contact
+	var meta struct {
+		CreationDt string `json:"creation_dt"`
+	}
+	content, err = ioutil.ReadFile(filepath.Join(dir, "meta.json"))
+	if err == nil {
+		json.Unmarshal(content, &meta)
+		a.Created = meta.CreationDt
+	}
+	return a, nil
+}
+
+// listAccounts returns accounts of all emails and servers.
+func listAccounts() ([]*account, error) {
+	root := filepath.Join(stateDir, "accounts")
+	var accounts []*account
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || info.Name() != "regr.json" {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		a, err := loadAccount(dir)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(dir))
+		if err != nil {
+			return err
+		}
+		parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		a.email, a.server = parts[0], "https://"+parts[1]
+		accounts = append(accounts, a)
+		return nil
+	})
+	return accounts, err
+}
+
+// findAccount returns the account of the current -server and -email.
+func findAccount() (*account, error) {
+	dir := filepath.Join(accountsDir(email), serverPath(serverURL))
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var found *account
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("more than one account in " + dir)
+		}
+		found, err = loadAccount(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if found == nil {
+		return nil, errors.New("no account for " + serverURL + " with email " + emailOrNone(email))
+	}
+	return found, nil
+}
+
+func emailOrNone(email string) string {
+	if email == "" {
+		return "(none)"
+	}
+	return email
+}
+
+// key returns the private key of the account.
+func (a *account) key() (*rsa.PrivateKey, error) {
+	content, err := ioutil.ReadFile(filepath.Join(a.dir, "private_key.json"))
+	if err != nil {
+		return nil, err
+	}
+	var k jwk
+	if err := json.Unmarshal(content, &k); err != nil {
+		return nil, err
+	}
+	return k.privateKey()
+}
+
+// certbotAccountId returns the id of an account key like certbot does, which
+// is the MD5 hash of its public key in PEM.
+func certbotAccountId(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// rotateKey replaces the key of an account with a new key, on the server and
+// in the state directory.
+func rotateKey(a *account) error {
+	oldKey, err := a.key()
+	if err != nil {
+		return err
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	id, err := certbotAccountId(newKey)
+	if err != nil {
+		return err
+	}
+	dir, err := getDirectory(serverURL)
+	if err != nil {
+		return err
+	}
+	if err := changeKey(dir, a.URI, oldKey, newKey); err != nil {
+		return err
+	}
+	log.Println("changed key of account", a.URI)
+
+	// certbot finds the account by the id, so the account is moved to a
+	// directory named after the new key
+	newDir := filepath.Join(filepath.Dir(a.dir), id)
+	if err := os.MkdirAll(newDir, 0700); err != nil {
+		return err
+	}
+	for _, name := range []string{"regr.json", "meta.json"} {
+		content, err := ioutil.ReadFile(filepath.Join(a.dir, name))
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(newDir, name), content, 0644); err != nil {
+			return err
+		}
+	}
+	content, err := json.Marshal(newJWK(newKey, true))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(newDir, "private_key.json"), content, 0400); err != nil {
+		return err
+	}
+	log.Println("written account", newDir)
+	return os.RemoveAll(a.dir)
+}
+
+// runCertbot runs a certbot command other than certonly with the accounts of
+// the current -email.
+func runCertbot(args ...string) error {
+	dockerArgs, _, err := certbotServerArgs()
+	if err != nil {
+		return err
+	}
+	command := []string{"docker", "run", "--rm", "-i", "--platform", "linux/amd64"}
+	command = append(command, dockerArgs...)
+	command = append(command, certbotImage)
+	command = append(command, args...)
+	command = append(command, "--server", serverURL, "-n")
+	if debug {
+		log.Println("running", command)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func runAccount(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Error: please provide account command: list, rotate-key, update-email or deactivate")
+	}
+	switch args[0] {
+	case "list":
+		accounts, err := listAccounts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, a := range accounts {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", a.email, a.server, a.URI,
+				strings.Join(a.Contact, ","), a.Created)
+		}
+		return
+	case "rotate-key", "update-email", "deactivate":
+	default:
+		log.Fatal("Error: bad account command ", args[0])
+	}
+
+	a, err := findAccount()
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	log.Println("account:", a.URI)
+
+	switch args[0] {
+	case "rotate-key":
+		err = rotateKey(a)
+	case "update-email":
+		if len(args) != 2 || args[1] == "" {
+			log.Fatal("Error: please provide new email")
+		}
+		oldDir := filepath.Join(accountsDir(email), serverPath(serverURL))
+		newDir := filepath.Join(accountsDir(args[1]), serverPath(serverURL))
+		if _, err := os.Stat(newDir); err == nil {
+			log.Fatal("Error: ", args[1], " already has an account on ", serverURL)
+		}
+		err = runCertbot("update_account", "--email", args[1])
+		if err == nil {
+			// keep the account under the new email
+			if err = os.MkdirAll(filepath.Dir(newDir), 0700); err == nil {
+				err = os.Rename(oldDir, newDir)
+			}
+		}
+	case "deactivate":
+		err = runCertbot("unregister")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("done")
+}
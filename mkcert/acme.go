@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The few ACME (RFC 8555) requests certbot can't do for us.
+
+type (
+	directory struct {
+		NewNonce    string `json:"newNonce"`
+		NewOrder    string `json:"newOrder"`
+		KeyChange   string `json:"keyChange"`
+		RevokeCert  string `json:"revokeCert"`
+		RenewalInfo string `json:"renewalInfo"`
+	}
+
+	// jwk is a JSON Web Key of an RSA key, in the form certbot stores
+	// account keys in private_key.json, or the public key of an ECDSA key.
+	jwk struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv,omitempty"`
+		X   string `json:"x,omitempty"`
+		Y   string `json:"y,omitempty"`
+		N   string `json:"n,omitempty"`
+		E   string `json:"e,omitempty"`
+		D   string `json:"d,omitempty"`
+		P   string `json:"p,omitempty"`
+		Q   string `json:"q,omitempty"`
+		Dp  string `json:"dp,omitempty"`
+		Dq  string `json:"dq,omitempty"`
+		Qi  string `json:"qi,omitempty"`
+	}
+
+	acmeError struct {
+		Type   string `json:"type"`
+		Detail string `json:"detail"`
+	}
+)
+
+func (e acmeError) Error() string {
+	return e.Type + ": " + e.Detail
+}
+
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// getHTTPClient returns the client for the ACME server, which also trusts
+// the certificates in -ca-bundle. It is built once, orders run in parallel.
+func getHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+		if caBundle == "" {
+			return
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		content, err := ioutil.ReadFile(caBundle)
+		if err == nil {
+			pool.AppendCertsFromPEM(content)
+		}
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	})
+	return httpClient
+}
+
+func getDirectory(url string) (*directory, error) {
+	resp, err := getHTTPClient().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	var dir directory
+	if err := json.NewDecoder(resp.Body).Decode(&dir); err != nil {
+		return nil, err
+	}
+	return &dir, nil
+}
+
+func getNonce(dir *directory) (string, error) {
+	resp, err := getHTTPClient().Head(dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("no nonce from " + dir.NewNonce)
+	}
+	return nonce, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func b64Int(i *big.Int) string {
+	return b64(i.Bytes())
+}
+
+func newJWK(key *rsa.PrivateKey, private bool) jwk {
+	k := jwk{
+		Kty: "RSA",
+		N:   b64Int(key.N),
+		E:   b64Int(big.NewInt(int64(key.E))),
+	}
+	if private {
+		key.Precompute()
+		k.D = b64Int(key.D)
+		k.P = b64Int(key.Primes[0])
+		k.Q = b64Int(key.Primes[1])
+		k.Dp = b64Int(key.Precomputed.Dp)
+		k.Dq = b64Int(key.Precomputed.Dq)
+		k.Qi = b64Int(key.Precomputed.Qinv)
+	}
+	return k
+}
+
+// publicJWK returns the JWK of the public key of a certificate key.
+func publicJWK(key crypto.Signer) (jwk, error) {
+	switch k := key.Public().(type) {
+	case *rsa.PublicKey:
+		return jwk{Kty: "RSA", N: b64Int(k.N), E: b64Int(big.NewInt(int64(k.E)))}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return jwk{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   b64(k.X.FillBytes(make([]byte, size))),
+			Y:   b64(k.Y.FillBytes(make([]byte, size))),
+		}, nil
+	}
+	return jwk{}, errors.New("unsupported key type " + describeKey(key.Public()))
+}
+
+func (k jwk) privateKey() (*rsa.PrivateKey, error) {
+	if k.Kty != "RSA" {
+		return nil, errors.New("unsupported key type " + k.Kty)
+	}
+	var ints []*big.Int
+	for _, s := range []string{k.N, k.E, k.D, k.P, k.Q} {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, new(big.Int).SetBytes(b))
+	}
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: ints[0], E: int(ints[1].Int64())},
+		D:         ints[2],
+		Primes:    []*big.Int{ints[3], ints[4]},
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	key.Precompute()
+	return key, nil
+}
+
+// signJWS signs payload with key in flattened JSON serialization. The
+// protected header must have either "jwk" or "kid".
+func signJWS(key crypto.Signer, protected map[string]interface{}, payload []byte) ([]byte, error) {
+	alg, hash := "RS256", crypto.SHA256
+	if k, ok := key.Public().(*ecdsa.PublicKey); ok {
+		switch k.Curve {
+		case elliptic.P256():
+			alg = "ES256"
+		case elliptic.P384():
+			alg, hash = "ES384", crypto.SHA384
+		default:
+			return nil, errors.New("unsupported curve " + k.Curve.Params().Name)
+		}
+	}
+	protected["alg"] = alg
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	input := b64(header) + "." + b64(payload)
+	h := hash.New()
+	h.Write([]byte(input))
+	var sig []byte
+	if k, ok := key.(*ecdsa.PrivateKey); ok {
+		// JWS uses R and S of fixed size instead of ASN.1
+		r, s, err := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	} else if sig, err = key.Sign(rand.Reader, h.Sum(nil), hash); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   b64(payload),
+		"signature": b64(sig),
+	})
+}
+
+// post sends a JWS signed by the account key to url and decodes the JSON
+// response into result if it is not nil. If kid is empty, the JWS is signed
+// by a certificate key and has its public key instead. If result is a
+// *[]byte, the response body is returned as is. A nil payload makes a
+// POST-as-GET request.
+func post(dir *directory, key crypto.Signer, kid, url string, payload []byte, result interface{}) (http.Header, error) {
+	nonce, err := getNonce(dir)
+	if err != nil {
+		return nil, err
+	}
+	protected := map[string]interface{}{
+		"nonce": nonce,
+		"url":   url,
+	}
+	if kid != "" {
+		protected["kid"] = kid
+	} else if protected["jwk"], err = publicJWK(key); err != nil {
+		return nil, err
+	}
+	body, err := signJWS(key, protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := getHTTPClient().Post(url, "application/jose+json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var e acmeError
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Type != "" {
+			return nil, e
+		}
+		return nil, fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	if raw, ok := result.(*[]byte); ok {
+		*raw, err = ioutil.ReadAll(resp.Body)
+		return resp.Header, err
+	}
+	if result != nil {
+		return resp.Header, json.NewDecoder(resp.Body).Decode(result)
+	}
+	return resp.Header, nil
+}
+
+// changeKey replaces the key of the account at accountURL with newKey.
+func changeKey(dir *directory, accountURL string, oldKey, newKey *rsa.PrivateKey) error {
+	if dir.KeyChange == "" {
+		return errors.New("server does not support key change")
+	}
+	inner, err := json.Marshal(map[string]interface{}{
+		"account": accountURL,
+		"oldKey":  newJWK(oldKey, false),
+	})
+	if err != nil {
+		return err
+	}
+	signed, err := signJWS(newKey, map[string]interface{}{
+		"jwk": newJWK(newKey, false),
+		"url": dir.KeyChange,
+	}, inner)
+	if err != nil {
+		return err
+	}
+	_, err = post(dir, oldKey, accountURL, dir.KeyChange, signed, nil)
+	return err
+}
+
+// revokeCert revokes a certificate in DER, signed by the account key at kid
+// or, if kid is empty, by the key of the certificate.
+func revokeCert(dir *directory, key crypto.Signer, kid string, der []byte, reason int) error {
+	if dir.RevokeCert == "" {
+		return errors.New("server does not support revocation")
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"certificate": b64(der),
+		"reason":      reason,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = post(dir, key, kid, dir.RevokeCert, payload, nil)
+	return err
+}
+
+// thumbprint returns the JWK thumbprint (RFC 7638) of the account key, used
+// in key authorizations of challenges.
+func thumbprint(key *rsa.PrivateKey) string {
+	k := newJWK(key, false)
+	// members in lexicographic order, without whitespace
+	sum := sha256.Sum256([]byte(`{"e":"` + k.E + `","kty":"RSA","n":"` + k.N + `"}`))
+	return b64(sum[:])
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ACME Renewal Information (RFC 9773): the CA suggests a window to renew each
+// certificate in. A random time in the window is chosen once and kept in the
+// state directory, so that running renew again doesn't pick another one:
+//
+//	STATE_DIR/renewal-info/CERT_ID.json
+
+type (
+	renewalWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	}
+
+	renewalInfo struct {
+		SuggestedWindow renewalWindow `json:"suggestedWindow"`
+		ExplanationURL  string        `json:"explanationURL,omitempty"`
+	}
+
+	// renewalSchedule is the time chosen in the suggested window.
+	renewalSchedule struct {
+		Window renewalWindow `json:"window"`
+		At     time.Time     `json:"at"`
+	}
+)
+
+// ariCertID returns the unique identifier of a certificate in ARI, which is
+// its authority key identifier and serial number.
+func ariCertID(cert *x509.Certificate) (string, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", errors.New("certificate has no authority key identifier")
+	}
+	// the serial number is the content of its DER encoding, which has a
+	// leading zero if the high bit is set
+	der, err := asn1.Marshal(new(big.Int).Set(cert.SerialNumber))
+	if err != nil {
+		return "", err
+	}
+	var serial asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &serial); err != nil {
+		return "", err
+	}
+	return b64(cert.AuthorityKeyId) + "." + b64(serial.Bytes), nil
+}
+
+func getRenewalInfo(dir *directory, id string) (*renewalInfo, error) {
+	if dir.RenewalInfo == "" {
+		return nil, errors.New("server does not support renewal information")
+	}
+	url := strings.TrimSuffix(dir.RenewalInfo, "/") + "/" + id
+	resp, err := getHTTPClient().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	var info renewalInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	w := info.SuggestedWindow
+	if w.Start.IsZero() || w.End.Before(w.Start) {
+		return nil, errors.New("bad suggested window from " + url)
+	}
+	return &info, nil
+}
+
+// renewalTime returns when the certificate should be renewed according to
+// the renewal information of the CA, a random time in the suggested window.
+// If that time has passed, or the whole window is in the past, which is how
+// the CA asks to renew early (e.g. before a mass revocation), it is now. A
+// newly chosen time is kept only if keep is true.
+func renewalTime(dir *directory, cert *x509.Certificate, keep bool) (time.Time, *renewalInfo, error) {
+	id, err := ariCertID(cert)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	info, err := getRenewalInfo(dir, id)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	file := filepath.Join(stateDir, "renewal-info", id+".json")
+	at, err := scheduleRenewal(file, info.SuggestedWindow, keep)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	if now := time.Now(); !now.Before(at) || !now.Before(info.SuggestedWindow.End) {
+		return now, info, nil
+	}
+	return at, info, nil
+}
+
+// scheduleRenewal returns the time chosen in the window, which is kept in
+// file until the window changes if keep is true.
+func scheduleRenewal(file string, w renewalWindow, keep bool) (time.Time, error) {
+	var s renewalSchedule
+	if content, err := ioutil.ReadFile(file); err == nil {
+		json.Unmarshal(content, &s)
+	}
+	if s.Window.Start.Equal(w.Start) && s.Window.End.Equal(w.End) && !s.At.IsZero() {
+		return s.At, nil
+	}
+	// the window is new or has changed
+	s.Window = w
+	s.At = w.Start
+	if d := w.End.Sub(w.Start); d > 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(d)))
+		if err != nil {
+			return time.Time{}, err
+		}
+		s.At = w.Start.Add(time.Duration(n.Int64()))
+	}
+	if !keep {
+		return s.At, nil
+	}
+	content, err := json.Marshal(s)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(file), 0700); err == nil {
+			err = ioutil.WriteFile(file, content, 0600)
+		}
+	}
+	return s.At, err
+}
+
+// forgetRenewalTime removes the chosen time of a renewed certificate.
+func forgetRenewalTime(cert *x509.Certificate) {
+	if id, err := ariCertID(cert); err == nil {
+		os.Remove(filepath.Join(stateDir, "renewal-info", id+".json"))
+	}
+}
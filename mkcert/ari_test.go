@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRenewalInfo serves the window as the renewal information of the
+// certificate id.
+func fakeRenewalInfo(t *testing.T, id string, w *renewalWindow) *directory {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/renewalInfo/"+id {
+			http.NotFound(rw, r)
+			return
+		}
+		json.NewEncoder(rw).Encode(renewalInfo{SuggestedWindow: *w})
+	}))
+	t.Cleanup(srv.Close)
+	return &directory{RenewalInfo: srv.URL + "/renewalInfo"}
+}
+
+func TestRenewalTime(t *testing.T) {
+	stateDir = t.TempDir()
+	cert := &x509.Certificate{SerialNumber: big.NewInt(0x87), AuthorityKeyId: []byte{1, 2, 3}}
+	id, err := ariCertID(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "AQID.AIc" {
+		t.Errorf("cert id is %s", id)
+	}
+	var w renewalWindow
+	dir := fakeRenewalInfo(t, id, &w)
+	file := filepath.Join(stateDir, "renewal-info", id+".json")
+	now := time.Now().Truncate(time.Second)
+
+	schedule := func(at time.Time) {
+		content, _ := json.Marshal(renewalSchedule{Window: w, At: at})
+		os.MkdirAll(filepath.Dir(file), 0700)
+		if err := ioutil.WriteFile(file, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	isNow := func(at time.Time) bool {
+		return !at.Before(now) && time.Since(at) < time.Minute
+	}
+
+	t.Run("before window", func(t *testing.T) {
+		os.Remove(file)
+		w = renewalWindow{Start: now.Add(24 * time.Hour), End: now.Add(48 * time.Hour)}
+		at, _, err := renewalTime(dir, cert, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at.Before(w.Start) || at.After(w.End) {
+			t.Errorf("%s is not in the window", at)
+		}
+		again, _, err := renewalTime(dir, cert, true)
+		if err != nil || !again.Equal(at) {
+			t.Errorf("renewal time changed from %s to %s (%v)", at, again, err)
+		}
+	})
+
+	t.Run("not kept", func(t *testing.T) {
+		os.Remove(file)
+		if _, _, err := renewalTime(dir, cert, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("renewal time is kept: %v", err)
+		}
+	})
+
+	t.Run("in window before scheduled time", func(t *testing.T) {
+		w = renewalWindow{Start: now.Add(-time.Hour), End: now.Add(time.Hour)}
+		schedule(now.Add(30 * time.Minute))
+		at, _, err := renewalTime(dir, cert, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !at.Equal(now.Add(30 * time.Minute)) {
+			t.Errorf("renewal time is %s, not the scheduled time", at)
+		}
+	})
+
+	t.Run("in window after scheduled time", func(t *testing.T) {
+		schedule(now.Add(-30 * time.Minute))
+		at, _, err := renewalTime(dir, cert, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isNow(at) {
+			t.Errorf("renewal time is %s, not now", at)
+		}
+	})
+
+	t.Run("window changed", func(t *testing.T) {
+		schedule(now.Add(-30 * time.Minute))
+		w = renewalWindow{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}
+		at, _, err := renewalTime(dir, cert, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at.Before(w.Start) || at.After(w.End) {
+			t.Errorf("%s is not in the new window", at)
+		}
+	})
+
+	t.Run("past window", func(t *testing.T) {
+		w = renewalWindow{Start: now.Add(-48 * time.Hour), End: now.Add(-24 * time.Hour)}
+		at, _, err := renewalTime(dir, cert, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isNow(at) {
+			t.Errorf("renewal time is %s, not now", at)
+		}
+	})
+
+	t.Run("bad window", func(t *testing.T) {
+		w = renewalWindow{Start: now, End: now.Add(-time.Hour)}
+		if _, _, err := renewalTime(dir, cert, true); err == nil || !strings.Contains(err.Error(), "bad suggested window") {
+			t.Errorf("error is %v", err)
+		}
+	})
+}
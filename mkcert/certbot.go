@@ -0,0 +1,290 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+const (
+	csrPath       = "/tmp/csr.pem"
+	fullchainPath = "/tmp/fullchain.pem"
+)
+
+func newContainer(l *log.Logger, o order, useCSR bool) (string, error) {
+	dockerArgs, certbotArgs, err := certbotServerArgs()
+	if err != nil {
+		return "", err
+	}
+	command := []string{"docker", "create", "-i", "--platform", "linux/amd64"}
+	command = append(command, dockerArgs...)
+	command = append(command, certbotImage, "certonly", "--manual",
+		"--preferred-challenges=dns")
+	command = append(command, certbotArgs...)
+	if useCSR {
+		command = append(command, "--csr", csrPath, "--fullchain-path", fullchainPath,
+			"--cert-path", "/tmp/cert.pem", "--chain-path", "/tmp/chain.pem")
+	} else {
+		for _, name := range o.names {
+			command = append(command, "-d", name)
+		}
+		command = append(command, certbotKeyArgs(o.keyType)...)
+	}
+	if dryRun {
+		command = append(command, "--dry-run")
+	}
+	if debug {
+		l.Println("running", command)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.New(strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func removeContainer(l *log.Logger, containerId string) {
+	l.Println("removing container", containerId)
+	cmd := exec.Command("docker", "rm", "-fv", containerId)
+	err := cmd.Run()
+	if err != nil {
+		l.Println("failed to remove container", containerId+":", err)
+	}
+}
+
+func copyFileToContainer(l *log.Logger, containerId, file string, content []byte) error {
+	l.Println("copying", file, "to", containerId)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name: path.Base(file),
+		Mode: 0644,
+		Size: int64(len(content)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	cmd := exec.Command("docker", "cp", "-", containerId+":"+path.Dir(file))
+	cmd.Stdin = &buf
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func copyFileFromContainer(l *log.Logger, containerId, file string) ([]byte, error) {
+	l.Println("copying", file, "from", containerId)
+	cmd := exec.Command("docker", "cp", "--follow-link", containerId+":"+file, "-")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(stdout)
+	var buf bytes.Buffer
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return nil, err
+		}
+	}
+	err = cmd.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// challenge is a DNS-01 challenge asked by certbot, name is the full name of
+// the TXT record.
+type challenge struct {
+	name, value string
+	last        bool
+}
+
+type certbot struct {
+	acmeChallengeChan chan challenge
+	continueChan      chan bool
+
+	// done is closed when certbot exits, and abort is closed to stop
+	// sending challenges when the caller gives up.
+	done, abort chan struct{}
+
+	// useCSR is true if certbot writes the certificate to fullchainPath
+	// instead of printing paths of its own files.
+	useCSR bool
+
+	log *log.Logger
+
+	// set when done
+	err              error
+	pemFile, keyFile string
+}
+
+func newCertbot(l *log.Logger, useCSR bool) *certbot {
+	return &certbot{
+		log:               l,
+		useCSR:            useCSR,
+		acmeChallengeChan: make(chan challenge),
+		continueChan:      make(chan bool),
+		done:              make(chan struct{}),
+		abort:             make(chan struct{}),
+	}
+}
+
+// next presses enter to certbot unless it has exited.
+func (c *certbot) next() {
+	select {
+	case c.continueChan <- true:
+	case <-c.done:
+	}
+}
+
+// start runs certbot and sends the challenges it asks for. The number of
+// challenges is taken from certbot's "Performing the following challenges"
+// list, which leaves out names the account already has valid authorizations
+// for, or is expected if certbot didn't list them. The channel of challenges
+// is closed after the last one.
+func (c *certbot) start(containerId string, expected int) {
+	defer close(c.done)
+	l := c.log
+	cmd := exec.Command("docker", "start", "-ai", containerId)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		c.err = err
+		return
+	}
+	defer stdin.Close()
+	go func() {
+		for {
+			select {
+			case <-c.continueChan:
+				l.Println("pressing enter to certbot, waiting for response...")
+				io.WriteString(stdin, "\n")
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	// certbot logs to stderr and asks on stdout, both are read in order from
+	// the same pipe
+	output, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Start()
+	if err != nil {
+		c.err = err
+		return
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+		w.Close()
+	}()
+	scanner := bufio.NewScanner(output)
+	mode, success := 0, false
+	var name string
+	var lines []string
+	pending, asked, closed := -1, 0, false
+	closeChallenges := func() {
+		if !closed {
+			close(c.acmeChallengeChan)
+			closed = true
+		}
+	}
+	defer closeChallenges()
+	for scanner.Scan() {
+		t := scanner.Text()
+		if debug {
+			l.Println("certbot:", t)
+		}
+		if lines = append(lines, t); len(lines) > 20 {
+			lines = lines[1:]
+		}
+		switch mode {
+		case 1:
+			if fields := strings.Fields(t); len(fields) > 0 && strings.HasPrefix(fields[0], "_acme-challenge.") {
+				name = strings.ToLower(strings.TrimSuffix(fields[0], "."))
+				mode = 2
+			}
+		case 2:
+			if t == "" {
+				continue
+			}
+			mode = 3
+			if closed {
+				c.err = errors.New("unexpected acme challenge for " + name)
+				continue
+			}
+			asked += 1
+			if pending < 0 {
+				pending = expected
+			}
+			select {
+			case c.acmeChallengeChan <- challenge{name: name, value: strings.TrimSpace(t), last: asked >= pending}:
+			case <-c.abort:
+			}
+			if asked >= pending {
+				closeChallenges()
+			}
+		default:
+			if strings.Contains(t, "Performing the following challenges") {
+				pending = 0
+			} else if fields := strings.Fields(t); pending >= 0 && asked == 0 &&
+				len(fields) == 4 && fields[1] == "challenge" && fields[2] == "for" {
+				pending += 1
+			} else if strings.Contains(t, "deploy a DNS TXT record") {
+				mode = 1
+			} else if strings.Contains(t, "successful") || strings.Contains(t, "Congratulations") {
+				success = true
+				closeChallenges()
+			} else if c.useCSR {
+				continue
+			} else if strings.Contains(t, "fullchain.pem") {
+				c.pemFile = strings.TrimSpace(t)
+			} else if strings.Contains(t, "privkey.pem") {
+				c.keyFile = strings.TrimSpace(t)
+			}
+		}
+	}
+	err = <-waitErr
+	if err != nil {
+		for _, line := range lines {
+			l.Println("\x1b[31mcertbot:", line, "\x1b[0m")
+		}
+		c.err = fmt.Errorf("certbot: %w", err)
+		return
+	}
+	if c.err != nil {
+		return
+	}
+	if success {
+		l.Println("successfully generated certificates")
+	} else {
+		c.err = errors.New("failed to generate certificates")
+	}
+}
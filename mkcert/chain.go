@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// preferredChain is the issuer common name of the chain to use, among the
+// default and alternate chains offered by the CA.
+var preferredChain string
+
+// linkURLs returns the URLs of the Link headers with the relation rel. The
+// rel parameter can be quoted and have several relations (RFC 8288).
+func linkURLs(header http.Header, rel string) []string {
+	var urls []string
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			url := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(url, "<") || !strings.HasSuffix(url, ">") {
+				continue
+			}
+			if hasRelation(parts[1:], rel) {
+				urls = append(urls, url[1:len(url)-1])
+			}
+		}
+	}
+	return urls
+}
+
+// hasRelation returns true if the rel parameter of a link has the relation.
+func hasRelation(params []string, rel string) bool {
+	for _, param := range params {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+			continue
+		}
+		for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+			if strings.EqualFold(r, rel) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseChain returns the certificates of a PEM encoded chain.
+func parseChain(chain []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, chain = pem.Decode(chain)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+// chainIssuers returns the issuer common names of the certificates of a
+// chain, from the leaf's to the root's.
+func chainIssuers(certs []*x509.Certificate) []string {
+	var names []string
+	for _, cert := range certs {
+		names = append(names, cert.Issuer.CommonName)
+	}
+	return names
+}
+
+// describeChain describes a chain by its issuers, like "R3 > ISRG Root X1".
+func describeChain(chain []byte) string {
+	return strings.Join(chainIssuers(parseChain(chain)), " > ")
+}
+
+// choosePreferredChain returns the index of the chain whose root, or else any
+// of the intermediates, is issued by name, or 0 (the default chain) if there
+// is none.
+func choosePreferredChain(chains [][]byte, name string) (int, bool) {
+	for i, chain := range chains {
+		issuers := chainIssuers(parseChain(chain))
+		if len(issuers) > 0 && issuers[len(issuers)-1] == name {
+			return i, true
+		}
+	}
+	for i, chain := range chains {
+		for _, issuer := range chainIssuers(parseChain(chain)) {
+			if issuer == name {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// downloadCertificate downloads the certificate chain of an order, or the
+// alternate chain of the preferred chain of the order.
+func (c *acmeClient) downloadCertificate(l *log.Logger, url, preferred string) ([]byte, error) {
+	var chain []byte
+	header, err := post(c.dir, c.key, c.kid, url, nil, &chain)
+	if err != nil {
+		return nil, err
+	}
+	alternates := linkURLs(header, "alternate")
+	if preferred == "" || len(alternates) == 0 {
+		if preferred != "" {
+			l.Println("server offers no alternate chains, using the default chain")
+		}
+		return chain, nil
+	}
+	chains := [][]byte{chain}
+	for _, alternate := range alternates {
+		var alt []byte
+		if _, err := post(c.dir, c.key, c.kid, alternate, nil, &alt); err != nil {
+			return nil, err
+		}
+		chains = append(chains, alt)
+	}
+	for i, chain := range chains {
+		l.Printf("chain %d: %s", i, describeChain(chain))
+	}
+	i, ok := choosePreferredChain(chains, preferred)
+	if !ok {
+		l.Println("no chain is issued by", preferred+", using the default chain")
+	}
+	return chains[i], nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestLinkURLs(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		links []string
+		urls  []string
+	}{
+		{"none", nil, nil},
+		{"quoted", []string{`<https://ca.example/cert/1/1>;rel="alternate"`}, []string{"https://ca.example/cert/1/1"}},
+		{"unquoted", []string{`<https://ca.example/cert/1/1>; rel=alternate`}, []string{"https://ca.example/cert/1/1"}},
+		{"headers", []string{
+			`<https://ca.example/directory>;rel="index"`,
+			`<https://ca.example/cert/1/1>;rel="alternate"`,
+			`<https://ca.example/cert/1/2>;rel="alternate"`,
+		}, []string{"https://ca.example/cert/1/1", "https://ca.example/cert/1/2"}},
+		{"one header", []string{
+			`<https://ca.example/cert/1/1>; rel="alternate", <https://ca.example/directory>; rel="index", <https://ca.example/cert/1/2>; rel="alternate"`,
+		}, []string{"https://ca.example/cert/1/1", "https://ca.example/cert/1/2"}},
+		{"relations", []string{`<https://ca.example/cert/1/1>; title="other"; Rel="index Alternate"`}, []string{"https://ca.example/cert/1/1"}},
+		{"spaces", []string{` <https://ca.example/cert/1/1> ; rel = "alternate" `}, []string{"https://ca.example/cert/1/1"}},
+		{"other relation", []string{`<https://ca.example/cert/1/1>;rel="alternates"`, `<https://ca.example/up>;rel="up"`}, nil},
+		{"no brackets", []string{`https://ca.example/cert/1/1;rel="alternate"`}, nil},
+		{"title only", []string{`<https://ca.example/cert/1/1>;title="alternate"`}, nil},
+	} {
+		header := http.Header{}
+		for _, link := range test.links {
+			header.Add("Link", link)
+		}
+		if urls := linkURLs(header, "alternate"); !reflect.DeepEqual(urls, test.urls) {
+			t.Errorf("%s: urls are %q, want %q", test.name, urls, test.urls)
+		}
+	}
+}
+
+// testChain returns a PEM chain of certificates issued by issuers, from the
+// leaf's to the root's.
+func testChain(t *testing.T, issuers ...string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chain []byte
+	subject := "example.com"
+	for _, issuer := range issuers {
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: subject}}
+		parent := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: issuer}}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+		subject = issuer
+	}
+	return chain
+}
+
+func TestChoosePreferredChain(t *testing.T) {
+	chains := [][]byte{
+		testChain(t, "R3", "ISRG Root X1"),
+		testChain(t, "R3", "ISRG Root X1", "DST Root CA X3"),
+		testChain(t, "E1", "ISRG Root X2"),
+		testChain(t, "Y1", "R3"),
+	}
+	if d := describeChain(chains[1]); d != "R3 > ISRG Root X1 > DST Root CA X3" {
+		t.Errorf("chain is described as %q", d)
+	}
+	for _, test := range []struct {
+		name  string
+		index int
+		ok    bool
+	}{
+		{"ISRG Root X1", 0, true},
+		{"DST Root CA X3", 1, true},
+		{"ISRG Root X2", 2, true},
+		// an intermediate, in an alternate chain
+		{"E1", 2, true},
+		// the root of an alternate chain is preferred to an intermediate
+		// of the default chain
+		{"R3", 3, true},
+		{"isrg root x1", 0, false},
+		{"GTS Root R1", 0, false},
+	} {
+		if index, ok := choosePreferredChain(chains, test.name); index != test.index || ok != test.ok {
+			t.Errorf("chain of %q is %d (%t), want %d (%t)", test.name, index, ok, test.index, test.ok)
+		}
+	}
+	if index, ok := choosePreferredChain(nil, "ISRG Root X1"); index != 0 || ok {
+		t.Errorf("chain of no chains is %d (%t)", index, ok)
+	}
+	if index, ok := choosePreferredChain([][]byte{[]byte("not a chain"), chains[2]}, "ISRG Root X2"); index != 1 || !ok {
+		t.Errorf("chain after a bad chain is %d (%t)", index, ok)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dns01     = "dns-01"
+	http01    = "http-01"
+	tlsALPN01 = "tls-alpn-01"
+
+	// acmeTLSProtocol is the ALPN protocol of TLS-ALPN-01 (RFC 8737).
+	acmeTLSProtocol = "acme-tls/1"
+)
+
+var (
+	challengeTypes = []string{dns01, http01, tlsALPN01}
+
+	// idPeAcmeIdentifier is the extension of the TLS-ALPN-01 certificate.
+	idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+	solversMu sync.Mutex
+	solvers   = map[string]solver{}
+)
+
+func isValidChallengeType(t string) bool {
+	for _, c := range challengeTypes {
+		if c == t {
+			return true
+		}
+	}
+	return false
+}
+
+// solver makes the response of HTTP-01 or TLS-ALPN-01 challenges available
+// to the ACME server until cleanup is called.
+type solver interface {
+	present(domain, token, keyAuth string) error
+	cleanup(domain, token, keyAuth string) error
+}
+
+// getSolver returns the solver of HTTP-01 or TLS-ALPN-01 challenges. The
+// HTTP-01 solver is the webroot, the hook, or else the standalone listener.
+func getSolver(typ string) solver {
+	solversMu.Lock()
+	defer solversMu.Unlock()
+	if s, ok := solvers[typ]; ok {
+		return s
+	}
+	var s solver
+	switch {
+	case typ == tlsALPN01:
+		s = &alpnSolver{addr: tlsAddr}
+	case webroot != "":
+		s = webrootSolver{webroot}
+	case httpHook != "":
+		s = hookSolver{httpHook}
+	default:
+		s = &standaloneSolver{addr: httpAddr}
+	}
+	solvers[typ] = s
+	return s
+}
+
+// standaloneSolver serves HTTP-01 challenges with a built-in HTTP server.
+type standaloneSolver struct {
+	addr string
+
+	mu       sync.Mutex
+	server   *http.Server
+	keyAuths map[string]string
+}
+
+func (s *standaloneSolver) present(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.server == nil {
+		ln, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return err
+		}
+		log.Println("listening on", ln.Addr(), "for http-01 challenges")
+		s.keyAuths = map[string]string{}
+		s.server = &http.Server{Handler: s}
+		go s.server.Serve(ln)
+	}
+	s.keyAuths[token] = keyAuth
+	return nil
+}
+
+func (s *standaloneSolver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+	s.mu.Lock()
+	keyAuth, ok := s.keyAuths[token]
+	s.mu.Unlock()
+	if !ok || token == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	if debug {
+		log.Println("answering http-01 challenge", token, "for", r.Host)
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
+
+func (s *standaloneSolver) cleanup(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keyAuths, token)
+	if len(s.keyAuths) == 0 && s.server != nil {
+		s.server.Close()
+		s.server = nil
+	}
+	return nil
+}
+
+// webrootSolver writes HTTP-01 challenges to the document root of a running
+// web server.
+type webrootSolver struct {
+	dir string
+}
+
+func (s webrootSolver) file(token string) string {
+	return filepath.Join(s.dir, ".well-known", "acme-challenge", token)
+}
+
+func (s webrootSolver) present(domain, token, keyAuth string) error {
+	file := s.file(token)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	log.Println("writing http-01 challenge", file)
+	return ioutil.WriteFile(file, []byte(keyAuth), 0644)
+}
+
+func (s webrootSolver) cleanup(domain, token, keyAuth string) error {
+	return os.Remove(s.file(token))
+}
+
+// hookSolver runs a shell command to deploy HTTP-01 challenges, as:
+//
+//	HOOK present|cleanup DOMAIN TOKEN KEY_AUTHORIZATION
+//
+// The command is run with sh -c like the -hook commands, so it can be quoted,
+// and the arguments are passed as "$@" without being parsed by the shell.
+type hookSolver struct {
+	command string
+}
+
+func (s hookSolver) run(action, domain, token, keyAuth string) error {
+	command := []string{"sh", "-c", s.command + ` "$@"`, "sh", action, domain, token, keyAuth}
+	if debug {
+		log.Println("running", command)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.New("http-01 hook: " + err.Error())
+	}
+	return nil
+}
+
+func (s hookSolver) present(domain, token, keyAuth string) error {
+	return s.run("present", domain, token, keyAuth)
+}
+
+func (s hookSolver) cleanup(domain, token, keyAuth string) error {
+	return s.run("cleanup", domain, token, keyAuth)
+}
+
+// alpnSolver serves TLS-ALPN-01 challenges with a built-in TLS server, which
+// presents a self-signed certificate with the key authorization for the
+// domain in the SNI.
+type alpnSolver struct {
+	addr string
+
+	mu    sync.Mutex
+	ln    net.Listener
+	certs map[string]*tls.Certificate
+}
+
+func (s *alpnSolver) present(domain, token, keyAuth string) error {
+	cert, err := alpnCertificate(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		config := &tls.Config{
+			NextProtos:     []string{acmeTLSProtocol},
+			GetCertificate: s.getCertificate,
+		}
+		ln, err := tls.Listen("tcp", s.addr, config)
+		if err != nil {
+			return err
+		}
+		log.Println("listening on", ln.Addr(), "for tls-alpn-01 challenges")
+		s.ln = ln
+		s.certs = map[string]*tls.Certificate{}
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					// the handshake is all the ACME server needs
+					conn.SetDeadline(time.Now().Add(10 * time.Second))
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}()
+			}
+		}()
+	}
+	s.certs[domain] = cert
+	return nil
+}
+
+func (s *alpnSolver) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cert, ok := s.certs[strings.ToLower(hello.ServerName)]
+	if !ok {
+		return nil, errors.New("no tls-alpn-01 challenge for " + hello.ServerName)
+	}
+	if debug {
+		log.Println("answering tls-alpn-01 challenge for", hello.ServerName)
+	}
+	return cert, nil
+}
+
+func (s *alpnSolver) cleanup(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.certs, domain)
+	if len(s.certs) == 0 && s.ln != nil {
+		s.ln.Close()
+		s.ln = nil
+	}
+	return nil
+}
+
+// alpnCertificate creates the self-signed certificate of a TLS-ALPN-01
+// challenge, which has the SHA-256 digest of the key authorization in the
+// critical acmeIdentifier extension.
+func alpnCertificate(domain, keyAuth string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	value, err := asn1.Marshal(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: idPeAcmeIdentifier, Critical: true, Value: value},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
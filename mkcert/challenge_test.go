@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/asn1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStandaloneSolver(t *testing.T) {
+	s := &standaloneSolver{keyAuths: map[string]string{"token1": "token1.thumbprint"}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/.well-known/acme-challenge/token1", 200, "token1.thumbprint"},
+		{"/.well-known/acme-challenge/token2", 404, ""},
+		{"/token1", 404, ""},
+		{"/.well-known/acme-challenge/", 404, ""},
+	} {
+		resp, err := http.Get(srv.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || test.status == 200 && string(body) != test.body {
+			t.Errorf("%s: %d %q, want %d %q", test.path, resp.StatusCode, body, test.status, test.body)
+		}
+		if test.status == 200 && resp.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("%s: content type is %s", test.path, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	// the listener is closed after the last challenge
+	s = &standaloneSolver{addr: "127.0.0.1:0"}
+	for _, token := range []string{"token1", "token2"} {
+		if err := s.present("example.com", token, token+".thumbprint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.cleanup("example.com", "token1", "token1.thumbprint")
+	if s.server == nil {
+		t.Error("server is closed before the last challenge")
+	}
+	s.cleanup("example.com", "token2", "token2.thumbprint")
+	if s.server != nil {
+		t.Error("server is not closed")
+	}
+}
+
+func TestWebrootSolver(t *testing.T) {
+	s := webrootSolver{t.TempDir()}
+	if err := s.present("example.com", "token1", "token1.thumbprint"); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(s.dir, ".well-known", "acme-challenge", "token1")
+	if content, err := ioutil.ReadFile(file); err != nil || string(content) != "token1.thumbprint" {
+		t.Errorf("%s is %q (%v)", file, content, err)
+	}
+	if err := s.cleanup("example.com", "token1", "token1.thumbprint"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("%s is not removed", file)
+	}
+}
+
+func TestHookSolver(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "calls")
+	s := hookSolver{`printf '%s|' >>` + file}
+	if err := s.present("example.com", "token1", "token1.thumb print"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.cleanup("example.com", "token1", "token1.thumb print"); err != nil {
+		t.Fatal(err)
+	}
+	want := "present|example.com|token1|token1.thumb print|cleanup|example.com|token1|token1.thumb print|"
+	if content, _ := ioutil.ReadFile(file); string(content) != want {
+		t.Errorf("hook is called with %q, want %q", content, want)
+	}
+	if err := (hookSolver{"exit 1"}).present("example.com", "token1", "token1.thumbprint"); err == nil {
+		t.Error("failed hook is not an error")
+	}
+}
+
+func TestALPNSolver(t *testing.T) {
+	s := &alpnSolver{addr: "127.0.0.1:0"}
+	keyAuth := "token1.thumbprint"
+	if err := s.present("example.com", "token1", keyAuth); err != nil {
+		t.Fatal(err)
+	}
+	defer s.cleanup("example.com", "token1", keyAuth)
+
+	dial := func(serverName string) (*tls.Conn, error) {
+		return tls.Dial("tcp", s.ln.Addr().String(), &tls.Config{
+			ServerName:         serverName,
+			NextProtos:         []string{acmeTLSProtocol},
+			InsecureSkipVerify: true,
+		})
+	}
+	conn, err := dial("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	if state.NegotiatedProtocol != acmeTLSProtocol {
+		t.Errorf("protocol is %q", state.NegotiatedProtocol)
+	}
+	cert := state.PeerCertificates[0]
+	if !reflect.DeepEqual(cert.DNSNames, []string{"example.com"}) {
+		t.Errorf("names are %q", cert.DNSNames)
+	}
+	var found bool
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		found = true
+		if !ext.Critical {
+			t.Error("acmeIdentifier is not critical")
+		}
+		var digest []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &digest); err != nil || len(rest) > 0 {
+			t.Fatalf("bad acmeIdentifier: %v", err)
+		}
+		if sum := sha256.Sum256([]byte(keyAuth)); !bytes.Equal(digest, sum[:]) {
+			t.Errorf("acmeIdentifier is %x, want %x", digest, sum)
+		}
+	}
+	if !found {
+		t.Error("no acmeIdentifier extension")
+	}
+
+	if conn, err := dial("example.net"); err == nil {
+		conn.Close()
+		t.Error("handshake for a name without challenge")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/caiguanhao/certutils/dns"
+)
+
+// runCNAME prints the CNAME records which delegate the DNS-01 challenges of
+// names to a zone of ours or to acme-dns.
+func runCNAME(providers []*provider, args []string) {
+	fs := flag.NewFlagSet("cname", flag.ExitOnError)
+	zoneName := fs.String("zone", "", "delegate to this zone of -dns instead of acme-dns")
+	fs.Usage = func() {
+		fmt.Println("Usage of mkcert [OPTIONS] cname [CNAME OPTIONS] NAMES...")
+		fmt.Println(`
+Prints the CNAME records to send to the owners of domain names that we have no
+API credentials for. Once _acme-challenge of a name is a CNAME of ours, the
+TXT records of its DNS-01 challenges are created at the target of the CNAME
+instead.
+
+The targets are subdomains of an acme-dns server (ACME_DNS_API_BASE), where an
+account is registered for each name that has none in ACME_DNS_STORAGE_PATH,
+or with -zone, names in a zone of -dns. Use "-dns acmedns" or "-dns
+ZONE_PROVIDER" with the names afterwards.
+
+CNAME OPTIONS:`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var names []string
+	for _, arg := range fs.Args() {
+		list, err := parseNames(arg)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		names = append(names, list...)
+	}
+
+	var acmeDNS *dns.AcmeDNS
+	if *zoneName != "" {
+		*zoneName = strings.ToLower(strings.TrimSuffix(*zoneName, "."))
+		z, err := findZone(providers, *zoneName)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		if z == nil || z.name != *zoneName {
+			log.Fatal("Error: no zone ", *zoneName, " on -dns")
+		}
+	} else {
+		var err error
+		if acmeDNS, err = dns.NewAcmeDNSFromEnv(); err != nil {
+			log.Fatal("Error: ", err)
+		}
+	}
+
+	var records []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		acme := acmeName(name)
+		if seen[acme] {
+			continue
+		}
+		seen[acme] = true
+		var target string
+		if acmeDNS == nil {
+			target = delegationLabel(acme) + "." + *zoneName
+		} else {
+			account := acmeDNS.Account(name)
+			if account == nil {
+				var err error
+				if account, err = acmeDNS.Register(name); err != nil {
+					log.Fatal("Error: ", err)
+				}
+				log.Println("registered acme-dns account for", name)
+			}
+			target = strings.TrimSuffix(account.FullDomain, ".")
+		}
+		current, err := dns.LookupCNAME(acme, resolver)
+		if err != nil {
+			log.Println("failed to look up CNAME of", acme+":", err)
+		} else if strings.EqualFold(current, target) {
+			log.Println(acme, "is already a CNAME of", target)
+		} else {
+			log.Println(acme, "is not yet a CNAME of", target)
+		}
+		records = append(records, acme+". CNAME "+target+".")
+	}
+	fmt.Println("Please add these DNS records once, they don't need to change later:")
+	fmt.Println()
+	for _, record := range records {
+		fmt.Println(record)
+	}
+}
+
+// delegationLabel returns the label of the CNAME target of a challenge name
+// in our zone, which is a UUID derived from the name.
+func delegationLabel(acme string) string {
+	sum := sha256.Sum256([]byte(acme))
+	h := fmt.Sprintf("%x", sum[:16])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
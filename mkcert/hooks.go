@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Hooks run after a certificate is issued and written, in the order they are
+// given. A hook is either:
+//
+//	upload[:UPCERT COMMAND]   upload the files with upcert (default "upcert")
+//	[shell:]COMMAND           run the command with sh -c
+//
+// Both get the environment variables of hookData. A failed hook doesn't stop
+// the others, and the certificate is kept.
+
+const (
+	uploadHook = "upload"
+	shellHook  = "shell:"
+)
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// hookError is returned by get if the certificate is issued but some of its
+// hooks failed.
+type hookError struct {
+	failed []string
+}
+
+func (e *hookError) Error() string {
+	return "issued, but hook failed: " + strings.Join(e.failed, "; ")
+}
+
+func isHookError(err error) bool {
+	var e *hookError
+	return errors.As(err, &e)
+}
+
+// hookData is what hooks get of an issued certificate, the paths are
+// absolute.
+type hookData struct {
+	names             []string
+	certPath, keyPath string
+	serial            string
+	notAfter          time.Time
+	chain             string
+}
+
+// newHookData returns the hook data of the certificate files of the order.
+func newHookData(o order, out *output) hookData {
+	abs := func(file string) string {
+		if file == "" {
+			return ""
+		}
+		if a, err := filepath.Abs(file); err == nil {
+			return a
+		}
+		return file
+	}
+	return hookData{
+		names:    o.names,
+		certPath: abs(out.certPath),
+		keyPath:  abs(out.keyPath),
+		serial:   fmt.Sprintf("%x", out.cert.SerialNumber),
+		notAfter: out.cert.NotAfter,
+		chain:    out.chain,
+	}
+}
+
+// env returns the environment variables of hooks, MKCERT_KEY_PATH is empty if
+// the private key is unknown.
+func (d hookData) env() []string {
+	return []string{
+		"MKCERT_DOMAIN=" + d.names[0],
+		"MKCERT_NAMES=" + strings.Join(d.names, ","),
+		"MKCERT_CERT_PATH=" + d.certPath,
+		"MKCERT_KEY_PATH=" + d.keyPath,
+		"MKCERT_SERIAL=" + d.serial,
+		"MKCERT_NOT_AFTER=" + d.notAfter.UTC().Format(time.RFC3339),
+		"MKCERT_CHAIN=" + d.chain,
+	}
+}
+
+// runHooks runs the hooks of the order, and returns a hookError if any of
+// them failed.
+func runHooks(l *log.Logger, o order, out *output) error {
+	if len(o.hooks) == 0 || dryRun {
+		return nil
+	}
+	d := newHookData(o, out)
+	var failed []string
+	for _, hook := range o.hooks {
+		if err := runHook(l, hook, d); err != nil {
+			l.Println("hook failed:", err)
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return &hookError{failed}
+	}
+	return nil
+}
+
+func runHook(l *log.Logger, hook string, d hookData) error {
+	var command []string
+	if hook == uploadHook || strings.HasPrefix(hook, uploadHook+":") {
+		upcert := "upcert"
+		if i := strings.Index(hook, ":"); i > -1 {
+			upcert = hook[i+1:]
+		}
+		command = strings.Fields(upcert)
+		if len(command) == 0 {
+			return errors.New("empty upcert command")
+		}
+		// upcert stores the files by their names
+		if !strings.HasSuffix(d.certPath, ".cert") {
+			return errors.New(hook + ": upload needs the cert format")
+		}
+		command = append(command, d.certPath)
+		if _, err := os.Stat(d.keyPath); d.keyPath != "" && err == nil {
+			command = append(command, d.keyPath)
+		}
+	} else {
+		command = []string{"sh", "-c", strings.TrimPrefix(hook, shellHook)}
+	}
+	l.Println("running hook", command)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), d.env()...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", hook, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	upcert := filepath.Join(dir, "upcert")
+	if err := ioutil.WriteFile(upcert, []byte("#!/bin/sh\necho upcert \"$@\" >> "+calls+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "example.com.cert")
+	keyPath := filepath.Join(dir, "example.com.key")
+	for _, file := range []string{certPath, keyPath} {
+		ioutil.WriteFile(file, []byte("-"), 0600)
+	}
+	l := log.New(ioutil.Discard, "", 0)
+	o := order{names: []string{"*.example.com", "example.com"}, hooks: []string{
+		`echo "$MKCERT_DOMAIN|$MKCERT_NAMES|$MKCERT_CERT_PATH|$MKCERT_KEY_PATH|$MKCERT_SERIAL|$MKCERT_NOT_AFTER|$MKCERT_CHAIN" >> ` + calls,
+		"upload:" + upcert + " -R recipients.txt",
+		"shell:exit 3",
+	}}
+	out := &output{
+		cert:     &x509.Certificate{SerialNumber: big.NewInt(0xabc), NotAfter: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)},
+		certPath: certPath,
+		keyPath:  keyPath,
+		chain:    "R3 > ISRG Root X1",
+	}
+
+	err := runHooks(l, o, out)
+	if !isHookError(err) || !strings.Contains(err.Error(), "shell:exit 3: exit status 3") {
+		t.Errorf("error is %v", err)
+	}
+	// without the key, e.g. for a CSR
+	out.keyPath = ""
+	o.hooks = o.hooks[:2]
+	if err := runHooks(l, o, out); err != nil {
+		t.Error(err)
+	}
+	content, _ := ioutil.ReadFile(calls)
+	want := strings.Join([]string{
+		"*.example.com|*.example.com,example.com|" + certPath + "|" + keyPath + "|abc|2030-01-02T03:04:05Z|R3 > ISRG Root X1",
+		"upcert -R recipients.txt " + certPath + " " + keyPath,
+		"*.example.com|*.example.com,example.com|" + certPath + "||abc|2030-01-02T03:04:05Z|R3 > ISRG Root X1",
+		"upcert -R recipients.txt " + certPath,
+	}, "\n") + "\n"
+	if string(content) != want {
+		t.Errorf("hooks got\n%s\nwant\n%s", content, want)
+	}
+
+	// upcert stores files by their names, so only the cert format can be
+	// uploaded
+	out.certPath = filepath.Join(dir, "example.com", "fullchain.pem")
+	o.hooks = []string{"upload"}
+	if err := runHooks(l, o, out); err == nil || !strings.Contains(err.Error(), "upload needs the cert format") {
+		t.Errorf("error is %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+var accountMu sync.Mutex
+
+// Certbot's manual plugin can only use one challenge type for all names, has
+// no TLS-ALPN-01 and only matches preferred chains by root, so orders with
+// HTTP-01 or TLS-ALPN-01 challenges or a preferred chain are issued by mkcert
+// itself, with the certbot account of -server and -email.
+
+type (
+	acmeOrder struct {
+		Status         string     `json:"status"`
+		Authorizations []string   `json:"authorizations"`
+		Finalize       string     `json:"finalize"`
+		Certificate    string     `json:"certificate"`
+		Error          *acmeError `json:"error"`
+	}
+
+	acmeAuthorization struct {
+		Status     string `json:"status"`
+		Identifier struct {
+			Value string `json:"value"`
+		} `json:"identifier"`
+		Wildcard   bool            `json:"wildcard"`
+		Challenges []acmeChallenge `json:"challenges"`
+	}
+
+	acmeChallenge struct {
+		Type   string     `json:"type"`
+		URL    string     `json:"url"`
+		Token  string     `json:"token"`
+		Status string     `json:"status"`
+		Error  *acmeError `json:"error"`
+	}
+
+	// acmeClient is the account to send requests with.
+	acmeClient struct {
+		dir *directory
+		key *rsa.PrivateKey
+		kid string
+	}
+)
+
+func (c *acmeClient) post(url string, payload, result interface{}) (string, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return "", err
+		}
+	}
+	header, err := post(c.dir, c.key, c.kid, url, body, result)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("Location"), nil
+}
+
+// poll gets url until the status of result is not pending or processing.
+func (c *acmeClient) poll(url string, result interface{}, status func() string) error {
+	for i := 0; i < 60; i++ {
+		if _, err := c.post(url, nil, result); err != nil {
+			return err
+		}
+		if s := status(); s != "pending" && s != "processing" {
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return errors.New("timed out waiting for " + url)
+}
+
+// ensureAccount returns the account of -server and -email, the account is
+// registered with certbot if there is none.
+func ensureAccount(l *log.Logger) (*account, error) {
+	accountMu.Lock()
+	defer accountMu.Unlock()
+	a, err := findAccount()
+	if err == nil {
+		return a, nil
+	}
+	l.Println(err)
+	l.Println("registering new account")
+	// certbotServerArgs starts with --server, which runCertbot adds
+	_, certbotArgs, err := certbotServerArgs()
+	if err != nil {
+		return nil, err
+	}
+	if err := runCertbot(append([]string{"register"}, certbotArgs[2:]...)...); err != nil {
+		return nil, fmt.Errorf("certbot register: %w", err)
+	}
+	return findAccount()
+}
+
+// newACMEClient returns the client of the account of -server and -email.
+func newACMEClient(l *log.Logger) (*acmeClient, error) {
+	a, err := ensureAccount(l)
+	if err != nil {
+		return nil, err
+	}
+	key, err := a.key()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := getDirectory(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if dir.NewOrder == "" {
+		return nil, errors.New("bad directory " + serverURL)
+	}
+	return &acmeClient{dir: dir, key: key, kid: a.URI}, nil
+}
+
+// issue issues a certificate for the order with its own ACME client. DNS-01
+// challenges are deployed in zones.
+func issue(o order, zones map[string]*zone) (*output, error) {
+	l := o.logger()
+	c, err := newACMEClient(l)
+	if err != nil {
+		return nil, err
+	}
+	l.Println("account:", c.kid)
+
+	var key crypto.Signer
+	var csr []byte
+	if o.csrFile != "" {
+		csrReq, _, err := readCSR(o.csrFile)
+		if err != nil {
+			return nil, err
+		}
+		l.Println("using CSR", o.csrFile, "with", describeKey(csrReq.PublicKey), "key")
+		csr = csrReq.Raw
+	} else {
+		if o.keyFile != "" {
+			if key, err = o.reusedKey(); err != nil {
+				return nil, err
+			}
+			l.Println("reusing", describeKey(key.Public()), "key", o.keyFile)
+		} else if key, err = generateKey(o.keyType); err != nil {
+			return nil, err
+		}
+		content, err := newCSR(key, o.names)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(content)
+		csr = block.Bytes
+	}
+
+	var identifiers []map[string]string
+	for _, name := range o.names {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": name})
+	}
+	var ord acmeOrder
+	orderURL, err := c.post(c.dir.NewOrder, map[string]interface{}{"identifiers": identifiers}, &ord)
+	if err != nil {
+		return nil, err
+	}
+	l.Println("created order", orderURL)
+
+	// deploy the challenges of all authorizations, then ask the server to
+	// validate them
+	var pending []pendingChallenge
+	defer func() {
+		for _, p := range pending {
+			p.cleanup()
+		}
+	}()
+	waitDNS := false
+	for _, authzURL := range ord.Authorizations {
+		var authz acmeAuthorization
+		if _, err := c.post(authzURL, nil, &authz); err != nil {
+			return nil, err
+		}
+		name := authz.Identifier.Value
+		if authz.Wildcard {
+			name = "*." + name
+		}
+		if authz.Status == "valid" {
+			l.Println("authorization of", name, "is valid")
+			continue
+		}
+		p, err := deployChallenge(c, o, zones, name, authzURL, &authz)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, *p)
+		waitDNS = waitDNS || p.typ == dns01
+	}
+	if waitDNS {
+		l.Println("wait", secondsToWait, "seconds for dns records to take effect")
+		time.Sleep(time.Duration(secondsToWait) * time.Second)
+	}
+	for _, p := range pending {
+		l.Println("validating", p.typ, "challenge for", p.name)
+		if _, err := c.post(p.challenge.URL, struct{}{}, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range pending {
+		var authz acmeAuthorization
+		err := c.poll(p.authzURL, &authz, func() string { return authz.Status })
+		if err != nil {
+			return nil, err
+		}
+		if authz.Status != "valid" {
+			for _, ch := range authz.Challenges {
+				if ch.Type == p.typ && ch.Error != nil {
+					return nil, fmt.Errorf("%s challenge for %s failed: %s", p.typ, p.name, ch.Error)
+				}
+			}
+			return nil, fmt.Errorf("authorization of %s is %s", p.name, authz.Status)
+		}
+		l.Println("authorization of", p.name, "is valid")
+	}
+	if dryRun {
+		l.Println("dry-run, order is not finalized")
+		l.Println("done:", o.names[0])
+		return nil, nil
+	}
+
+	l.Println("finalizing order")
+	if _, err := c.post(ord.Finalize, map[string]string{"csr": b64(csr)}, &ord); err != nil {
+		return nil, err
+	}
+	if err := c.poll(orderURL, &ord, func() string { return ord.Status }); err != nil {
+		return nil, err
+	}
+	if ord.Status != "valid" {
+		if ord.Error != nil {
+			return nil, ord.Error
+		}
+		return nil, errors.New("order is " + ord.Status)
+	}
+	cert, err := c.downloadCertificate(l, ord.Certificate, o.preferredChain)
+	if err != nil {
+		return nil, err
+	}
+	l.Println("successfully generated certificates")
+
+	var content []byte
+	if key != nil && o.keyFile == "" {
+		if content, err = encodePrivateKey(key); err != nil {
+			return nil, err
+		}
+	}
+	out, err := writeOutputs(l, o, cert, content)
+	if err != nil {
+		return nil, err
+	}
+	l.Println("done:", o.names[0])
+	return out, nil
+}
+
+// pendingChallenge is a deployed challenge to be validated.
+type pendingChallenge struct {
+	name, typ string
+	authzURL  string
+	challenge acmeChallenge
+	cleanup   func()
+}
+
+// deployChallenge deploys the challenge of the type chosen for the name.
+func deployChallenge(c *acmeClient, o order, zones map[string]*zone, name, authzURL string, authz *acmeAuthorization) (*pendingChallenge, error) {
+	l := o.logger()
+	typ := o.challengeType(name)
+	p := &pendingChallenge{name: name, typ: typ, authzURL: authzURL}
+	for _, ch := range authz.Challenges {
+		if ch.Type == typ {
+			p.challenge = ch
+		}
+	}
+	if p.challenge.URL == "" {
+		return nil, fmt.Errorf("server offers no %s challenge for %s", typ, name)
+	}
+	keyAuth := p.challenge.Token + "." + thumbprint(c.key)
+	domain := strings.TrimPrefix(name, "*.")
+	l.Println("deploying", typ, "challenge for", name)
+	switch typ {
+	case dns01:
+		acme := acmeName(name)
+		z := zones[acme]
+		sum := sha256.Sum256([]byte(keyAuth))
+		l.Println("creating new TXT record", z.target, "in", z.String())
+		id, err := z.addTXT(z.record(), b64(sum[:]))
+		if err != nil {
+			return nil, err
+		}
+		l.Println("new record has been created, id:", id)
+		p.cleanup = func() {
+			if err := z.deleteRecord(id); err != nil {
+				l.Println("failed to delete TXT record", id+":", err)
+			}
+		}
+	case http01, tlsALPN01:
+		s := getSolver(typ)
+		if err := s.present(domain, p.challenge.Token, keyAuth); err != nil {
+			return nil, err
+		}
+		p.cleanup = func() {
+			if err := s.cleanup(domain, p.challenge.Token, keyAuth); err != nil {
+				l.Println("failed to clean up", typ, "challenge for", name+":", err)
+			}
+		}
+	}
+	return p, nil
+}
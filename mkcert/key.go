@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+var keyTypes = []string{"ecdsa-p256", "ecdsa-p384", "rsa2048", "rsa3072", "rsa4096"}
+
+// certbotKeyArgs returns certbot's arguments for the key type, certbot uses
+// its own default when the key type is empty.
+func certbotKeyArgs(keyType string) []string {
+	switch keyType {
+	case "ecdsa-p256":
+		return []string{"--key-type", "ecdsa", "--elliptic-curve", "secp256r1"}
+	case "ecdsa-p384":
+		return []string{"--key-type", "ecdsa", "--elliptic-curve", "secp384r1"}
+	case "rsa2048", "rsa3072", "rsa4096":
+		return []string{"--key-type", "rsa", "--rsa-key-size", keyType[3:]}
+	}
+	return nil
+}
+
+func isValidKeyType(keyType string) bool {
+	for _, t := range keyTypes {
+		if t == keyType {
+			return true
+		}
+	}
+	return false
+}
+
+// generateKey generates a private key of the key type, or an RSA 2048 key
+// like certbot if the key type is empty.
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "ecdsa-p256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ecdsa-p384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "", "rsa2048":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "rsa3072", "rsa4096":
+		bits, _ := strconv.Atoi(keyType[3:])
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+	return nil, errors.New("bad key type " + keyType)
+}
+
+// encodePrivateKey returns the private key in PEM encoded PKCS #8.
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// describeKey returns the key type of a public key in the same form as the
+// -key-type option of mkcert, for example "ecdsa-p256" or "rsa2048".
+func describeKey(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ecdsa-" + strings.ToLower(strings.Replace(k.Curve.Params().Name, "-", "", 1))
+	case *rsa.PublicKey:
+		return "rsa" + strconv.Itoa(k.N.BitLen())
+	}
+	return fmt.Sprintf("%T", pub)
+}
+
+// readPrivateKey reads a PEM encoded private key in PKCS #8, PKCS #1 or SEC 1
+// form.
+func readPrivateKey(file string) (crypto.Signer, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return key, nil
+}
+
+// reusedKey reads the private key of the order to reuse, which must be of the
+// key type of the order if it has one.
+func (o order) reusedKey() (crypto.Signer, error) {
+	key, err := readPrivateKey(o.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if kt := describeKey(key.Public()); o.keyType != "" && o.keyType != kt {
+		return nil, fmt.Errorf("%s is a %s key, not %s", o.keyFile, kt, o.keyType)
+	}
+	return key, nil
+}
+
+func parsePrivateKey(content []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			return nil, errors.New("no private key found")
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			if signer, ok := key.(crypto.Signer); ok {
+				return signer, nil
+			}
+			return nil, errors.New("unsupported private key")
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+	}
+}
+
+// newCSR creates a PEM encoded certificate signing request for names using
+// an existing private key, the first name is used as the common name.
+func newCSR(key crypto.Signer, names []string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// readCSR reads a PEM or DER encoded certificate signing request and checks
+// its signature.
+func readCSR(file string) (*x509.CertificateRequest, []byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	der := content
+	if block, _ := pem.Decode(content); block != nil {
+		der = block.Bytes
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, err
+	}
+	return csr, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
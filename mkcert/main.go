@@ -1,17 +1,15 @@
 package main
 
 import (
-	"archive/tar"
-	"bufio"
-	"bytes"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/caiguanhao/certutils/dns"
@@ -24,318 +22,603 @@ var (
 
 	secondsToWait int
 	shouldClean   bool
+
+	keyType  string
+	reuseKey bool
+	csrFile  string
+
+	serverURL  string
+	eabKid     string
+	eabHmacKey string
+	caBundle   string
+
+	stateDir string
+	parallel int
+	hooks    stringsFlag
+
+	defaultChallenge string
+	httpAddr         string
+	webroot          string
+	httpHook         string
+	tlsAddr          string
+	resolver         string
 )
 
+// order is a certificate to issue.
+type order struct {
+	names   []string
+	keyType string
+	csrFile string
+
+	// challenges are the challenge types of names other than -challenge
+	challenges map[string]string
+
+	// keyFile is the private key to reuse, if any
+	keyFile string
+
+	// dir is where the certificate files are written
+	dir string
+
+	// preferredChain is the issuer common name of the chain to use
+	preferredChain string
+
+	// name overrides -name for the certificate files, e.g. when renewing
+	name string
+
+	// formats override -format for the certificate files
+	formats []string
+
+	// hooks run after the certificate is written
+	hooks []string
+
+	// log is the logger of the order, the standard logger if nil
+	log *log.Logger
+}
+
+// newOrder returns an order of names with the key options of the flags.
+func newOrder(names []string, dir string) order {
+	o := order{names: names, keyType: keyType, dir: dir, hooks: hooks, preferredChain: preferredChain}
+	if reuseKey {
+		o.keyFile = o.keyPath()
+	}
+	return o
+}
+
+func (o order) logger() *log.Logger {
+	if o.log != nil {
+		return o.log
+	}
+	return log.Default()
+}
+
+// challengeType returns the challenge type of a name in the order.
+func (o order) challengeType(name string) string {
+	if t, ok := o.challenges[name]; ok {
+		return t
+	}
+	return defaultChallenge
+}
+
+// usesCertbot returns true if all names of the order use DNS-01 challenges,
+// which certbot can do, and no chain is preferred.
+func (o order) usesCertbot() bool {
+	if o.preferredChain != "" {
+		return false
+	}
+	for _, name := range o.names {
+		if o.challengeType(name) != dns01 {
+			return false
+		}
+	}
+	return true
+}
+
+// primaryName returns the name of the certificate files of names.
+func primaryName(names []string) string {
+	return strings.TrimPrefix(names[0], "*.")
+}
+
 func main() {
 	flag.BoolVar(&debug, "debug", false, "show more info")
-	dnsType := flag.String("dns", "alidns", "can be alidns, cloudflare")
+	dnsFlags := dns.AddFlags(flag.CommandLine, "alidns")
 	flag.IntVar(&secondsToWait, "wait", 10, "seconds to wait for dns record to take effect")
 	flag.BoolVar(&dryRun, "dry-run", false, "dry-run certbot, but dns records will still be modified")
-	flag.StringVar(&email, "email", "a@a.com", "email for certbot")
+	flag.StringVar(&email, "email", "", "email for the ACME account (default is to register without email)")
+	server := flag.String("server", "letsencrypt", "ACME directory URL, or one of "+serverNames())
+	flag.StringVar(&eabKid, "eab-kid", "", "key identifier for External Account Binding")
+	flag.StringVar(&eabHmacKey, "eab-hmac-key", "", "HMAC key for External Account Binding")
+	flag.StringVar(&stateDir, "state-dir", defaultStateDir(), "directory to keep ACME accounts in")
+	flag.StringVar(&caBundle, "ca-bundle", "", "PEM file of CA certificates to trust for the ACME server, e.g. for Pebble or step-ca")
+	flag.StringVar(&defaultChallenge, "challenge", dns01, "challenge type of names, can be "+strings.Join(challengeTypes, ", "))
+	flag.StringVar(&httpAddr, "http-addr", ":80", "address to listen on for http-01 challenges")
+	flag.StringVar(&webroot, "webroot", "", "write http-01 challenges to this document root of your web server instead of listening")
+	flag.StringVar(&httpHook, "http-hook", "", "run this shell command with present|cleanup DOMAIN TOKEN KEY_AUTHORIZATION appended to deploy http-01 challenges instead of listening")
+	flag.StringVar(&tlsAddr, "tls-addr", ":443", "address to listen on for tls-alpn-01 challenges")
+	flag.Var(&hooks, "hook", "run hook after a certificate is issued: \"upload[:UPCERT COMMAND]\" or \"[shell:]COMMAND\", can be used multiple times")
+	flag.StringVar(&resolver, "resolver", "", "DNS resolver to follow CNAMEs of _acme-challenge names with (default is the first nameserver in /etc/resolv.conf)")
+	flag.IntVar(&parallel, "parallel", 1, "number of certificates to issue at the same time")
 	flag.BoolVar(&shouldClean, "clean", false, "remove acme challenge txt records for domain and exit")
+	flag.StringVar(&keyType, "key-type", "", "private key type, can be "+strings.Join(keyTypes, ", ")+" (default is certbot's)")
+	flag.BoolVar(&reuseKey, "reuse-key", false, "reuse private key in existing NAME.key instead of generating a new one")
+	flag.StringVar(&csrFile, "csr", "", "issue certificate for the names in this CSR file instead of generating a private key")
+	flag.StringVar(&preferredChain, "preferred-chain", "", "use the chain whose root or intermediate is issued by this common name, e.g. \"ISRG Root X1\", if the CA offers it")
+	flag.StringVar(&outDir, "out-dir", ".", "directory to write the certificate files to")
+	nameFormat := flag.String("name", "{{.Name}}", "template of the certificate file names, with .Name (primary name without \"*.\"), .Domain and .Names")
+	formatList := flag.String("format", "cert", "comma-separated list of formats of the certificate files, can be "+strings.Join(outputFormats, ", "))
+	flag.StringVar(&p12Password, "p12-password", os.Getenv("MKCERT_P12_PASSWORD"), "password of the p12 format (default is $MKCERT_P12_PASSWORD)")
 	flag.Usage = func() {
 		fmt.Println("Usage of mkcert [OPTIONS] [NAMES...]")
+		fmt.Println("         mkcert [OPTIONS] renew [RENEW OPTIONS] [FILES OR DIRS...]")
+		fmt.Println("         mkcert [OPTIONS] apply|plan MANIFEST")
+		fmt.Println("         mkcert [OPTIONS] revoke [REVOKE OPTIONS] NAME.cert")
+		fmt.Println("         mkcert [OPTIONS] account list|rotate-key|update-email NEW_EMAIL|deactivate")
+		fmt.Println("         mkcert [OPTIONS] cname [CNAME OPTIONS] NAMES...")
 		fmt.Println(`
-This utility obtains certbot's (Let's Encrypt) wildcard certificates by
-updating DNS TXT records and answering stupid certbot questions for you.
+This utility obtains certbot's (Let's Encrypt) certificates by updating DNS TXT
+records and answering stupid certbot questions for you.
+
+NAMES: Provide at least one certificate. Each certificate is a comma-separated
+list of domain names (SANs), with or without wildcards, for example
+"*.example.com,*.api.example.com,example.net". The first name is the primary
+name, which names the certificate files. A single wildcard name like
+"*.example.com" also covers "example.com". If -csr is used, NAMES must be
+omitted.
+
+CHALLENGES: Names are validated with DNS-01 challenges by default (see
+-challenge). To use another challenge type for a name, append "=" and the
+type, for example "*.example.com,www.example.net=http-01". HTTP-01 challenges
+are served on -http-addr, written to -webroot or deployed by -http-hook.
+TLS-ALPN-01 challenges are served on -tls-addr. Wildcard names can only use
+DNS-01. Certificates with other challenge types than DNS-01 are issued by
+mkcert itself instead of certbot.
+
+If -dns is a list of providers, the TXT record of each name is created on the
+provider which has the most specific zone for that name.
+
+DNS ACCOUNTS: -dns-config is a TOML or YAML file of named accounts of DNS
+providers, for example several accounts of the same provider, which -dns can
+use like providers. Without -dns, all of the accounts are used, so each name
+is on the account that owns its zone.
+
+DELEGATION: If _acme-challenge of a name is a CNAME, its TXT record is created
+at the target of the CNAME instead, which can be in a zone of -dns or a
+subdomain of acme-dns ("-dns acmedns"). CNAMEs are looked up with -resolver.
+Use "cname -h" to print the CNAME records to ask domain owners for.
+
+RENEW: Scans *.cert files (in the working directory by default) and issues
+again those which expire in -days, with the same names and key type. Use
+"renew -h" for its options.
+
+MANIFEST: "apply" issues the certificates listed in a TOML or YAML manifest
+which are missing, have changed or are due for renewal, and reports other
+certificate files in the same directories. "plan" shows what apply would do.
+
+REVOKE: Revokes a certificate, local or stored in OSS. Use "revoke -h" for its
+options.
+
+ACCOUNTS: ACME accounts are kept in -state-dir for each server and email and
+are reused by later runs. Use "account list" to list all accounts, and
+"account rotate-key", "account update-email" or "account deactivate" to
+manage the account of -server and -email.
 
-NAMES: Provide at least one domain. All domain names must start with "*.".
+HOOKS: Each -hook runs after a certificate is issued, "upload" uploads its
+files with upcert and other hooks are shell commands. Hooks get these
+environment variables: MKCERT_DOMAIN (the primary name), MKCERT_NAMES,
+MKCERT_CERT_PATH, MKCERT_KEY_PATH (files of the first -format), MKCERT_SERIAL,
+MKCERT_NOT_AFTER and MKCERT_CHAIN (the issuers of the chain, like
+"R3 > ISRG Root X1"). A failed hook is reported, the certificate is kept.
+
+OUTPUT: Certificate files are written to -out-dir and named by the -name
+template, for example "{{.Name}}/{{.Name}}". -format chooses the files: "cert"
+(NAME.cert and NAME.key, which upcert uploads), "pem" (NAME/cert.pem,
+chain.pem, fullchain.pem and privkey.pem like certbot), "der" (NAME.der and
+NAME.key.der), "combined" (NAME.pem with the full chain and the key, like
+HAProxy wants) and "p12" (NAME.p12, encrypted with -p12-password). An
+existing file with other content is kept as NAME.YYYYMMDDHHMMSS.bak, and
+private keys are only readable by the owner.
+
+CHAINS: Some CAs offer alternate chains of a certificate. -preferred-chain
+chooses the chain whose root is issued by the common name, or else the chain
+with an intermediate issued by it. The default chain is used if no chain
+matches. Certificates with a preferred chain are issued by mkcert itself
+instead of certbot.
+
+PARALLEL: With -parallel, several certificates are issued at the same time.
+Their logs are prefixed with their primary names, and a summary is printed
+at the end. A failed certificate doesn't stop the others.
 
 NOTE: You may be [rate-limited](https://letsencrypt.org/docs/rate-limits/)
 if you are going to make many certs with the same IP address.
 
-NOTE: Certbot runs in a Docker container, the certificate files
-("example.com.cert" and "example.com.key") will be copied from the container to
-the working directory (will be overwritten without prompt if same file exists).
-If you still need your old certificate files, please backup first.
+NOTE: Certbot runs in a Docker container, the certificate files are copied
+from the container to -out-dir (see OUTPUT).
 
 OPTIONS:`)
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	var client dns.DNS
-	if *dnsType == "alidns" {
-		client = dns.Alidns{}
-	} else if *dnsType == "cloudflare" {
-		client = dns.Cloudflare{}
-	} else {
-		log.Fatal("Error: bad dns type")
+	var dnsNames []string
+	var err error
+	if dnsAccounts, dnsNames, err = dnsFlags.Accounts(); err != nil {
+		log.Fatal("Error: ", err)
 	}
+	dnsTypes := strings.Join(dnsNames, ",")
 
-	targets := flag.Args()
-
-	if len(targets) == 0 {
-		log.Fatal("please provide wildcard domain name like this: *.example.com")
+	providers, err := newProviders(dnsTypes)
+	if err != nil {
+		log.Fatal("Error: ", err)
 	}
 
-	for i, target := range targets {
-		target = strings.TrimRight(target, ".")
-		if strings.Count(target, "*") == 0 {
-			targets[i] = "*." + target
-			fmt.Fprintf(os.Stderr, `Did you mean "%s"? (Y/n) `, targets[i])
-			var answer string
-			fmt.Scanln(&answer)
-			answer = strings.ToLower(strings.TrimSpace(answer))
-			if answer != "" && answer != "y" {
-				log.Fatal("Aborted")
-				return
-			}
-		} else if strings.Count(target, "*") > 1 || !strings.HasPrefix(target, "*.") {
-			log.Fatalf("Error: domain name %s must start with one '*.'", target)
+	if serverURL, err = resolveServer(*server); err != nil {
+		log.Fatal("Error: ", err)
+	}
+	if (eabKid == "") != (eabHmacKey == "") {
+		log.Fatal("Error: -eab-kid and -eab-hmac-key must be used together")
+	}
+	if caBundle != "" {
+		if caBundle, err = filepath.Abs(caBundle); err == nil {
+			_, err = os.Stat(caBundle)
+		}
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
 
-	for i, target := range targets {
-		if i > 0 {
-			log.Println(strings.Repeat("=", 40))
-		}
-		get(client, target)
+	switch flag.Arg(0) {
+	case "account":
+		runAccount(flag.Args()[1:])
+		return
+	case "revoke":
+		runRevoke(flag.Args()[1:])
+		return
+	case "cname":
+		runCNAME(providers, flag.Args()[1:])
+		return
 	}
-}
 
-func get(client dns.DNS, target string) {
-	log.Println("processing", target)
-	targetWithoutWildcard := strings.TrimPrefix(target, "*.")
-	acme := strings.Replace(target, "*", "_acme-challenge", 1)
-	domains := client.GetListOfDomains()
-	root := ""
-	for _, domain := range domains {
-		if strings.HasSuffix(target, domain) {
-			root = domain
-			break
-		}
+	if nameTemplate, err = template.New("name").Parse(*nameFormat); err != nil {
+		log.Fatal("Error: bad -name: ", err)
 	}
-	if root == "" {
-		log.Fatalln("Error: you don't have root domain for", target)
+	if formats, err = parseFormats(*formatList); err != nil {
+		log.Fatal("Error: ", err)
 	}
-	acmeWithoutRoot := strings.TrimSuffix(strings.TrimSuffix(acme, root), ".")
 
-	log.Println("root domain:", root)
+	if keyType != "" && !isValidKeyType(keyType) {
+		log.Fatal("Error: bad key type")
+	}
+	if !isValidChallengeType(defaultChallenge) {
+		log.Fatal("Error: bad challenge type ", defaultChallenge)
+	}
+	if reuseKey && csrFile != "" {
+		log.Fatal("Error: -reuse-key can not be used with -csr")
+	}
 
-	if shouldClean {
-		for _, id := range client.GetRecordIdsFor(root, acmeWithoutRoot, "TXT") {
-			log.Println("deleting TXT record with id", id)
-			client.DeleteRecord(root, id)
+	if flag.Arg(0) == "apply" || flag.Arg(0) == "plan" {
+		if csrFile != "" {
+			log.Fatal("Error: -csr can not be used with ", flag.Arg(0))
 		}
+		runManifest(dnsTypes, *server, flag.Args()[1:], flag.Arg(0) == "apply")
 		return
 	}
 
-	containerId := newContainer(target)
-	containerId = containerId[:8]
-	log.Println("created container:", containerId)
+	if flag.Arg(0) == "renew" {
+		if csrFile != "" {
+			log.Fatal("Error: -csr can not be used with renew")
+		}
+		runRenew(providers, flag.Args()[1:])
+		return
+	}
 
-	log.Println("finding TXT records for", acmeWithoutRoot)
-	ids := client.GetRecordIdsFor(root, acmeWithoutRoot, "TXT")
-	if len(ids) == 0 {
-		log.Println("no TXT records for", acmeWithoutRoot, "yet!")
-	} else {
-		log.Println("found", len(ids), "TXT records for", acmeWithoutRoot)
-		for _, id := range ids {
-			log.Println("deleting TXT record with id", id)
-			client.DeleteRecord(root, id)
+	var orders []order
+
+	if csrFile != "" {
+		if flag.NArg() > 0 {
+			log.Fatal("Error: NAMES can not be used with -csr")
 		}
+		csr, _, err := readCSR(csrFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		names, err := parseNames(strings.Join(csrNames(csr), ","))
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		o := order{names: names, csrFile: csrFile, dir: outDir, hooks: hooks, preferredChain: preferredChain}
+		if err := o.checkChallenges(); err != nil {
+			log.Fatal("Error: ", err)
+		}
+		orders = append(orders, o)
 	}
 
-	c := newCertbot()
-	go c.start(containerId, acme)
+	for _, arg := range flag.Args() {
+		names, challenges, err := parseChallenges(arg)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		o := newOrder(names, outDir)
+		o.challenges = challenges
+		if err := o.checkChallenges(); err != nil {
+			log.Fatal("Error: ", err)
+		}
+		orders = append(orders, o)
+	}
 
-	log.Println("waiting acme challenge")
-	challenges := []string{}
-	for challenge := range c.acmeChallengeChan {
-		challenges = append(challenges, challenge)
-	}
-	for _, challenge := range challenges {
-		log.Println("received certbot's acme challenge:", challenge)
-		log.Println("creating new TXT record")
-		id := client.AddNewRecord(root, acmeWithoutRoot, "TXT", challenge)
-		log.Println("new record has been created, id:", id)
-	}
-	log.Println("wait", secondsToWait, "seconds for dns records to take effect")
-	time.Sleep(time.Duration(secondsToWait) * time.Second)
-	c.continueChan <- true
-	if !dryRun {
-		log.Println("waiting cert files")
-		cert := copyFileFromContainer(containerId, <-c.pemFileChan)
-		writeFile(targetWithoutWildcard+".cert", cert)
-		key := copyFileFromContainer(containerId, <-c.keyFileChan)
-		writeFile(targetWithoutWildcard+".key", key)
-	}
-	<-c.doneChan
-	removeContainer(containerId)
-	log.Println("done:", target)
+	if len(orders) == 0 {
+		log.Fatal("please provide domain names like this: *.example.com")
+	}
+
+	issueAll(providers, orders)
 }
 
-func writeFile(file string, content []byte) {
-	if len(content) == 0 {
-		log.Fatal(file, "is empty")
-	}
-	err := ioutil.WriteFile(file, content, 0644)
+func defaultStateDir() string {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatal(err)
+		return ".certutils"
 	}
-	log.Println("written file", file)
+	return filepath.Join(home, ".certutils")
 }
 
-func newContainer(domain string) string {
-	domainWithoutWildcard := strings.TrimPrefix(domain, "*.")
-	command := []string{
-		"docker", "create", "-i", "--platform", "linux/amd64",
-		"certbot/certbot:v1.10.0", "certonly", "--manual",
-		"--preferred-challenges=dns", "--email", email,
-		"--server", "https://acme-v02.api.letsencrypt.org/directory",
-		"--agree-tos", "-d", domain, "-d", domainWithoutWildcard,
+// parseNames parses a comma-separated list of domain names of a certificate.
+func parseNames(arg string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(arg, ",") {
+		name = strings.ToLower(strings.TrimRight(strings.TrimSpace(name), "."))
+		if name == "" || seen[name] {
+			continue
+		}
+		if strings.Count(name, "*") > 1 || (strings.Contains(name, "*") && !strings.HasPrefix(name, "*.")) {
+			return nil, fmt.Errorf("domain name %s can only start with one '*.'", name)
+		}
+		seen[name] = true
+		names = append(names, name)
 	}
-	if dryRun {
-		command = append(command, "--dry-run")
+	if len(names) == 0 {
+		return nil, errors.New("no domain names in " + arg)
+	}
+	if len(names) == 1 && strings.HasPrefix(names[0], "*.") {
+		names = append(names, strings.TrimPrefix(names[0], "*."))
 	}
-	if debug {
-		log.Println("running", command)
+	return names, nil
+}
+
+// parseChallenges parses a comma-separated list of domain names, each of
+// which may be followed by "=" and its challenge type.
+func parseChallenges(arg string) ([]string, map[string]string, error) {
+	var list []string
+	challenges := map[string]string{}
+	for _, item := range strings.Split(arg, ",") {
+		i := strings.Index(item, "=")
+		if i < 0 {
+			list = append(list, item)
+			continue
+		}
+		name, typ := item[:i], strings.TrimSpace(item[i+1:])
+		if !isValidChallengeType(typ) {
+			return nil, nil, errors.New("bad challenge type " + typ)
+		}
+		list = append(list, name)
+		names, err := parseNames(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		challenges[names[0]] = typ
 	}
-	cmd := exec.Command(command[0], command[1:]...)
-	out, err := cmd.CombinedOutput()
+	names, err := parseNames(strings.Join(list, ","))
 	if err != nil {
-		log.Fatal(string(out))
+		return nil, nil, err
+	}
+	// the name added for a single wildcard name uses the same challenge
+	if len(list) == 1 && len(names) == 2 {
+		if typ, ok := challenges[names[0]]; ok {
+			challenges[names[1]] = typ
+		}
 	}
-	return strings.TrimSpace(string(out))
+	return names, challenges, nil
 }
 
-func removeContainer(containerId string) {
-	log.Println("removing container", containerId)
-	cmd := exec.Command("docker", "rm", "-fv", containerId)
-	err := cmd.Run()
-	if err != nil {
-		log.Fatal(err)
+// checkChallenges returns error if a name can't use its challenge type.
+func (o order) checkChallenges() error {
+	for _, name := range o.names {
+		if t := o.challengeType(name); t != dns01 && strings.HasPrefix(name, "*.") {
+			return fmt.Errorf("wildcard name %s can only use %s, not %s", name, dns01, t)
+		}
 	}
+	return nil
 }
 
-func copyFileFromContainer(containerId, file string) []byte {
-	log.Println("copying", file, "from", containerId)
-	cmd := exec.Command("docker", "cp", "--follow-link", containerId+":"+file, "-")
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal(err)
+// csrNames returns the names in a CSR, with its common name first.
+func csrNames(csr *x509.CertificateRequest) []string {
+	names := []string{}
+	if csr.Subject.CommonName != "" {
+		names = append(names, csr.Subject.CommonName)
 	}
-	err = cmd.Start()
-	if err != nil {
-		log.Fatal(err)
+	return append(names, csr.DNSNames...)
+}
+
+// get issues the certificate of the order and runs its hooks.
+func get(providers []*provider, o order) error {
+	out, err := obtain(providers, o)
+	if err != nil || out == nil {
+		return err
 	}
-	tr := tar.NewReader(stdout)
-	var buf bytes.Buffer
-	for {
-		_, err := tr.Next()
-		if err == io.EOF {
-			break // End of archive
+	return runHooks(o.logger(), o, out)
+}
+
+func obtain(providers []*provider, o order) (*output, error) {
+	l := o.logger()
+	names := o.names
+	l.Println("processing", strings.Join(names, ", "))
+
+	// one challenge record for each distinct name, grouped by zone
+	zones := map[string]*zone{}
+	byZone := map[string][]string{}
+	var acmes, zoneNames []string
+	for _, name := range names {
+		if o.challengeType(name) != dns01 {
+			l.Println(name, "uses", o.challengeType(name))
+			continue
+		}
+		acme := acmeName(name)
+		if zones[acme] != nil {
+			continue
 		}
+		z, err := findChallengeZone(l, providers, acme)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		if _, err := io.Copy(&buf, tr); err != nil {
-			log.Fatal(err)
+		if z == nil {
+			return nil, errors.New("you don't have root domain for " + name)
+		}
+		zones[acme] = z
+		acmes = append(acmes, acme)
+		if byZone[z.String()] == nil {
+			zoneNames = append(zoneNames, z.String())
 		}
+		byZone[z.String()] = append(byZone[z.String()], z.record())
 	}
-	err = cmd.Wait()
-	if err != nil {
-		log.Fatal(err)
+	for _, z := range zoneNames {
+		l.Println("root domain:", z, "for", strings.Join(byZone[z], ", "))
 	}
-	return buf.Bytes()
-}
+	defer lockNames(acmes)()
 
-type certbot struct {
-	acmeChallengeChan, pemFileChan, keyFileChan chan string
-	continueChan, doneChan                      chan bool
-}
-
-func newCertbot() *certbot {
-	return &certbot{
-		acmeChallengeChan: make(chan string),
-		pemFileChan:       make(chan string),
-		keyFileChan:       make(chan string),
-		continueChan:      make(chan bool),
-		doneChan:          make(chan bool),
+	if shouldClean {
+		for _, acme := range acmes {
+			if err := zones[acme].clean(l, zones[acme].record()); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
 	}
-}
 
-func (c *certbot) start(containerId, acme string) {
-	cmd := exec.Command("docker", "start", "-ai", containerId)
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer stdin.Close()
-	go func() {
-		for {
-			select {
-			case <-c.continueChan:
-				log.Println("pressing enter to certbot, waiting for response...")
-				io.WriteString(stdin, "\n")
+	if !o.usesCertbot() {
+		for _, acme := range acmes {
+			l.Println("finding TXT records for", acme)
+			if err := zones[acme].clean(l, zones[acme].record()); err != nil {
+				return nil, err
 			}
 		}
-	}()
-	stdout, err := cmd.StdoutPipe()
+		return issue(o, zones)
+	}
+
+	csr, err := getCSR(o)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	stderr, err := cmd.StderrPipe()
+
+	containerId, err := newContainer(l, o, csr != nil)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	containerId = containerId[:8]
+	l.Println("created container:", containerId)
+	defer removeContainer(l, containerId)
+	if csr != nil {
+		if err := copyFileToContainer(l, containerId, csrPath, csr); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, acme := range acmes {
+		l.Println("finding TXT records for", acme)
+		if err := zones[acme].clean(l, zones[acme].record()); err != nil {
+			return nil, err
+		}
+	}
+
+	c := newCertbot(l, csr != nil)
+	defer close(c.abort)
+	go c.start(containerId, len(names))
+
+	// certbot asks for one challenge for each name (authorization) which is
+	// not yet valid, one at a time. Records are created as soon as they are
+	// asked for, and certbot verifies all of them after the last one.
+	l.Println("waiting acme challenge")
+	asked := 0
+	for challenge := range c.acmeChallengeChan {
+		asked += 1
+		l.Println("received certbot's acme challenge for", challenge.name+":", challenge.value)
+		z := zones[challenge.name]
+		if z == nil {
+			return nil, errors.New("unexpected acme challenge for " + challenge.name)
+		}
+		l.Println("creating new TXT record in", z.String())
+		id, err := z.addTXT(z.record(), challenge.value)
+		if err != nil {
+			return nil, err
+		}
+		l.Println("new record has been created, id:", id)
+		if !challenge.last {
+			c.next()
+		}
+	}
+	if asked > 0 {
+		l.Println("wait", secondsToWait, "seconds for dns records to take effect")
+		time.Sleep(time.Duration(secondsToWait) * time.Second)
+		c.next()
+	} else {
+		l.Println("all names have valid authorizations")
+	}
+	<-c.done
+	if c.err != nil {
+		return nil, c.err
+	}
+	if dryRun {
+		l.Println("done:", names[0])
+		return nil, nil
+	}
+
+	pemFile, keyFile := c.pemFile, c.keyFile
+	if csr != nil {
+		pemFile = fullchainPath
+	} else if pemFile == "" || keyFile == "" {
+		return nil, errors.New("certbot did not tell where the cert files are")
 	}
-	err = cmd.Start()
+	cert, err := copyFileFromContainer(l, containerId, pemFile)
 	if err != nil {
-		log.Fatal(err)
-	}
-	scanner := bufio.NewScanner(stdout)
-	mode, success, acmeCount := 0, false, 0
-	for scanner.Scan() {
-		t := scanner.Text()
-		if debug {
-			log.Println("certbot:", t)
-		}
-		switch mode {
-		case 1:
-			if strings.Contains(t, acme) {
-				mode = 2
-			}
-		case 2:
-			if t == "" {
-				continue
-			}
-			c.acmeChallengeChan <- t
-			acmeCount += 1
-			if acmeCount == 1 {
-				c.continueChan <- true
-			} else if acmeCount == 2 {
-				close(c.acmeChallengeChan)
-			}
-			mode = 3
-		default:
-			if strings.Contains(t, "deploy a DNS TXT record") {
-				mode = 1
-			} else if strings.Contains(t, "successful") || strings.Contains(t, "Congratulations") {
-				success = true
-			} else if strings.Contains(t, "fullchain.pem") {
-				c.pemFileChan <- strings.TrimSpace(t)
-			} else if strings.Contains(t, "privkey.pem") {
-				c.keyFileChan <- strings.TrimSpace(t)
-			}
+		return nil, err
+	}
+	var key []byte
+	if csr == nil {
+		if key, err = copyFileFromContainer(l, containerId, keyFile); err != nil {
+			return nil, err
 		}
 	}
-	stderrBytes, _ := io.ReadAll(stderr)
-	err = cmd.Wait()
+	out, err := writeOutputs(l, o, cert, key)
 	if err != nil {
-		stderr := strings.TrimSpace(string(stderrBytes))
-		if stderr != "" {
-			lines := strings.Split(stderr, "\n")
-			for _, line := range lines {
-				log.Println("\x1b[31mSTDERR:", line, "\x1b[0m")
-			}
+		return nil, err
+	}
+	l.Println("done:", names[0])
+	return out, nil
+}
+
+// getCSR returns the CSR to send to certbot, or nil if certbot should
+// generate the private key itself.
+func getCSR(o order) ([]byte, error) {
+	l := o.logger()
+	if o.csrFile != "" {
+		csr, content, err := readCSR(o.csrFile)
+		if err != nil {
+			return nil, err
 		}
-		log.Fatal(err)
+		l.Println("using CSR", o.csrFile, "with", describeKey(csr.PublicKey), "key")
+		return content, nil
 	}
-	if success {
-		log.Println("successfully generated certificates")
-	} else {
-		log.Println("failed to generate certificates")
+	if o.keyFile != "" {
+		key, err := o.reusedKey()
+		if err != nil {
+			return nil, err
+		}
+		csr, err := newCSR(key, o.names)
+		if err != nil {
+			return nil, err
+		}
+		l.Println("reusing", describeKey(key.Public()), "key", o.keyFile)
+		return csr, nil
+	}
+	if o.keyType != "" {
+		l.Println("generating", o.keyType, "key")
 	}
-	c.doneChan <- true
+	return nil, nil
 }
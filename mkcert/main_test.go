@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNames(t *testing.T) {
+	for _, test := range []struct {
+		arg   string
+		names []string
+		err   string
+	}{
+		{"example.com", []string{"example.com"}, ""},
+		{" Example.COM. , www.example.com", []string{"example.com", "www.example.com"}, ""},
+		{"example.com,www.example.com,example.com", []string{"example.com", "www.example.com"}, ""},
+		{"*.example.com", []string{"*.example.com", "example.com"}, ""},
+		{"*.example.com,example.net", []string{"*.example.com", "example.net"}, ""},
+		{"example.com,,", []string{"example.com"}, ""},
+		{"", nil, "no domain names in "},
+		{" , .", nil, "no domain names in  , ."},
+		{"*.*.example.com", nil, "domain name *.*.example.com can only start with one '*.'"},
+		{"www.*.example.com", nil, "domain name www.*.example.com can only start with one '*.'"},
+		{"*example.com", nil, "domain name *example.com can only start with one '*.'"},
+	} {
+		names, err := parseNames(test.arg)
+		if !reflect.DeepEqual(names, test.names) || errString(err) != test.err {
+			t.Errorf("names of %q are %q (%v), want %q (%s)", test.arg, names, err, test.names, test.err)
+		}
+	}
+}
+
+func TestParseChallenges(t *testing.T) {
+	for _, test := range []struct {
+		arg        string
+		names      []string
+		challenges map[string]string
+		err        string
+	}{
+		{"example.com", []string{"example.com"}, map[string]string{}, ""},
+		{"example.com=http-01,www.example.com", []string{"example.com", "www.example.com"},
+			map[string]string{"example.com": http01}, ""},
+		{"Example.com.=tls-alpn-01, www.example.com = http-01", []string{"example.com", "www.example.com"},
+			map[string]string{"example.com": tlsALPN01, "www.example.com": http01}, ""},
+		// the name added for a single wildcard name uses its challenge type
+		{"*.example.com=dns-01", []string{"*.example.com", "example.com"},
+			map[string]string{"*.example.com": dns01, "example.com": dns01}, ""},
+		{"*.example.com=dns-01,example.com=http-01", []string{"*.example.com", "example.com"},
+			map[string]string{"*.example.com": dns01, "example.com": http01}, ""},
+		{"example.com=http-02", nil, nil, "bad challenge type http-02"},
+		{"example.com=", nil, nil, "bad challenge type "},
+		{"example.com=DNS-01", nil, nil, "bad challenge type DNS-01"},
+		{"=dns-01", nil, nil, "no domain names in "},
+		{"a.example.com=b.example.com=dns-01", nil, nil, "bad challenge type b.example.com=dns-01"},
+		{"*.*.example.com=dns-01", nil, nil, "domain name *.*.example.com can only start with one '*.'"},
+		{",", nil, nil, "no domain names in ,"},
+	} {
+		names, challenges, err := parseChallenges(test.arg)
+		if !reflect.DeepEqual(names, test.names) || !reflect.DeepEqual(challenges, test.challenges) || errString(err) != test.err {
+			t.Errorf("challenges of %q are %q %v (%v), want %q %v (%s)",
+				test.arg, names, challenges, err, test.names, test.challenges, test.err)
+		}
+	}
+}
+
+func TestCheckChallenges(t *testing.T) {
+	defer func(c string) { defaultChallenge = c }(defaultChallenge)
+	for _, test := range []struct {
+		arg, defaultChallenge, err string
+	}{
+		{"example.com,*.example.net", dns01, ""},
+		{"example.com=http-01,www.example.com=tls-alpn-01", dns01, ""},
+		{"example.com,www.example.com", http01, ""},
+		{"*.example.com", http01, "wildcard name *.example.com can only use dns-01, not http-01"},
+		{"*.example.com=tls-alpn-01", dns01, "wildcard name *.example.com can only use dns-01, not tls-alpn-01"},
+		{"*.example.com=dns-01", http01, ""},
+		{"example.com,*.example.net=http-01", dns01, "wildcard name *.example.net can only use dns-01, not http-01"},
+	} {
+		defaultChallenge = test.defaultChallenge
+		names, challenges, err := parseChallenges(test.arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := order{names: names, challenges: challenges}
+		if err := o.checkChallenges(); errString(err) != test.err {
+			t.Errorf("%q with %s is %v, want %s", test.arg, test.defaultChallenge, err, test.err)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// A manifest lists the certificates to keep, in TOML or YAML. Options missing
+// from a certificate are taken from the defaults, and then from the flags.
+type (
+	manifest struct {
+		Defaults     manifestCert   `toml:"defaults" yaml:"defaults"`
+		Certificates []manifestCert `toml:"certificates" yaml:"certificates"`
+	}
+
+	manifestCert struct {
+		Names      []string `toml:"names" yaml:"names"`
+		DNS        string   `toml:"dns" yaml:"dns"`
+		Challenge  string   `toml:"challenge" yaml:"challenge"`
+		KeyType    string   `toml:"key_type" yaml:"key_type"`
+		ReuseKey   bool     `toml:"reuse_key" yaml:"reuse_key"`
+		Chain      string   `toml:"preferred_chain" yaml:"preferred_chain"`
+		Server     string   `toml:"server" yaml:"server"`
+		Email      string   `toml:"email" yaml:"email"`
+		EABKid     string   `toml:"eab_kid" yaml:"eab_kid"`
+		EABHmacKey string   `toml:"eab_hmac_key" yaml:"eab_hmac_key"`
+		Dir        string   `toml:"dir" yaml:"dir"`
+		Days       int      `toml:"days" yaml:"days"`
+
+		// files of the certificate, like -format and -name
+		Format string `toml:"format" yaml:"format"`
+		Name   string `toml:"name" yaml:"name"`
+
+		// post-issue actions, upload and run are short for the hooks
+		// "upload:UPCERT" and "shell:RUN"
+		Hooks  []string `toml:"hooks" yaml:"hooks"`
+		Upload bool     `toml:"upload" yaml:"upload"`
+		Upcert string   `toml:"upcert" yaml:"upcert"`
+		Run    []string `toml:"run" yaml:"run"`
+	}
+
+	// manifestItem is a certificate of the manifest and what to do with it.
+	manifestItem struct {
+		cert      manifestCert
+		file      string
+		action    string
+		reason    string
+		result    string
+		order     order
+		providers []*provider
+	}
+)
+
+const (
+	actionNone  = "none"
+	actionIssue = "issue"
+	actionRenew = "renew"
+)
+
+func readManifest(file string) (*manifest, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".toml":
+		err = toml.Unmarshal(content, &m)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, &m)
+	default:
+		return nil, errors.New(file + ": manifest must be a .toml, .yaml or .yml file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(m.Certificates) == 0 {
+		return nil, errors.New(file + ": no certificates")
+	}
+	return &m, nil
+}
+
+// withDefaults returns the certificate with missing options from d and the
+// flags.
+func (c manifestCert) withDefaults(d manifestCert, dnsTypes, server string) manifestCert {
+	str := func(s *string, values ...string) {
+		for _, v := range values {
+			if *s == "" {
+				*s = v
+			}
+		}
+	}
+	str(&c.DNS, d.DNS, dnsTypes)
+	str(&c.Challenge, d.Challenge, defaultChallenge)
+	str(&c.KeyType, d.KeyType, keyType)
+	str(&c.Chain, d.Chain, preferredChain)
+	str(&c.Server, d.Server, server)
+	str(&c.Email, d.Email, email)
+	str(&c.EABKid, d.EABKid, eabKid)
+	str(&c.EABHmacKey, d.EABHmacKey, eabHmacKey)
+	str(&c.Dir, d.Dir, ".")
+	str(&c.Upcert, d.Upcert, "upcert")
+	str(&c.Format, d.Format, strings.Join(formats, ","))
+	str(&c.Name, d.Name)
+	c.ReuseKey = c.ReuseKey || d.ReuseKey || reuseKey
+	c.Upload = c.Upload || d.Upload
+	if c.Run == nil {
+		c.Run = d.Run
+	}
+	if c.Hooks == nil {
+		c.Hooks = d.Hooks
+	}
+	if c.Hooks == nil {
+		c.Hooks = hooks
+	}
+	if c.Days == 0 {
+		c.Days = d.Days
+	}
+	if c.Days == 0 {
+		c.Days = 30
+	}
+	return c
+}
+
+// account returns the ACME account options of the certificate, certificates
+// with the same account are issued together.
+func (c manifestCert) account() string {
+	return strings.Join([]string{c.Server, c.Email, c.EABKid, c.EABHmacKey}, "\n")
+}
+
+// useAccount sets the global ACME account options to the certificate's.
+func (c manifestCert) useAccount() error {
+	email, eabKid, eabHmacKey = c.Email, c.EABKid, c.EABHmacKey
+	var err error
+	serverURL, err = resolveServer(c.Server)
+	return err
+}
+
+func runManifest(dnsTypes, server string, args []string, apply bool) {
+	if len(args) != 1 {
+		log.Fatal("Error: please provide one manifest file")
+	}
+	m, err := readManifest(args[0])
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	providers := map[string][]*provider{}
+	var items []*manifestItem
+	var accounts []string
+	byAccount := map[string][]*manifestItem{}
+	for i, c := range m.Certificates {
+		c = c.withDefaults(m.Defaults, dnsTypes, server)
+		it, err := newManifestItem(c)
+		if err != nil {
+			log.Fatalf("Error: certificate %d: %s", i+1, err)
+		}
+		if providers[c.DNS] == nil {
+			if providers[c.DNS], err = newProviders(c.DNS); err != nil {
+				log.Fatal("Error: ", err)
+			}
+		}
+		it.providers = providers[c.DNS]
+		items = append(items, it)
+		if byAccount[c.account()] == nil {
+			accounts = append(accounts, c.account())
+		}
+		byAccount[c.account()] = append(byAccount[c.account()], it)
+	}
+	for _, it := range items {
+		for _, other := range items {
+			if it != other && it.file == other.file {
+				log.Fatal("Error: more than one certificate is written to ", it.file)
+			}
+		}
+	}
+
+	// decide what to do with each certificate, by the renewal information of
+	// its server if there is any
+	for _, account := range accounts {
+		group := byAccount[account]
+		if err := group[0].cert.useAccount(); err != nil {
+			log.Fatal("Error: ", err)
+		}
+		var dir *directory
+		if d, err := getDirectory(serverURL); err == nil && d.RenewalInfo != "" {
+			dir = d
+		}
+		for _, it := range group {
+			it.plan(dir, apply)
+		}
+	}
+
+	unexpected := findUnexpected(items)
+
+	if apply {
+		for _, account := range accounts {
+			var orders []order
+			var todo []*manifestItem
+			for _, it := range byAccount[account] {
+				if it.action != actionNone {
+					orders = append(orders, it.order)
+					todo = append(todo, it)
+				}
+			}
+			if len(todo) == 0 {
+				continue
+			}
+			if err := todo[0].cert.useAccount(); err != nil {
+				log.Println("Error:", err)
+				for _, it := range todo {
+					it.result = "failed: " + err.Error()
+				}
+				continue
+			}
+			errs := runOrders(orders, func(i int, o order) error {
+				it := todo[i]
+				l := o.logger()
+				l.Println(it.action+":", it.file, "("+it.reason+")")
+				err := get(it.providers, o)
+				if err != nil {
+					l.Println("Error:", err)
+					it.result = "failed: " + err.Error()
+					if isHookError(err) {
+						it.result = err.Error()
+					}
+					return err
+				}
+				it.result = "done"
+				return nil
+			})
+			for i, err := range errs {
+				if err != nil && todo[i].result == "" {
+					todo[i].result = "failed: " + err.Error()
+				}
+			}
+		}
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if apply {
+		fmt.Fprintln(w, "CERTIFICATE\tACTION\tREASON\tRESULT")
+	} else {
+		fmt.Fprintln(w, "CERTIFICATE\tACTION\tREASON")
+	}
+	for _, it := range items {
+		if apply {
+			result := it.result
+			if it.action == actionNone {
+				result = "-"
+			} else if result != "done" {
+				failed += 1
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", it.file, it.action, it.reason, result)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", it.file, it.action, it.reason)
+		}
+	}
+	for _, file := range unexpected {
+		if apply {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", file, "unexpected", "not in manifest", "-")
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", file, "unexpected", "not in manifest")
+		}
+	}
+	w.Flush()
+	if failed > 0 {
+		log.Fatalf("%d certificates failed", failed)
+	}
+}
+
+func newManifestItem(c manifestCert) (*manifestItem, error) {
+	names, challenges, err := parseChallenges(strings.Join(c.Names, ","))
+	if err != nil {
+		return nil, err
+	}
+	if !isValidChallengeType(c.Challenge) {
+		return nil, errors.New("bad challenge type " + c.Challenge)
+	}
+	if c.KeyType != "" && !isValidKeyType(c.KeyType) {
+		return nil, errors.New("bad key type " + c.KeyType)
+	}
+	o := order{names: names, keyType: c.KeyType, challenges: challenges, dir: c.Dir, preferredChain: c.Chain}
+	if o.formats, err = parseFormats(c.Format); err != nil {
+		return nil, err
+	}
+	if c.Name != "" {
+		t, err := template.New("name").Parse(c.Name)
+		if err != nil {
+			return nil, fmt.Errorf("bad name: %w", err)
+		}
+		o.name = executeName(t, names)
+	}
+	// names without a challenge type use the certificate's
+	for _, name := range names {
+		if _, ok := o.challenges[name]; !ok {
+			o.challenges[name] = c.Challenge
+		}
+	}
+	if err := o.checkChallenges(); err != nil {
+		return nil, err
+	}
+	if c.Upload {
+		o.hooks = append(o.hooks, uploadHook+":"+c.Upcert)
+	}
+	for _, command := range c.Run {
+		o.hooks = append(o.hooks, shellHook+command)
+	}
+	o.hooks = append(o.hooks, c.Hooks...)
+	file := o.certPath()
+	if c.ReuseKey {
+		o.keyFile = o.keyPath()
+	}
+	return &manifestItem{cert: c, file: file, order: o}, nil
+}
+
+// plan decides what to do with the certificate, dir is the directory of the
+// server if it has renewal information. The renewal time chosen is kept only
+// if apply is true.
+func (it *manifestItem) plan(dir *directory, apply bool) {
+	it.action = actionIssue
+	cert, err := readCertificate(it.file)
+	if os.IsNotExist(err) {
+		it.reason = "missing"
+		// a reused key must exist before the first certificate
+		if _, err := os.Stat(it.order.keyFile); it.order.keyFile != "" && err != nil {
+			it.order.keyFile = ""
+		}
+		return
+	}
+	if err != nil {
+		it.reason = err.Error()
+		return
+	}
+	names, err := certNames(cert, primaryName(it.order.names))
+	if err != nil || !sameNames(names, it.order.names) {
+		it.reason = "names changed"
+		return
+	}
+	if kt := describeKey(cert.PublicKey); it.order.keyType != "" && kt != it.order.keyType {
+		it.reason = "key type is " + kt + ", not " + it.order.keyType
+		return
+	}
+	r := &renewal{file: it.file, cert: cert, notAfter: cert.NotAfter, plan: !apply}
+	if isDue(r, dir, it.cert.Days) {
+		it.action, it.reason = actionRenew, "due"
+		return
+	}
+	it.action, it.reason = actionNone, fmt.Sprintf("expires %s", cert.NotAfter.Local().Format("2006-01-02"))
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// findUnexpected returns certificate files in the directories of the
+// manifest which are not in the manifest, by the first format of each
+// certificate.
+func findUnexpected(items []*manifestItem) []string {
+	known := map[string]bool{}
+	patterns := map[string]bool{}
+	for _, it := range items {
+		known[filepath.Clean(it.file)] = true
+		base := filepath.Join(filepath.Dir(it.order.base()), "*")
+		pattern, _ := formatPaths(base, it.order.fileFormats()[0])
+		patterns[pattern] = true
+	}
+	var unexpected []string
+	for pattern := range patterns {
+		files, _ := filepath.Glob(pattern)
+		for _, file := range files {
+			if !known[filepath.Clean(file)] {
+				unexpected = append(unexpected, file)
+			}
+		}
+	}
+	sort.Strings(unexpected)
+	return unexpected
+}
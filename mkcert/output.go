@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Formats of the certificate files, BASE is -out-dir and the -name template:
+//
+//	cert       BASE.cert (full chain) and BASE.key, which upcert uploads
+//	pem        BASE/cert.pem, BASE/chain.pem, BASE/fullchain.pem and BASE/privkey.pem
+//	der        BASE.der (certificate) and BASE.key.der (PKCS #8 private key)
+//	combined   BASE.pem, the full chain followed by the private key, for HAProxy
+//	p12        BASE.p12, PKCS #12 with the full chain and private key
+var outputFormats = []string{"cert", "pem", "der", "combined", "p12"}
+
+var (
+	outDir       string
+	nameTemplate *template.Template
+	formats      []string
+	p12Password  string
+)
+
+// nameData is the data of the -name template.
+type nameData struct {
+	// Name is the primary name without "*.", Domain is the primary name
+	Name, Domain string
+	Names        []string
+}
+
+// output is the files of an issued certificate.
+type output struct {
+	cert              *x509.Certificate
+	certPath, keyPath string
+
+	// chain describes the chain by its issuers
+	chain string
+}
+
+func parseFormats(s string) ([]string, error) {
+	var list []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		valid := false
+		for _, of := range outputFormats {
+			valid = valid || f == of
+		}
+		if !valid {
+			return nil, errors.New("bad format " + f + ", can be " + strings.Join(outputFormats, ", "))
+		}
+		list = append(list, f)
+	}
+	return list, nil
+}
+
+// base returns the path of the certificate files without extension.
+func (o order) base() string {
+	name := primaryName(o.names)
+	if o.name != "" {
+		name = o.name
+	} else if nameTemplate != nil {
+		name = executeName(nameTemplate, o.names)
+	}
+	return filepath.Join(o.dir, name)
+}
+
+// executeName returns the name of the certificate files of names by the
+// template, or the primary name if the template fails or is empty.
+func executeName(t *template.Template, names []string) string {
+	name := primaryName(names)
+	var buf bytes.Buffer
+	err := t.Execute(&buf, nameData{Name: name, Domain: names[0], Names: names})
+	if err == nil && buf.Len() > 0 {
+		name = buf.String()
+	}
+	return name
+}
+
+// fileFormats returns the formats of the certificate files of the order,
+// which are -format unless the order has its own.
+func (o order) fileFormats() []string {
+	if o.formats != nil {
+		return o.formats
+	}
+	return formats
+}
+
+// formatPaths returns the certificate and private key files of a format,
+// which are the paths given to hooks.
+func formatPaths(base, format string) (certPath, keyPath string) {
+	switch format {
+	case "pem":
+		return filepath.Join(base, "fullchain.pem"), filepath.Join(base, "privkey.pem")
+	case "der":
+		return base + ".der", base + ".key.der"
+	case "combined":
+		return base + ".pem", base + ".pem"
+	case "p12":
+		return base + ".p12", base + ".p12"
+	}
+	return base + ".cert", base + ".key"
+}
+
+// certPath returns the certificate file of the first format, which is the
+// one read to decide if the certificate is due.
+func (o order) certPath() string {
+	certPath, _ := formatPaths(o.base(), o.fileFormats()[0])
+	return certPath
+}
+
+// keyPath returns the PEM encoded private key of the first format which has
+// one, which is reused by -reuse-key.
+func (o order) keyPath() string {
+	base := o.base()
+	for _, format := range o.fileFormats() {
+		switch format {
+		case "cert", "pem", "combined":
+			_, keyPath := formatPaths(base, format)
+			return keyPath
+		}
+	}
+	return base + ".key"
+}
+
+// writeOutputs writes the certificate in each -format. chain is the full
+// chain in PEM, key is the private key in PEM or nil if it is unknown, for
+// example for a CSR.
+func writeOutputs(l *log.Logger, o order, chain, key []byte) (*output, error) {
+	var certs []*pem.Block
+	for rest := chain; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate issued")
+	}
+	leaf, err := x509.ParseCertificate(certs[0].Bytes)
+	if err != nil {
+		return nil, err
+	}
+	var signer crypto.Signer
+	if key == nil && o.keyFile != "" {
+		if key, err = ioutil.ReadFile(o.keyFile); err != nil {
+			return nil, err
+		}
+	}
+	if key != nil {
+		if signer, err = parsePrivateKey(key); err != nil {
+			return nil, err
+		}
+	}
+	needKey := func(format string) error {
+		if key == nil {
+			return errors.New(format + " format needs the private key")
+		}
+		return nil
+	}
+
+	base := o.base()
+	out := &output{cert: leaf, chain: describeChain(chain)}
+	fullchain := pem.EncodeToMemory(certs[0])
+	var intermediates []byte
+	var caCerts []*x509.Certificate
+	for _, c := range certs[1:] {
+		intermediates = append(intermediates, pem.EncodeToMemory(c)...)
+		if ca, err := x509.ParseCertificate(c.Bytes); err == nil {
+			caCerts = append(caCerts, ca)
+		}
+	}
+	fullchain = append(fullchain, intermediates...)
+
+	type file struct {
+		path    string
+		content []byte
+		private bool
+	}
+	var files []file
+	// the paths given to hooks are of the first format
+	out.certPath, out.keyPath = formatPaths(base, o.fileFormats()[0])
+	for _, format := range o.fileFormats() {
+		switch format {
+		case "cert":
+			files = append(files, file{base + ".cert", fullchain, false})
+			if key != nil {
+				files = append(files, file{base + ".key", key, true})
+			}
+		case "pem":
+			files = append(files,
+				file{filepath.Join(base, "cert.pem"), pem.EncodeToMemory(certs[0]), false},
+				file{filepath.Join(base, "chain.pem"), intermediates, false},
+				file{filepath.Join(base, "fullchain.pem"), fullchain, false})
+			if key != nil {
+				files = append(files, file{filepath.Join(base, "privkey.pem"), key, true})
+			}
+		case "der":
+			files = append(files, file{base + ".der", certs[0].Bytes, false})
+			if signer != nil {
+				der, err := x509.MarshalPKCS8PrivateKey(signer)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, file{base + ".key.der", der, true})
+			}
+		case "combined":
+			if err := needKey(format); err != nil {
+				return nil, err
+			}
+			files = append(files, file{base + ".pem", append(append([]byte{}, fullchain...), key...), true})
+		case "p12":
+			if err := needKey(format); err != nil {
+				return nil, err
+			}
+			if p12Password == "" {
+				return nil, errors.New("p12 format needs -p12-password or $MKCERT_P12_PASSWORD")
+			}
+			p12, err := pkcs12.Encode(rand.Reader, signer, leaf, caCerts, p12Password)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file{base + ".p12", p12, true})
+		}
+	}
+	for _, f := range files {
+		if len(f.content) == 0 {
+			// e.g. no intermediates
+			continue
+		}
+		perm := os.FileMode(0644)
+		if f.private {
+			perm = 0600
+		}
+		if err := writeFile(l, f.path, f.content, perm); err != nil {
+			return nil, err
+		}
+	}
+	if key == nil {
+		out.keyPath = ""
+	}
+	l.Println("certificate key:", describeKey(leaf.PublicKey))
+	l.Println("certificate chain:", out.chain)
+	return out, nil
+}
+
+// writeFile writes content to file, an existing file with other content is
+// kept as a backup named after the time.
+func writeFile(l *log.Logger, file string, content []byte, perm os.FileMode) error {
+	if len(content) == 0 {
+		return errors.New(file + " is empty")
+	}
+	old, err := ioutil.ReadFile(file)
+	if err == nil && bytes.Equal(old, content) {
+		l.Println("unchanged file", file)
+		return os.Chmod(file, perm)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err == nil {
+		// the backup of a private key is as private as the new key
+		if err := os.Chmod(file, perm); err != nil {
+			return err
+		}
+		backup := fmt.Sprintf("%s.%s.bak", file, time.Now().Format("20060102150405"))
+		if err := os.Rename(file, backup); err != nil {
+			return err
+		}
+		l.Println("backed up", file, "to", backup)
+	}
+	if err := ioutil.WriteFile(file, content, perm); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(file, perm); err != nil {
+		return err
+	}
+	l.Println("written file", file)
+	return nil
+}
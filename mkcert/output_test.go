@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testIssue returns the full chain and private key of a certificate of names,
+// as issued by the CA.
+func testIssue(t *testing.T, names ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	parent := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "R3"}}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(chain, testChain(t, "ISRG Root X1")...), keyPEM
+}
+
+// testFormats sets -format, -name and -p12-password until the test ends.
+func testFormats(t *testing.T, list, name, password string) {
+	var err error
+	if formats, err = parseFormats(list); err != nil {
+		t.Fatal(err)
+	}
+	nameTemplate = nil
+	if name != "" {
+		nameTemplate = template.Must(template.New("name").Parse(name))
+	}
+	p12Password = password
+	t.Cleanup(func() { formats, nameTemplate, p12Password = nil, nil, "" })
+}
+
+func TestWriteOutputs(t *testing.T) {
+	l := log.New(ioutil.Discard, "", 0)
+	chain, key := testIssue(t, "example.com", "www.example.com")
+	leaf := parseChain(chain)[0]
+
+	for _, test := range []struct {
+		formats           string
+		noKey             bool
+		certPath, keyPath string
+		files             map[string]os.FileMode
+		err               string
+	}{
+		{formats: "cert", certPath: "example.com.cert", keyPath: "example.com.key",
+			files: map[string]os.FileMode{"example.com.cert": 0644, "example.com.key": 0600}},
+		{formats: "cert", noKey: true, certPath: "example.com.cert",
+			files: map[string]os.FileMode{"example.com.cert": 0644}},
+		{formats: "pem", certPath: "example.com/fullchain.pem", keyPath: "example.com/privkey.pem",
+			files: map[string]os.FileMode{"example.com/cert.pem": 0644, "example.com/chain.pem": 0644,
+				"example.com/fullchain.pem": 0644, "example.com/privkey.pem": 0600}},
+		{formats: "der", certPath: "example.com.der", keyPath: "example.com.key.der",
+			files: map[string]os.FileMode{"example.com.der": 0644, "example.com.key.der": 0600}},
+		{formats: "combined", certPath: "example.com.pem", keyPath: "example.com.pem",
+			files: map[string]os.FileMode{"example.com.pem": 0600}},
+		{formats: "combined", noKey: true, err: "combined format needs the private key"},
+		{formats: "p12", certPath: "example.com.p12", keyPath: "example.com.p12",
+			files: map[string]os.FileMode{"example.com.p12": 0600}},
+		{formats: "der,cert", certPath: "example.com.der", keyPath: "example.com.key.der",
+			files: map[string]os.FileMode{"example.com.der": 0644, "example.com.key.der": 0600,
+				"example.com.cert": 0644, "example.com.key": 0600}},
+	} {
+		t.Run(test.formats, func(t *testing.T) {
+			testFormats(t, test.formats, "", "changeit")
+			dir := t.TempDir()
+			k := key
+			if test.noKey {
+				k = nil
+			}
+			out, err := writeOutputs(l, order{names: []string{"example.com", "www.example.com"}, dir: dir}, chain, k)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("error is %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := func(p string) string {
+				if p == "" {
+					return ""
+				}
+				return filepath.Join(dir, p)
+			}
+			if out.certPath != path(test.certPath) || out.keyPath != path(test.keyPath) {
+				t.Errorf("paths are %s and %s", out.certPath, out.keyPath)
+			}
+			if out.chain != "R3 > ISRG Root X1" {
+				t.Errorf("chain is %q", out.chain)
+			}
+			var n int
+			filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					n++
+				}
+				return err
+			})
+			if n != len(test.files) {
+				t.Errorf("%d files are written, want %d", n, len(test.files))
+			}
+			for file, mode := range test.files {
+				info, err := os.Stat(path(file))
+				if err != nil {
+					t.Error(err)
+				} else if info.Mode().Perm() != mode {
+					t.Errorf("mode of %s is %s, want %s", file, info.Mode().Perm(), mode)
+				}
+			}
+		})
+	}
+
+	t.Run("contents", func(t *testing.T) {
+		testFormats(t, "pem,der,combined,p12", "", "changeit")
+		dir := t.TempDir()
+		if _, err := writeOutputs(l, order{names: []string{"example.com"}, dir: dir}, chain, key); err != nil {
+			t.Fatal(err)
+		}
+		read := func(file string) []byte {
+			content, err := ioutil.ReadFile(filepath.Join(dir, file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return content
+		}
+		if certs := parseChain(read("example.com/cert.pem")); len(certs) != 1 || !certs[0].Equal(leaf) {
+			t.Error("cert.pem is not the certificate")
+		}
+		if certs := parseChain(read("example.com/chain.pem")); len(certs) != 1 || certs[0].Equal(leaf) {
+			t.Error("chain.pem is not the intermediate")
+		}
+		if !bytes.Equal(read("example.com/fullchain.pem"), chain) || !bytes.Equal(read("example.com/privkey.pem"), key) {
+			t.Error("fullchain.pem or privkey.pem is not the issued one")
+		}
+		if cert, err := x509.ParseCertificate(read("example.com.der")); err != nil || !cert.Equal(leaf) {
+			t.Errorf("example.com.der is not the certificate (%v)", err)
+		}
+		if k, err := x509.ParsePKCS8PrivateKey(read("example.com.key.der")); err != nil || describeKey(k.(*ecdsa.PrivateKey).Public()) != "ecdsa-p256" {
+			t.Errorf("example.com.key.der is not the key (%v)", err)
+		}
+		combined := read("example.com.pem")
+		if !bytes.Equal(combined, append(append([]byte{}, chain...), key...)) {
+			t.Error("example.com.pem is not the full chain followed by the key")
+		}
+		if _, err := parsePrivateKey(combined); err != nil {
+			t.Error(err)
+		}
+		_, cert, cas, err := pkcs12.DecodeChain(read("example.com.p12"), "changeit")
+		if err != nil || !cert.Equal(leaf) || len(cas) != 1 {
+			t.Errorf("example.com.p12 is not the chain (%v)", err)
+		}
+	})
+
+	t.Run("p12 without password", func(t *testing.T) {
+		testFormats(t, "p12", "", "")
+		_, err := writeOutputs(l, order{names: []string{"example.com"}, dir: t.TempDir()}, chain, key)
+		if err == nil || !strings.Contains(err.Error(), "-p12-password") {
+			t.Errorf("error is %v", err)
+		}
+	})
+
+	t.Run("reused key", func(t *testing.T) {
+		testFormats(t, "combined", "", "")
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "old.key")
+		if err := ioutil.WriteFile(keyFile, key, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writeOutputs(l, order{names: []string{"example.com"}, dir: dir, keyFile: keyFile}, chain, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		testFormats(t, "cert", "", "")
+		if _, err := writeOutputs(l, order{names: []string{"example.com"}, dir: t.TempDir()}, key, key); err == nil {
+			t.Error("no error without certificate")
+		}
+	})
+}
+
+func TestBase(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		names    []string
+		name     string
+		base     string
+	}{
+		{"", []string{"example.com"}, "", "certs/example.com"},
+		{"", []string{"*.example.com", "example.com"}, "", "certs/example.com"},
+		{"{{.Name}}/{{.Name}}", []string{"*.example.com"}, "", "certs/example.com/example.com"},
+		{"{{.Domain}}", []string{"*.example.com"}, "", "certs/*.example.com"},
+		{"{{len .Names}}-{{index .Names 1}}", []string{"example.com", "www.example.com"}, "", "certs/2-www.example.com"},
+		{"{{if false}}x{{end}}", []string{"example.com"}, "", "certs/example.com"},
+		{"{{.Missing}}", []string{"example.com"}, "", "certs/example.com"},
+		{"{{.Name}}/{{.Name}}", []string{"example.com"}, "renewed", "certs/renewed"},
+	} {
+		testFormats(t, "cert", test.template, "")
+		o := order{names: test.names, dir: "certs", name: test.name}
+		if base := o.base(); base != filepath.FromSlash(test.base) {
+			t.Errorf("base of %q by %q is %s, want %s", test.names, test.template, base, test.base)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	var logs bytes.Buffer
+	l := log.New(&logs, "", 0)
+	file := filepath.Join(t.TempDir(), "example.com.key")
+	if err := ioutil.WriteFile(file, []byte("old key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(l, file, []byte("new key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := filepath.Glob(file + ".*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("backups are %q", backups)
+	}
+	if content, _ := ioutil.ReadFile(backups[0]); string(content) != "old key" {
+		t.Errorf("backup is %q", content)
+	}
+	for _, f := range []string{file, backups[0]} {
+		if info, err := os.Stat(f); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("mode of %s is not 0600 (%v)", f, err)
+		}
+	}
+
+	// the same content is not backed up
+	os.Chmod(file, 0644)
+	logs.Reset()
+	if err := writeFile(l, file, []byte("new key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ = filepath.Glob(file + ".*.bak"); len(backups) != 1 || !strings.HasPrefix(logs.String(), "unchanged file") {
+		t.Errorf("backups are %q, logs are %q", backups, logs.String())
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Errorf("mode of unchanged file is %s", info.Mode().Perm())
+	}
+
+	if err := writeFile(l, file, nil, 0600); err == nil {
+		t.Error("empty content is written")
+	}
+}
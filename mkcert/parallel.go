@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// runOrders runs fn for each order, at most -parallel of them at the same
+// time. When orders run at the same time, each of them logs with its primary
+// name as prefix. The errors are returned in the same order as orders. If
+// the ACME account of the orders can't be registered, fn isn't run and all
+// of them fail with its error.
+func runOrders(orders []order, fn func(i int, o order) error) []error {
+	n := parallel
+	if n < 1 {
+		n = 1
+	}
+	errs := make([]error, len(orders))
+	if n > 1 && len(orders) > 1 && !shouldClean {
+		// otherwise each certbot would register its own account
+		if _, err := ensureAccount(log.Default()); err != nil {
+			log.Println("Error:", err)
+			for i := range errs {
+				errs[i] = fmt.Errorf("account: %w", err)
+			}
+			return errs
+		}
+	}
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i, o := range orders {
+		if n > 1 {
+			o.log = log.New(os.Stderr, "["+o.names[0]+"] ", log.LstdFlags|log.Lmsgprefix)
+		}
+		sem <- struct{}{}
+		if n == 1 && i > 0 {
+			log.Println(strings.Repeat("=", 40))
+		}
+		wg.Add(1)
+		go func(i int, o order) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i, o)
+		}(i, o)
+	}
+	wg.Wait()
+	return errs
+}
+
+// issueAll issues the certificates of orders and prints a summary if there
+// are more than one.
+func issueAll(providers []*provider, orders []order) {
+	durations := make([]time.Duration, len(orders))
+	errs := runOrders(orders, func(i int, o order) error {
+		start := time.Now()
+		err := get(providers, o)
+		durations[i] = time.Since(start)
+		if err != nil {
+			o.logger().Println("Error:", err)
+		}
+		return err
+	})
+	if len(orders) == 1 {
+		if errs[0] != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CERTIFICATE\tTIME\tRESULT")
+	for i, o := range orders {
+		result := "ok"
+		if errs[i] != nil {
+			result = errs[i].Error()
+			failed += 1
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", strings.Join(o.names, ","), durations[i].Round(time.Second), result)
+	}
+	w.Flush()
+	if failed > 0 {
+		log.Fatalf("%d of %d certificates failed", failed, len(orders))
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// renewal is a certificate found by renew.
+type renewal struct {
+	file     string
+	cert     *x509.Certificate
+	notAfter time.Time
+	order    order
+	result   string
+	failed   bool
+
+	// plan is true when nothing may be changed, the renewal time chosen is
+	// not kept
+	plan bool
+}
+
+// renewOptions are the options of renew.
+type renewOptions struct {
+	days    int
+	useARI  bool
+	remote  bool
+	upload  bool
+	getcert string
+	upcert  string
+	// paths are the certificate files and directories to check
+	paths []string
+}
+
+func runRenew(providers []*provider, args []string) {
+	var ro renewOptions
+	fs := flag.NewFlagSet("renew", flag.ExitOnError)
+	fs.IntVar(&ro.days, "days", 30, "renew certificates which expire in this number of days, if the server has no renewal information")
+	fs.BoolVar(&ro.useARI, "ari", true, "renew certificates when the server suggests (ACME Renewal Information)")
+	fs.BoolVar(&ro.remote, "remote", false, "check certificates stored in OSS (using getcert) instead of local files")
+	fs.BoolVar(&ro.upload, "upload", false, "upload renewed certificates (using upcert)")
+	fs.StringVar(&ro.getcert, "getcert", "getcert", "getcert command, with its options")
+	fs.StringVar(&ro.upcert, "upcert", "upcert", "upcert command, with its options")
+	fs.Usage = func() {
+		fmt.Println("Usage of mkcert [OPTIONS] renew [RENEW OPTIONS] [FILES OR DIRS...]")
+		fmt.Println(`
+Checks the *.cert files in the working directory, or the given certificate
+files and directories, and issues again those which are due with the same
+names.
+
+A certificate is due at a random time in the renewal window suggested by the
+-server (ACME Renewal Information), or right away if the window is in the
+past, which is how the CA asks for early renewal before revoking certificates. If
+the server has no renewal information for it, a certificate is due when it
+expires in -days. The key type of the old certificate is kept unless -key-type is
+used, and -reuse-key reuses the private key next to the certificate file.
+
+With -remote, the certificates stored in OSS are checked instead, and renewed
+certificates are written to the working directory.
+
+Failure of one certificate does not stop the others, a summary is printed at
+the end.
+
+RENEW OPTIONS:`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if ro.remote && fs.NArg() > 0 {
+		log.Fatal("Error: FILES OR DIRS can not be used with -remote")
+	}
+	ro.paths = fs.Args()
+	if err := ro.run(providers); err != nil {
+		log.Fatal("Error: ", err)
+	}
+}
+
+// run renews the certificates which are due. The files downloaded with
+// -remote, which can be private keys with -reuse-key, are removed before it
+// returns.
+func (ro renewOptions) run(providers []*provider) error {
+	var renewals []*renewal
+	var err error
+	if ro.remote {
+		var tmpDir string
+		tmpDir, err = ioutil.TempDir("", "mkcert")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		renewals, err = findRemoteCerts(ro.getcert, tmpDir)
+	} else {
+		renewals, err = findLocalCerts(ro.paths)
+	}
+	if err != nil {
+		return err
+	}
+
+	var dir *directory
+	if ro.useARI {
+		if dir, err = getDirectory(serverURL); err != nil {
+			log.Println("no renewal information:", err)
+		} else if dir.RenewalInfo == "" {
+			log.Println("no renewal information: server does not support it")
+			dir = nil
+		}
+	}
+
+	var due []*renewal
+	for _, r := range renewals {
+		if r.cert != nil && !isDue(r, dir, ro.days) {
+			continue
+		}
+		due = append(due, r)
+	}
+	if len(due) == 0 {
+		log.Println("no certificates to renew")
+		return nil
+	}
+
+	var orders []order
+	var pending []*renewal
+	for _, r := range due {
+		if r.result == "" {
+			orders = append(orders, r.order)
+			pending = append(pending, r)
+		}
+	}
+	for i := range orders {
+		if ro.upload {
+			orders[i].hooks = append([]string{uploadHook + ":" + ro.upcert}, orders[i].hooks...)
+		}
+	}
+	errs := runOrders(orders, func(i int, o order) error {
+		r := pending[i]
+		l := o.logger()
+		l.Printf("renewing %s", r.file)
+		err := get(providers, o)
+		if err != nil {
+			l.Println("Error:", err)
+			r.result, r.failed = err.Error(), true
+		} else {
+			r.result = "renewed"
+		}
+		if err == nil || isHookError(err) {
+			forgetRenewalTime(r.cert)
+		}
+		return err
+	})
+	for i, err := range errs {
+		if err != nil && pending[i].result == "" {
+			pending[i].result, pending[i].failed = err.Error(), true
+		}
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CERTIFICATE\tEXPIRES\tRESULT")
+	for _, r := range due {
+		expires := "-"
+		if !r.notAfter.IsZero() {
+			expires = r.notAfter.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.file, expires, r.result)
+		if r.failed {
+			failed += 1
+		}
+	}
+	w.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d certificates failed", failed, len(due))
+	}
+	return nil
+}
+
+// isDue returns true if the certificate should be renewed now, according to
+// the renewal information from dir, or -days if there is none.
+func isDue(r *renewal, dir *directory, days int) bool {
+	left := int(time.Until(r.notAfter).Hours() / 24)
+	if dir != nil {
+		at, info, err := renewalTime(dir, r.cert, !r.plan)
+		if err == nil {
+			w := info.SuggestedWindow
+			window := w.Start.Local().Format("2006-01-02 15:04") + " - " + w.End.Local().Format("2006-01-02 15:04")
+			if info.ExplanationURL != "" {
+				window += " (" + info.ExplanationURL + ")"
+			}
+			if time.Now().Before(at) {
+				log.Printf("%s expires in %d days, renewal window %s, scheduled at %s, skipped",
+					r.file, left, window, at.Local().Format("2006-01-02 15:04"))
+				return false
+			}
+			log.Printf("%s expires in %d days, renewal window %s, due", r.file, left, window)
+			return true
+		}
+		log.Printf("%s: no renewal information: %s", r.file, err)
+	}
+	if left > days {
+		log.Printf("%s expires in %d days, skipped", r.file, left)
+		return false
+	}
+	log.Printf("%s expires in %d days, due", r.file, left)
+	return true
+}
+
+// findLocalCerts returns the certificates in files and directories, or in the
+// working directory if paths is empty.
+func findLocalCerts(paths []string) ([]*renewal, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.cert"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	var renewals []*renewal
+	for _, file := range files {
+		renewals = append(renewals, newRenewal(file, filepath.Dir(file), filepath.Dir(file)))
+	}
+	return renewals, nil
+}
+
+// findRemoteCerts downloads the stored certificates into tmpDir and returns
+// them, their renewed files will be written to the working directory.
+func findRemoteCerts(getcert, tmpDir string) ([]*renewal, error) {
+	out, err := runGetcert(getcert, "", "-l")
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, name := range strings.Fields(string(out)) {
+		if !strings.HasSuffix(name, ".cert") {
+			continue
+		}
+		args = append(args, name)
+		if reuseKey {
+			args = append(args, strings.TrimSuffix(name, ".cert")+".key")
+		}
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if _, err := runGetcert(getcert, tmpDir, append([]string{"-f"}, args...)...); err != nil {
+		return nil, err
+	}
+	var renewals []*renewal
+	for _, name := range args {
+		if strings.HasSuffix(name, ".cert") {
+			r := newRenewal(filepath.Join(tmpDir, name), tmpDir, ".")
+			r.file = name
+			renewals = append(renewals, r)
+		}
+	}
+	return renewals, nil
+}
+
+// runGetcert runs the getcert command in dir with args and returns its output.
+func runGetcert(getcert, dir string, args ...string) ([]byte, error) {
+	command := strings.Fields(getcert)
+	if len(command) == 0 {
+		return nil, errors.New("empty getcert command")
+	}
+	command = append(command, args...)
+	if debug {
+		log.Println("running", command)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("getcert: %w", err)
+	}
+	return out, nil
+}
+
+// newRenewal reads the certificate file. If it can't be renewed, the result
+// of the renewal is set to the error.
+func newRenewal(file, keyDir, dir string) *renewal {
+	r := &renewal{file: file}
+	cert, err := readCertificate(file)
+	if err != nil {
+		r.result, r.failed = err.Error(), true
+		return r
+	}
+	r.cert, r.notAfter = cert, cert.NotAfter
+	base := strings.TrimSuffix(filepath.Base(file), ".cert")
+	names, err := certNames(cert, base)
+	if err != nil {
+		r.result, r.failed = err.Error(), true
+		return r
+	}
+	r.order = newOrder(names, dir)
+	// the renewed certificate replaces the file
+	r.order.name = base
+	if reuseKey {
+		r.order.keyFile = filepath.Join(keyDir, base+".key")
+	}
+	if r.order.keyType == "" {
+		if kt := describeKey(cert.PublicKey); isValidKeyType(kt) {
+			r.order.keyType = kt
+		}
+	}
+	return r
+}
+
+// readCertificate returns the first certificate of a PEM file, or of a file
+// of the der or p12 format.
+func readCertificate(file string) (*x509.Certificate, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(file) {
+	case ".der":
+		return x509.ParseCertificate(content)
+	case ".p12":
+		_, cert, _, err := pkcs12.DecodeChain(content, p12Password)
+		return cert, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New(file + " is not a PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// certNames returns the names of a certificate, with the name of its files
+// (the wildcard name if there is one) first, so that the renewed files have
+// the same name.
+func certNames(cert *x509.Certificate, base string) ([]string, error) {
+	names := append([]string{}, cert.DNSNames...)
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	primary := -1
+	for i, name := range names {
+		if strings.TrimPrefix(name, "*.") != base {
+			continue
+		}
+		if primary < 0 || strings.HasPrefix(name, "*.") {
+			primary = i
+		}
+	}
+	if primary < 0 {
+		return nil, errors.New("certificate has no name " + base)
+	}
+	names[0], names[primary] = names[primary], names[0]
+	return parseNames(strings.Join(names, ","))
+}
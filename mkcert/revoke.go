@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// revocationReasons are the CRLReason codes of RFC 5280, 7 is not used.
+var revocationReasons = []string{
+	0:  "unspecified",
+	1:  "keyCompromise",
+	2:  "cACompromise",
+	3:  "affiliationChanged",
+	4:  "superseded",
+	5:  "cessationOfOperation",
+	6:  "certificateHold",
+	8:  "removeFromCRL",
+	9:  "privilegeWithdrawn",
+	10: "aACompromise",
+}
+
+func reasonCodes() string {
+	var codes []string
+	for code, name := range revocationReasons {
+		if name != "" {
+			codes = append(codes, fmt.Sprintf("%d (%s)", code, name))
+		}
+	}
+	return strings.Join(codes, ", ")
+}
+
+// revocation is a certificate to revoke and how.
+type revocation struct {
+	// file is NAME.cert or NAME
+	file       string
+	reason     int
+	useCertKey bool
+	remote     bool
+	mark       bool
+	deleteKey  bool
+	getcert    string
+	upcert     string
+}
+
+func runRevoke(args []string) {
+	var r revocation
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	fs.IntVar(&r.reason, "reason", 0, "revocation reason code, can be "+reasonCodes())
+	fs.BoolVar(&r.useCertKey, "cert-key", false, "sign with the private key of the certificate (NAME.key) instead of the account key")
+	fs.BoolVar(&r.remote, "remote", false, "revoke the certificate stored in OSS (using getcert) and mark it as revoked")
+	fs.BoolVar(&r.mark, "mark", false, "mark the certificate as revoked in OSS (using upcert), implied by -remote")
+	fs.BoolVar(&r.deleteKey, "delete-key", false, "also empty the private key stored in OSS when marking")
+	fs.StringVar(&r.getcert, "getcert", "getcert", "getcert command, with its options")
+	fs.StringVar(&r.upcert, "upcert", "upcert", "upcert command, with its options")
+	fs.Usage = func() {
+		fmt.Println("Usage of mkcert [OPTIONS] revoke [REVOKE OPTIONS] NAME.cert")
+		fmt.Println(`
+Revokes a certificate on -server, signed with the key of the ACME account of
+-email, or with -cert-key, with the private key of the certificate (NAME.key),
+for example if the account has been lost.
+
+With -remote, NAME.cert is downloaded from OSS, and it is marked as revoked so
+that getcert refuses to download its files. Use -delete-key to also empty
+NAME.key in OSS.
+
+REVOKE OPTIONS:`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if r.reason < 0 || r.reason >= len(revocationReasons) || revocationReasons[r.reason] == "" {
+		log.Fatal("Error: bad reason code, can be ", reasonCodes())
+	}
+	if r.deleteKey && !r.remote && !r.mark {
+		log.Fatal("Error: -delete-key requires -remote or -mark")
+	}
+	r.file = fs.Arg(0)
+	if err := r.run(); err != nil {
+		log.Fatal("Error: ", err)
+	}
+}
+
+// run revokes the certificate. The files downloaded with -remote, which can
+// be the private key of the certificate, are removed before it returns.
+func (r revocation) run() error {
+	file := r.file
+	if !strings.HasSuffix(file, ".cert") {
+		file += ".cert"
+	}
+	name := strings.TrimSuffix(filepath.Base(file), ".cert")
+	keyFile := strings.TrimSuffix(file, ".cert") + ".key"
+	if r.remote {
+		tmpDir, err := ioutil.TempDir("", "mkcert")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		files := []string{name + ".cert"}
+		if r.useCertKey {
+			files = append(files, name+".key")
+		}
+		if _, err := runGetcert(r.getcert, tmpDir, append([]string{"-f"}, files...)...); err != nil {
+			return err
+		}
+		file = filepath.Join(tmpDir, name+".cert")
+		keyFile = filepath.Join(tmpDir, name+".key")
+	}
+
+	cert, err := readCertificate(file)
+	if err != nil {
+		return err
+	}
+	log.Println("certificate:", strings.Join(cert.DNSNames, ", "), "serial", fmt.Sprintf("%x", cert.SerialNumber))
+
+	var key crypto.Signer
+	var kid string
+	if r.useCertKey {
+		if key, err = readPrivateKey(keyFile); err == nil {
+			err = checkCertKey(cert, key)
+		}
+		if err != nil {
+			return err
+		}
+		log.Println("signing with certificate key", keyFile)
+	} else {
+		a, err := findAccount()
+		if err != nil {
+			return err
+		}
+		if key, err = a.key(); err != nil {
+			return err
+		}
+		kid = a.URI
+		log.Println("signing with account", a.URI)
+	}
+
+	dir, err := getDirectory(serverURL)
+	if err != nil {
+		return err
+	}
+	if err := revokeCert(dir, key, kid, cert.Raw, r.reason); err != nil {
+		return err
+	}
+	log.Println("revoked", name, "with reason", revocationReasons[r.reason])
+
+	if !r.remote && !r.mark {
+		return nil
+	}
+	command := strings.Fields(r.upcert)
+	if len(command) == 0 {
+		return errors.New("empty upcert command")
+	}
+	command = append(command, "-revoke", "-reason", fmt.Sprint(r.reason))
+	if r.deleteKey {
+		command = append(command, "-delete-key")
+	}
+	command = append(command, name)
+	if debug {
+		log.Println("running", command)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.New("upcert: " + err.Error())
+	}
+	return nil
+}
+
+// checkCertKey returns error if key is not the private key of cert.
+func checkCertKey(cert *x509.Certificate, key crypto.Signer) error {
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return errors.New("private key does not match the certificate")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	certbotImage = "certbot/certbot:v1.10.0"
+
+	// caBundlePath is where the -ca-bundle file is mounted in the container.
+	caBundlePath = "/etc/mkcert/ca.pem"
+)
+
+var (
+	// servers are the ACME directories which can be used by name in -server.
+	servers = map[string]string{
+		"letsencrypt":         "https://acme-v02.api.letsencrypt.org/directory",
+		"letsencrypt-staging": "https://acme-staging-v02.api.letsencrypt.org/directory",
+		"zerossl":             "https://acme.zerossl.com/v2/DV90",
+		"buypass":             "https://api.buypass.com/acme/directory",
+		"google":              "https://dv.acme-v02.api.pki.goog/directory",
+	}
+
+	// serversWithEAB require External Account Binding for new accounts.
+	serversWithEAB = []string{"zerossl", "google"}
+)
+
+func serverNames() string {
+	var names []string
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// resolveServer returns the directory URL of a -server value, which can be a
+// name in servers or a URL.
+func resolveServer(server string) (string, error) {
+	if url, ok := servers[server]; ok {
+		for _, name := range serversWithEAB {
+			if name == server && (eabKid == "" || eabHmacKey == "") {
+				return "", errors.New(server + " requires -eab-kid and -eab-hmac-key")
+			}
+		}
+		return url, nil
+	}
+	if !strings.HasPrefix(server, "https://") && !strings.HasPrefix(server, "http://") {
+		return "", errors.New("bad server " + server + ", must be an URL or one of " + serverNames())
+	}
+	return server, nil
+}
+
+// certbotServerArgs returns the arguments of docker create and certbot for
+// the ACME server, its account and the custom CA bundle. The mounted paths
+// are absolute, docker takes a relative one for the name of a volume.
+func certbotServerArgs() (dockerArgs, certbotArgs []string, err error) {
+	dir, err := filepath.Abs(accountsDir(email))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	dockerArgs = append(dockerArgs, "-v", dir+":/etc/letsencrypt/accounts")
+	certbotArgs = []string{"--server", serverURL, "--agree-tos"}
+	if email == "" {
+		certbotArgs = append(certbotArgs, "--register-unsafely-without-email")
+	} else {
+		certbotArgs = append(certbotArgs, "--email", email)
+	}
+	if eabKid != "" {
+		certbotArgs = append(certbotArgs, "--eab-kid", eabKid, "--eab-hmac-key", eabHmacKey)
+	}
+	if caBundle != "" {
+		bundle, err := filepath.Abs(caBundle)
+		if err != nil {
+			return nil, nil, err
+		}
+		dockerArgs = append(dockerArgs, "-v", bundle+":"+caBundlePath+":ro",
+			"-e", "REQUESTS_CA_BUNDLE="+caBundlePath)
+	}
+	return
+}
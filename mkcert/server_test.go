@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCertbotServerArgs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	// the fallback when there is no home directory
+	stateDir, email, caBundle = ".certutils", "", "pebble.minica.pem"
+	defer func() { stateDir, caBundle = "", "" }()
+
+	dockerArgs, _, err := certbotServerArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-v", filepath.Join(dir, ".certutils", "accounts", noEmail) + ":/etc/letsencrypt/accounts",
+		"-v", filepath.Join(dir, "pebble.minica.pem") + ":" + caBundlePath + ":ro",
+		"-e", "REQUESTS_CA_BUNDLE=" + caBundlePath,
+	}
+	if !reflect.DeepEqual(dockerArgs, want) {
+		t.Errorf("docker arguments are %q, want %q", dockerArgs, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".certutils", "accounts", noEmail)); err != nil {
+		t.Error(err)
+	}
+}
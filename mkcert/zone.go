@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/caiguanhao/certutils/dns"
+)
+
+type (
+	// provider is a DNS provider and the zones (root domains) it manages.
+	provider struct {
+		name   string
+		client dns.DNS
+
+		mu    sync.Mutex
+		zones []string
+	}
+
+	// zone is a zone on a DNS provider.
+	zone struct {
+		provider *provider
+		name     string
+
+		// target is the name of the challenge records in the zone, which is
+		// the _acme-challenge name or the target of its CNAME
+		target string
+	}
+)
+
+// dnsAccounts are the named accounts of DNS providers of -dns-config.
+var dnsAccounts dns.Accounts
+
+// newProviders creates providers from a comma-separated list of DNS types or
+// accounts of -dns-config.
+func newProviders(dnsTypes string) ([]*provider, error) {
+	var providers []*provider
+	for _, name := range strings.Split(dnsTypes, ",") {
+		name = strings.TrimSpace(name)
+		client, err := dnsAccounts.New(name)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, &provider{name: name, client: client})
+	}
+	return providers, nil
+}
+
+// findZone returns the most specific zone that contains name on any of the
+// providers, or nil if none of the providers has it.
+func findZone(providers []*provider, name string) (*zone, error) {
+	var found *zone
+	for _, p := range providers {
+		p.mu.Lock()
+		if p.zones == nil {
+			zones, err := p.client.GetListOfDomains()
+			if err != nil {
+				p.mu.Unlock()
+				return nil, err
+			}
+			p.zones = zones
+		}
+		p.mu.Unlock()
+		for _, z := range p.zones {
+			if name != z && !strings.HasSuffix(name, "."+z) {
+				continue
+			}
+			if found == nil || len(z) > len(found.name) {
+				found = &zone{provider: p, name: z}
+			}
+		}
+	}
+	return found, nil
+}
+
+// findChallengeZone returns the zone of the TXT records of the challenge
+// name acme, which are created at the target of its CNAME if it has one, for
+// example in a zone of acme-dns, or nil if none of the providers has it.
+func findChallengeZone(l *log.Logger, providers []*provider, acme string) (*zone, error) {
+	target, err := dns.LookupCNAME(acme, resolver)
+	if err != nil {
+		l.Println("failed to look up CNAME of", acme+":", err)
+		target = acme
+	}
+	target = strings.ToLower(target)
+	if target != acme {
+		l.Println(acme, "is a CNAME of", target)
+	}
+	z, err := findZone(providers, target)
+	if err != nil {
+		return nil, err
+	}
+	if z == nil {
+		if target != acme {
+			return nil, errors.New("you don't have root domain for " + target + ", the CNAME target of " + acme)
+		}
+		return nil, nil
+	}
+	z.target = target
+	return z, nil
+}
+
+// record returns the name of the challenge records relative to the zone.
+func (z *zone) record() string {
+	return z.relative(z.target)
+}
+
+// relative returns fqdn relative to the zone, "@" for the zone apex.
+func (z *zone) relative(fqdn string) string {
+	if fqdn == z.name {
+		return "@"
+	}
+	return strings.TrimSuffix(fqdn, "."+z.name)
+}
+
+func (z *zone) String() string {
+	return z.name + " (" + z.provider.name + ")"
+}
+
+// Orders issued at the same time change records one at a time in each zone,
+// and an order holds the names of its challenge records until it is done, so
+// that another order doesn't clean them.
+var (
+	locksMu sync.Mutex
+	locks   = map[string]*sync.Mutex{}
+)
+
+func getLock(key string) *sync.Mutex {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if locks[key] == nil {
+		locks[key] = &sync.Mutex{}
+	}
+	return locks[key]
+}
+
+// lockNames locks the challenge record names (in the same order for all
+// orders to avoid deadlocks) and returns the function to unlock them.
+func lockNames(names []string) func() {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		getLock("name:" + name).Lock()
+	}
+	return func() {
+		for _, name := range sorted {
+			getLock("name:" + name).Unlock()
+		}
+	}
+}
+
+func (z *zone) lock() func() {
+	m := getLock("zone:" + z.provider.name + ":" + z.name)
+	m.Lock()
+	return m.Unlock
+}
+
+// addTXT creates a TXT record of the relative name in the zone.
+func (z *zone) addTXT(name, value string) (string, error) {
+	defer z.lock()()
+	return z.provider.client.AddNewRecord(z.name, name, "TXT", value)
+}
+
+func (z *zone) deleteRecord(id string) error {
+	defer z.lock()()
+	return z.provider.client.DeleteRecord(z.name, id)
+}
+
+// clean removes all TXT records of the relative name in the zone.
+func (z *zone) clean(l *log.Logger, name string) error {
+	defer z.lock()()
+	ids, err := z.provider.client.GetRecordIdsFor(z.name, name, "TXT")
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		l.Println("no TXT records for", name, "in", z.name, "yet!")
+		return nil
+	}
+	l.Println("found", len(ids), "TXT records for", name, "in", z.name)
+	for _, id := range ids {
+		l.Println("deleting TXT record with id", id)
+		if err := z.provider.client.DeleteRecord(z.name, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acmeName returns the name of the TXT record for the DNS-01 challenge of a
+// domain name, which is the same for a wildcard name and the domain itself.
+func acmeName(name string) string {
+	return "_acme-challenge." + strings.TrimPrefix(name, "*.")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/caiguanhao/certutils/dns"
+	"github.com/caiguanhao/certutils/dns/dnstest"
+)
+
+func TestFindZone(t *testing.T) {
+	a := dns.NewMemory("example.com", "example.net")
+	b := dns.NewMemory("sub.example.com")
+	providers := []*provider{{name: "a", client: a}, {name: "b", client: b}}
+
+	a.FailNext("GetListOfDomains", errors.New("unauthorized"))
+	if z, err := findZone(providers, "example.com"); err == nil {
+		t.Errorf("zone is %v without the domains of a", z)
+	}
+	for name, want := range map[string]string{
+		"example.com":                         "example.com (a)",
+		"_acme-challenge.example.com":         "example.com (a)",
+		"sub.example.com":                     "sub.example.com (b)",
+		"_acme-challenge.www.sub.example.com": "sub.example.com (b)",
+		"_acme-challenge.example.net":         "example.net (a)",
+		"example.org":                         "",
+		"notexample.com":                      "",
+	} {
+		z, err := findZone(providers, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if z != nil {
+			got = z.String()
+		}
+		if got != want {
+			t.Errorf("zone of %s is %q, want %q", name, got, want)
+		}
+	}
+	// the domains are listed until they are got once
+	if a.Calls("GetListOfDomains") != 2 || b.Calls("GetListOfDomains") != 1 {
+		t.Errorf("domains are listed %d and %d times", a.Calls("GetListOfDomains"), b.Calls("GetListOfDomains"))
+	}
+}
+
+// TestFindChallengeZone checks that the challenge records are in the zone of
+// the CNAME target of the challenge name, which the rfc2136 fake resolves.
+func TestFindChallengeZone(t *testing.T) {
+	s, err := dnstest.NewServer("rfc2136", "example.com", "auth.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := dnstest.Fakes["rfc2136"](s).AddNewRecord("example.com", "_acme-challenge.www", "CNAME", "x.auth.example.org."); err != nil {
+		t.Fatal(err)
+	}
+	resolver = s.Addr
+	defer func() { resolver = "" }()
+
+	l := log.New(ioutil.Discard, "", 0)
+	a := &provider{name: "a", client: dns.NewMemory("example.com")}
+	b := &provider{name: "b", client: dns.NewMemory("auth.example.org")}
+	for _, c := range []struct {
+		acme, zone, record string
+	}{
+		{"_acme-challenge.example.com", "example.com (a)", "_acme-challenge"},
+		{"_acme-challenge.www.example.com", "auth.example.org (b)", "x"},
+		// the lookup fails outside the zones of the fake
+		{"_acme-challenge.example.net", "", ""},
+	} {
+		z, err := findChallengeZone(l, []*provider{a, b}, c.acme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z == nil && c.zone != "" || z != nil && (z.String() != c.zone || z.record() != c.record) {
+			t.Errorf("zone of %s is %v, want %s with the record %s", c.acme, z, c.zone, c.record)
+		}
+	}
+	if _, err := findChallengeZone(l, []*provider{a}, "_acme-challenge.www.example.com"); err == nil || !strings.Contains(err.Error(), "CNAME target") {
+		t.Errorf("CNAME target without a zone: %v", err)
+	}
+}
+
+// TestChallengeRecords checks that the TXT records of DNS-01 challenges are
+// added, deleted and cleaned when the provider fails.
+func TestChallengeRecords(t *testing.T) {
+	m := dns.NewMemory("example.com")
+	z := &zone{provider: &provider{name: "memory", client: m}, name: "example.com", target: "_acme-challenge.example.com"}
+	zones := map[string]*zone{"_acme-challenge.example.com": z}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &acmeClient{key: key}
+	var logs bytes.Buffer
+	o := order{
+		names:      []string{"example.com", "*.example.com"},
+		challenges: map[string]string{"example.com": dns01, "*.example.com": dns01},
+		log:        log.New(&logs, "", 0),
+	}
+	authz := &acmeAuthorization{Challenges: []acmeChallenge{
+		{Type: http01, URL: "https://acme.test/chall/1", Token: "http"},
+		{Type: dns01, URL: "https://acme.test/chall/2", Token: "dns"},
+	}}
+	values := func(name string) []string {
+		var values []string
+		for _, r := range m.Records("example.com") {
+			if r.Name == name && r.Type == "TXT" {
+				values = append(values, r.Content)
+			}
+		}
+		return values
+	}
+
+	m.FailNext("AddNewRecord", errors.New("rate limited"))
+	if _, err := deployChallenge(c, o, zones, "example.com", "authz", authz); err == nil || len(m.Records("example.com")) != 0 {
+		t.Errorf("challenge is deployed when the record is not added: %v", err)
+	}
+	var pending []*pendingChallenge
+	for _, name := range o.names {
+		p, err := deployChallenge(c, o, zones, name, "authz", authz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.typ != dns01 || p.challenge.URL != "https://acme.test/chall/2" {
+			t.Errorf("challenge of %s is %s %s", name, p.typ, p.challenge.URL)
+		}
+		pending = append(pending, p)
+	}
+	sum := sha256.Sum256([]byte("dns." + thumbprint(key)))
+	if got := values("_acme-challenge"); len(got) != 2 || got[0] != b64(sum[:]) || got[1] != got[0] {
+		t.Errorf("values are %q, want two of %s", got, b64(sum[:]))
+	}
+
+	// a record which is not deleted is left for the next clean
+	m.FailNext("DeleteRecord", errors.New("busy"))
+	for _, p := range pending {
+		p.cleanup()
+	}
+	if got := values("_acme-challenge"); len(got) != 1 || !strings.Contains(logs.String(), "failed to delete TXT record") {
+		t.Errorf("values are %q after a failed delete", got)
+	}
+
+	if _, err := m.AddNewRecord("example.com", "_acme-challenge", "TXT", "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddNewRecord("example.com", "www", "TXT", "other"); err != nil {
+		t.Fatal(err)
+	}
+	m.FailNext("GetRecordIdsFor", errors.New("timeout"))
+	if err := z.clean(o.logger(), z.record()); err == nil {
+		t.Error("records are cleaned without their ids")
+	}
+	m.FailNext("DeleteRecord", nil, errors.New("busy"))
+	if err := z.clean(o.logger(), z.record()); err == nil || len(values("_acme-challenge")) != 1 {
+		t.Errorf("clean: %v, values are %q", err, values("_acme-challenge"))
+	}
+	logs.Reset()
+	for i := 0; i < 2; i++ {
+		if err := z.clean(o.logger(), z.record()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := values("_acme-challenge"); len(got) != 0 || !strings.Contains(logs.String(), "found 1 TXT records") ||
+		!strings.Contains(logs.String(), "no TXT records") {
+		t.Errorf("values are %q after clean, logs:\n%s", got, logs.String())
+	}
+	if got := values("www"); len(got) != 1 {
+		t.Errorf("other records are cleaned: %q", got)
+	}
+}
@@ -2,4 +2,7 @@ module github.com/caiguanhao/certutils/upcert
 
 go 1.15
 
-require github.com/caiguanhao/ossslim v0.0.0-20201230035309-1cecd519243f
+require (
+	filippo.io/age v1.0.0
+	github.com/caiguanhao/ossslim v0.0.0-20201230035309-1cecd519243f
+)
@@ -1,16 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"filippo.io/age"
 	"github.com/caiguanhao/ossslim"
 )
 
@@ -22,7 +36,54 @@ var (
 	ossBucket          string
 )
 
+// gcmMagic starts the header of objects whose object name, kind and upload
+// time are authenticated as AES-GCM associated data. The header is followed by
+// the upload time in unix seconds and a newline, then the nonce and ciphertext.
+const gcmMagic = "certutils-gcm/v2 "
+
+// ageMagic starts the plaintext of files encrypted with age, followed by the
+// object name and a newline, then the upload time in unix seconds and a
+// newline, so that the name and time are authenticated with the content.
+const ageMagic = "certutils-age/v1 "
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
+	var recipientArgs, recipientFiles stringsFlag
+	flag.Var(&recipientArgs, "r", "encrypt to age recipient (age1...), can be used multiple times")
+	flag.Var(&recipientFiles, "R", "encrypt to recipients listed in file, can be used multiple times")
+	usePassphrase := flag.Bool("p", false, "encrypt with a passphrase (from $UPCERT_PASSPHRASE or prompt)")
+	revoke := flag.Bool("revoke", false, "mark certificates of NAMES as revoked instead of uploading files")
+	reason := flag.Int("reason", 0, "revocation reason code to record with -revoke")
+	deleteKey := flag.Bool("delete-key", false, "with -revoke, also empty the stored key")
+	flag.Usage = func() {
+		fmt.Println("Usage of upcert [OPTIONS] FILES...")
+		fmt.Println("         upcert -revoke [-reason CODE] [-delete-key] NAMES...")
+		fmt.Println(`
+This utility encrypts cert files and uploads them to Aliyun OSS.
+
+Without -r, -R or -p, files are encrypted with the built-in symmetric key.
+With -r or -R, files are encrypted to the listed age X25519 recipients, so
+only hosts holding one of the matching identities can decrypt them. With -p,
+files are encrypted with a passphrase (scrypt) for break-glass access.
+
+With -revoke, a "NAME.revoked" file is uploaded for each name (e.g.
+example.com), so that getcert refuses to download its files, and -delete-key
+empties NAME.key. The mark is encrypted with the built-in key, so anyone with
+the key can revoke, and anyone who can write to the bucket can remove the mark.
+
+OPTIONS:`)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	files := flag.Args()
 	if len(files) == 0 {
@@ -34,25 +95,208 @@ func main() {
 		Prefix:          ossPrefix,
 		Bucket:          ossBucket,
 	}
+	if *revoke {
+		for _, name := range files {
+			if err := markRevoked(client, name, *reason, *deleteKey); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+	recipients, err := getRecipients(recipientArgs, recipientFiles, *usePassphrase)
+	if err != nil {
+		log.Fatal(err)
+	}
 	for _, file := range files {
 		f, err := ioutil.ReadFile(file)
 		if err != nil {
 			panic(err)
 		}
-		b, err := encrypt(f)
+		file = filepath.Base(file)
+		object := "certs/" + file
+		var b []byte
+		if len(recipients) > 0 {
+			b, err = encryptAge(object, f, recipients, time.Now())
+		} else {
+			b, err = encrypt(object, f, time.Now())
+		}
 		if err != nil {
 			panic(err)
 		}
-		file = filepath.Base(file)
-		_, err = client.Upload("/certs/"+file, bytes.NewReader(b), nil, "")
+		_, err = client.Upload("/"+object, bytes.NewReader(b), nil, "")
 		if err != nil {
 			panic(err)
 		}
-		log.Println("uploaded", file)
+		if kindOf(file) == "cert" {
+			log.Println("uploaded", file, "("+certKeyType(f)+")")
+		} else {
+			log.Println("uploaded", file)
+		}
+	}
+}
+
+// markRevoked uploads NAME.revoked, encrypted with the built-in key like the
+// other files so that getcert can tell it was written by upcert and not put
+// there under another name. If deleteKey is true, NAME.key is emptied rather
+// than deleted, which getcert treats as revoked too.
+func markRevoked(client ossslim.Client, name string, reason int, deleteKey bool) error {
+	name = strings.TrimSuffix(filepath.Base(name), ".cert")
+	now := time.Now()
+	content := fmt.Sprintf("revoked at %s, reason %d\n", now.UTC().Format(time.RFC3339), reason)
+	object := "certs/" + name + ".revoked"
+	b, err := encrypt(object, []byte(content), now)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Upload("/"+object, bytes.NewReader(b), nil, ""); err != nil {
+		return err
+	}
+	log.Println("marked", name, "as revoked")
+	if !deleteKey {
+		return nil
+	}
+	_, err = client.Upload("/certs/"+name+".key", bytes.NewReader(nil), nil, "")
+	if err != nil {
+		return err
+	}
+	log.Println("emptied", name+".key")
+	return nil
+}
+
+// certKeyType returns the key type of the first certificate in content.
+func certKeyType(content []byte) string {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return "not a certificate"
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err.Error()
+	}
+	return describeKey(cert.PublicKey)
+}
+
+// describeKey returns the key type of a public key in the same form as the
+// -key-type option of mkcert, for example "ecdsa-p256" or "rsa2048".
+func describeKey(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ecdsa-" + strings.ToLower(strings.Replace(k.Curve.Params().Name, "-", "", 1))
+	case *rsa.PublicKey:
+		return "rsa" + strconv.Itoa(k.N.BitLen())
+	}
+	return fmt.Sprintf("%T", pub)
+}
+
+func getRecipients(args, files []string, usePassphrase bool) ([]age.Recipient, error) {
+	if usePassphrase {
+		if len(args) > 0 || len(files) > 0 {
+			return nil, errors.New("-p can not be used with -r or -R")
+		}
+		passphrase, err := readPassphrase("UPCERT_PASSPHRASE")
+		if err != nil {
+			return nil, err
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{r}, nil
+	}
+	var recipients []age.Recipient
+	for _, arg := range args {
+		r, err := age.ParseX25519Recipient(arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad recipient %q: %w", arg, err)
+		}
+		recipients = append(recipients, r)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		rs, err := age.ParseRecipients(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bad recipients file %s: %w", file, err)
+		}
+		recipients = append(recipients, rs...)
+	}
+	return recipients, nil
+}
+
+// readPassphrase returns the passphrase in the environment variable env, or
+// reads it twice from the terminal, since files encrypted with a mistyped
+// passphrase can't be decrypted. The passphrase is kept as it is typed, only
+// the line ending is removed.
+func readPassphrase(env string) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+	stty := func(args ...string) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	reader := bufio.NewReader(os.Stdin)
+	prompt := func(label string) (string, error) {
+		fmt.Fprint(os.Stderr, label)
+		stty("-echo")
+		input, err := reader.ReadString('\n')
+		stty("echo")
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimRight(input, "\r\n"), err
 	}
+	var passphrase string
+	for passphrase == "" {
+		input, err := prompt("Enter passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		passphrase = input
+	}
+	confirm, err := prompt("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func encryptAge(object string, content []byte, recipients []age.Recipient, uploadedAt time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	header := ageMagic + object + "\n" + strconv.FormatInt(uploadedAt.Unix(), 10) + "\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// kindOf returns the kind of a cert file, i.e. its extension without the dot.
+func kindOf(object string) string {
+	return strings.TrimPrefix(filepath.Ext(object), ".")
+}
+
+// associatedData binds an object's name, kind and upload time to its
+// ciphertext, so that an object copied to another name fails to decrypt.
+func associatedData(object, kind string, timestamp int64) []byte {
+	return []byte(gcmMagic + object + "\n" + kind + "\n" + strconv.FormatInt(timestamp, 10))
 }
 
-func encrypt(content []byte) ([]byte, error) {
+func encrypt(object string, content []byte, uploadedAt time.Time) ([]byte, error) {
 	block, err := aes.NewCipher([]byte(encryptionKey))
 	if err != nil {
 		return nil, err
@@ -68,5 +312,8 @@ func encrypt(content []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return aesgcm.Seal(nonce, nonce, content, nil), nil
+	timestamp := uploadedAt.Unix()
+	header := []byte(gcmMagic + strconv.FormatInt(timestamp, 10) + "\n")
+	ad := associatedData(object, kindOf(object), timestamp)
+	return aesgcm.Seal(append(header, nonce...), nonce, content, ad), nil
 }
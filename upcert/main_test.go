@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func TestEncrypt(t *testing.T) {
+	encryptionKey = "0123456789abcdef0123456789abcdef"
+	defer func() { encryptionKey = "" }()
+	uploadedAt := time.Unix(1700000000, 0)
+	b, err := encrypt("certs/example.com.cert", []byte("CERT"), uploadedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "certutils-gcm/v2 1700000000\n"
+	if !strings.HasPrefix(string(b), header) {
+		t.Fatalf("header of %q is not %q", b, header)
+	}
+	block, _ := aes.NewCipher([]byte(encryptionKey))
+	aesgcm, _ := cipher.NewGCM(block)
+	nonce, ciphertext := b[len(header):len(header)+aesgcm.NonceSize()], b[len(header)+aesgcm.NonceSize():]
+
+	// getcert opens the object with the associated data of its own name and
+	// kind, and the time in the header
+	for _, test := range []struct {
+		name, object, kind string
+		timestamp          int64
+		ok                 bool
+	}{
+		{"same object", "certs/example.com.cert", "cert", 1700000000, true},
+		{"renamed", "certs/example.net.cert", "cert", 1700000000, false},
+		{"copied to another kind", "certs/example.com.key", "key", 1700000000, false},
+		{"other kind", "certs/example.com.cert", "key", 1700000000, false},
+		{"older upload time", "certs/example.com.cert", "cert", 1600000000, false},
+	} {
+		plaintext, err := aesgcm.Open(nil, nonce, ciphertext, associatedData(test.object, test.kind, test.timestamp))
+		if test.ok && (err != nil || string(plaintext) != "CERT") {
+			t.Errorf("%s: content is %q (%v)", test.name, plaintext, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: decrypted", test.name)
+		}
+	}
+
+	if kindOf("certs/example.com.key") != "key" || kindOf("example.com.revoked") != "revoked" {
+		t.Error("bad kind")
+	}
+	again, err := encrypt("certs/example.com.cert", []byte("CERT"), uploadedAt)
+	if err != nil || bytes.Equal(again, b) {
+		t.Errorf("nonce is reused (%v)", err)
+	}
+}
+
+func TestEncryptAge(t *testing.T) {
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrypt, err := age.NewScryptRecipient("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrypt.SetWorkFactor(10)
+	scryptID, err := age.NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("-----BEGIN CERTIFICATE-----\n")
+	uploadedAt := time.Unix(1700000000, 0)
+	for _, test := range []struct {
+		name      string
+		recipient age.Recipient
+		identity  age.Identity
+	}{
+		{"x25519", x25519.Recipient(), x25519},
+		{"scrypt", scrypt, scryptID},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := encryptAge("certs/example.com.cert", content, []age.Recipient{test.recipient}, uploadedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := age.Decrypt(bytes.NewReader(b), test.identity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "certutils-age/v1 certs/example.com.cert\n1700000000\n" + string(content)
+			if string(plaintext) != want {
+				t.Errorf("plaintext is %q, want %q", plaintext, want)
+			}
+		})
+	}
+}
+
+func TestReadPassphrase(t *testing.T) {
+	input := func(s string) {
+		f, err := ioutil.TempFile(t.TempDir(), "stdin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Seek(0, 0)
+		os.Stdin = f
+	}
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+
+	for _, test := range []struct {
+		input, passphrase, err string
+	}{
+		{"secret\nsecret\n", "secret", ""},
+		{"\n secret \r\n secret \r\n", " secret ", ""},
+		{"secret\nsecreT\n", "", "passphrases do not match"},
+		{"secret\n", "", "EOF"},
+	} {
+		input(test.input)
+		passphrase, err := readPassphrase("UPCERT_TEST_PASSPHRASE")
+		errString := ""
+		if err != nil {
+			errString = err.Error()
+		}
+		if passphrase != test.passphrase || errString != test.err {
+			t.Errorf("passphrase of %q is %q (%v), want %q (%s)", test.input, passphrase, err, test.passphrase, test.err)
+		}
+	}
+
+	os.Setenv("UPCERT_TEST_PASSPHRASE", "from env")
+	defer os.Unsetenv("UPCERT_TEST_PASSPHRASE")
+	input("")
+	if passphrase, err := readPassphrase("UPCERT_TEST_PASSPHRASE"); err != nil || passphrase != "from env" {
+		t.Errorf("passphrase is %q (%v), want the one in the environment", passphrase, err)
+	}
+}